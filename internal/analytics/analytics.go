@@ -0,0 +1,121 @@
+package analytics
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/lesi97/internal/store"
+)
+
+var ErrUnknownInterval = errors.New("interval must be one of day, week or month")
+
+// Interval is the size of a bucket, the names match postgres' date_trunc so they can be passed straight through
+type Interval string
+
+const (
+	Day   Interval = "day"
+	Week  Interval = "week" // ISO weeks, starting on monday like date_trunc does
+	Month Interval = "month"
+)
+
+// MaxBuckets stops someone asking for ten years of daily points
+const MaxBuckets = 400
+
+const periodFormat = "2006-01-02"
+
+func ParseInterval(s string) (Interval, error) {
+	switch Interval(s) {
+	case "":
+		return Week, nil
+	case Day, Week, Month:
+		return Interval(s), nil
+	}
+	return "", ErrUnknownInterval
+}
+
+// Start is the start of the bucket t falls in, in t's own location
+func (i Interval) Start(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	switch i {
+	case Week:
+		offset := (int(day.Weekday()) + 6) % 7 // days since monday
+		return day.AddDate(0, 0, -offset)
+	case Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+
+	return day
+}
+
+func (i Interval) Next(t time.Time) time.Time {
+	switch i {
+	case Week:
+		return t.AddDate(0, 0, 7)
+	case Month:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// Buckets lists the start of every bucket that overlaps [from, to)
+func (i Interval) Buckets(from time.Time, to time.Time) []time.Time {
+	buckets := []time.Time{}
+	for start := i.Start(from); start.Before(to); start = i.Next(start) {
+		buckets = append(buckets, start)
+	}
+	return buckets
+}
+
+// Point is one bucket of the time series, empty buckets are still included with zeros so charts don't have to fill gaps
+type Point struct {
+	PeriodStart            string         `json:"period_start"`
+	Sessions               int            `json:"sessions"`
+	TotalVolume            float64        `json:"total_volume"`
+	TotalSets              int            `json:"total_sets"`
+	AverageDurationMinutes float64        `json:"average_duration_minutes"`
+	AverageCalories        float64        `json:"average_calories"`
+	TotalDistance          float64        `json:"total_distance"` // metres out of the store, the api converts it
+	TotalCardioMinutes     float64        `json:"total_cardio_minutes"`
+	SetsPerMuscleGroup     map[string]int `json:"sets_per_muscle_group"`
+}
+
+// BuildSeries lays the aggregated rows out over every bucket between from and to
+func BuildSeries(interval Interval, from time.Time, to time.Time, sessions []store.SessionBucket, muscles []store.MuscleGroupBucket) []Point {
+	buckets := interval.Buckets(from, to)
+
+	points := make([]Point, 0, len(buckets))
+	index := map[string]int{}
+	for _, start := range buckets {
+		period := start.Format(periodFormat)
+		index[period] = len(points)
+		points = append(points, Point{PeriodStart: period, SetsPerMuscleGroup: map[string]int{}})
+	}
+
+	for _, session := range sessions {
+		i, ok := index[session.PeriodStart.Format(periodFormat)]
+		if !ok {
+			continue
+		}
+
+		points[i].Sessions = session.Sessions
+		points[i].TotalVolume = session.TotalVolume
+		points[i].TotalSets = session.TotalSets
+		points[i].AverageDurationMinutes = session.AverageDurationMinutes
+		points[i].AverageCalories = session.AverageCalories
+		points[i].TotalDistance = session.TotalDistanceMeters
+		points[i].TotalCardioMinutes = math.Round(float64(session.TotalCardioSeconds)/60*10) / 10
+	}
+
+	for _, muscle := range muscles {
+		i, ok := index[muscle.PeriodStart.Format(periodFormat)]
+		if !ok {
+			continue
+		}
+
+		points[i].SetsPerMuscleGroup[muscle.MuscleGroup] += muscle.Sets
+	}
+
+	return points
+}
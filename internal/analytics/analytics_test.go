@@ -0,0 +1,74 @@
+package analytics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lesi97/internal/analytics"
+	"github.com/lesi97/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntervalStart(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	require.NoError(t, err)
+
+	wednesday := time.Date(2025, time.January, 8, 22, 30, 0, 0, london)
+
+	tests := []struct {
+		interval analytics.Interval
+		want     time.Time
+	}{
+		{interval: analytics.Day, want: time.Date(2025, time.January, 8, 0, 0, 0, 0, london)},
+		{interval: analytics.Week, want: time.Date(2025, time.January, 6, 0, 0, 0, 0, london)},
+		{interval: analytics.Month, want: time.Date(2025, time.January, 1, 0, 0, 0, 0, london)},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.interval), func(t *testing.T) {
+			assert.True(t, test.want.Equal(test.interval.Start(wednesday)), test.interval.Start(wednesday))
+		})
+	}
+
+	sunday := time.Date(2025, time.January, 12, 9, 0, 0, 0, time.UTC)
+	assert.Equal(t, 6, analytics.Week.Start(sunday).Day())
+}
+
+func TestBuildSeries(t *testing.T) {
+	from := time.Date(2025, time.January, 6, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, time.January, 27, 0, 0, 0, 0, time.UTC)
+
+	sessions := []store.SessionBucket{
+		{PeriodStart: time.Date(2025, time.January, 13, 0, 0, 0, 0, time.UTC), Sessions: 3, TotalVolume: 12000, TotalSets: 30, AverageDurationMinutes: 55, AverageCalories: 400, TotalDistanceMeters: 15000, TotalCardioSeconds: 4530},
+	}
+	muscles := []store.MuscleGroupBucket{
+		{PeriodStart: time.Date(2025, time.January, 13, 0, 0, 0, 0, time.UTC), MuscleGroup: "chest", Sets: 12},
+		{PeriodStart: time.Date(2025, time.January, 13, 0, 0, 0, 0, time.UTC), MuscleGroup: "back", Sets: 9},
+	}
+
+	series := analytics.BuildSeries(analytics.Week, from, to, sessions, muscles)
+	require.Len(t, series, 3)
+
+	assert.Equal(t, "2025-01-06", series[0].PeriodStart)
+	assert.Equal(t, 0, series[0].Sessions)
+	assert.Empty(t, series[0].SetsPerMuscleGroup)
+
+	assert.Equal(t, "2025-01-13", series[1].PeriodStart)
+	assert.Equal(t, 3, series[1].Sessions)
+	assert.Equal(t, 12000.0, series[1].TotalVolume)
+	assert.Equal(t, 15000.0, series[1].TotalDistance)
+	assert.Equal(t, 75.5, series[1].TotalCardioMinutes)
+	assert.Equal(t, map[string]int{"chest": 12, "back": 9}, series[1].SetsPerMuscleGroup)
+
+	assert.Equal(t, "2025-01-20", series[2].PeriodStart)
+}
+
+func TestParseInterval(t *testing.T) {
+	interval, err := analytics.ParseInterval("")
+	require.NoError(t, err)
+	assert.Equal(t, analytics.Week, interval)
+
+	_, err = analytics.ParseInterval("year")
+	assert.ErrorIs(t, err, analytics.ErrUnknownInterval)
+}
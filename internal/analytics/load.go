@@ -0,0 +1,127 @@
+package analytics
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/lesi97/internal/store"
+)
+
+const (
+	AcuteDays   = 7
+	ChronicDays = 28
+)
+
+// Band is the ACWR range considered safe, the usual "sweet spot" is 0.8 to 1.3
+type Band struct {
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+var DefaultBand = Band{Low: 0.8, High: 1.3}
+
+func (b Band) Validate() error {
+	if b.Low <= 0 || b.High <= 0 {
+		return errors.New("acwr band limits must be greater than 0")
+	}
+	if b.Low >= b.High {
+		return errors.New("acwr_low must be less than acwr_high")
+	}
+	return nil
+}
+
+// LoadPoint is one day of training load monitoring, ratios are nil when there isn't enough data for them to mean anything
+type LoadPoint struct {
+	Date        string   `json:"date"`
+	Load        float64  `json:"load"`
+	Sessions    int      `json:"sessions"`
+	AcuteLoad   float64  `json:"acute_load"`   // mean daily load over the last 7 days
+	ChronicLoad float64  `json:"chronic_load"` // mean daily load over the last 28 days
+	ACWR        *float64 `json:"acwr"`
+	Monotony    *float64 `json:"monotony"` // mean / standard deviation of the last 7 days
+	Strain      *float64 `json:"strain"`   // weekly load x monotony
+	Flagged     bool     `json:"flagged"`  // ACWR is outside the band
+}
+
+// LoadHistoryStart is how far before from daily loads are needed for the first day's chronic load to be complete
+func LoadHistoryStart(from time.Time) time.Time {
+	return from.AddDate(0, 0, -(ChronicDays - 1))
+}
+
+// Load works out rolling acute and chronic load, ACWR, monotony and strain for every day in [from, to).
+// daily should cover LoadHistoryStart(from) onwards, days with no sessions count as zero load
+func Load(daily []store.DailyLoad, from time.Time, to time.Time, band Band) []LoadPoint {
+	byDate := map[string]store.DailyLoad{}
+	for _, day := range daily {
+		byDate[day.Date.Format(periodFormat)] = day
+	}
+
+	loadOn := func(day time.Time) float64 {
+		return byDate[day.Format(periodFormat)].Load
+	}
+
+	points := []LoadPoint{}
+	for day := Day.Start(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		acute := window(loadOn, day, AcuteDays)
+		chronic := window(loadOn, day, ChronicDays)
+
+		acuteSum := sum(acute)
+		acuteMean := acuteSum / AcuteDays
+		chronicMean := sum(chronic) / ChronicDays
+
+		point := LoadPoint{
+			Date:        day.Format(periodFormat),
+			Load:        round(loadOn(day)),
+			Sessions:    byDate[day.Format(periodFormat)].Sessions,
+			AcuteLoad:   round(acuteMean),
+			ChronicLoad: round(chronicMean),
+		}
+
+		if chronicMean > 0 {
+			acwr := round(acuteMean / chronicMean)
+			point.ACWR = &acwr
+			point.Flagged = acwr < band.Low || acwr > band.High
+		}
+
+		if sd := standardDeviation(acute, acuteMean); sd > 0 {
+			monotony := round(acuteMean / sd)
+			strain := round(acuteSum * acuteMean / sd)
+			point.Monotony = &monotony
+			point.Strain = &strain
+		}
+
+		points = append(points, point)
+	}
+
+	return points
+}
+
+// window is the loads for the days days ending on (and including) day
+func window(loadOn func(time.Time) float64, day time.Time, days int) []float64 {
+	loads := make([]float64, 0, days)
+	for i := days - 1; i >= 0; i-- {
+		loads = append(loads, loadOn(day.AddDate(0, 0, -i)))
+	}
+	return loads
+}
+
+func sum(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func standardDeviation(values []float64, mean float64) float64 {
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(variance / float64(len(values)))
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,76 @@
+package analytics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lesi97/internal/analytics"
+	"github.com/lesi97/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	from := time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+
+	// four weeks of 300 every other day, then a hard week of 600 every day
+	daily := []store.DailyLoad{}
+	for day := analytics.LoadHistoryStart(from); day.Before(from.AddDate(0, 0, -6)); day = day.AddDate(0, 0, 2) {
+		daily = append(daily, store.DailyLoad{Date: day, Load: 300, Sessions: 1})
+	}
+	for day := from.AddDate(0, 0, -6); !day.After(from); day = day.AddDate(0, 0, 1) {
+		daily = append(daily, store.DailyLoad{Date: day, Load: 600, Sessions: 1})
+	}
+
+	points := analytics.Load(daily, from, to, analytics.DefaultBand)
+	require.Len(t, points, 1)
+
+	point := points[0]
+	assert.Equal(t, "2025-02-01", point.Date)
+	assert.Equal(t, 600.0, point.Load)
+	assert.Equal(t, 600.0, point.AcuteLoad)
+	require.NotNil(t, point.ACWR)
+	assert.Greater(t, *point.ACWR, analytics.DefaultBand.High)
+	assert.True(t, point.Flagged)
+
+	// the same load every day has no spread, so monotony can't be worked out
+	assert.Nil(t, point.Monotony)
+	assert.Nil(t, point.Strain)
+}
+
+func TestLoadMonotonyAndStrain(t *testing.T) {
+	from := time.Date(2025, time.March, 7, 0, 0, 0, 0, time.UTC)
+
+	daily := []store.DailyLoad{}
+	for i, load := range []float64{100, 0, 100, 0, 100, 0, 100} {
+		daily = append(daily, store.DailyLoad{Date: from.AddDate(0, 0, i-6), Load: load, Sessions: 1})
+	}
+
+	points := analytics.Load(daily, from, from.AddDate(0, 0, 1), analytics.DefaultBand)
+	require.Len(t, points, 1)
+
+	require.NotNil(t, points[0].Monotony)
+	require.NotNil(t, points[0].Strain)
+	assert.InDelta(t, 1.15, *points[0].Monotony, 0.01)
+	assert.InDelta(t, 461.88, *points[0].Strain, 0.01)
+}
+
+func TestLoadWithoutHistory(t *testing.T) {
+	from := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	points := analytics.Load(nil, from, from.AddDate(0, 0, 3), analytics.DefaultBand)
+	require.Len(t, points, 3)
+
+	for _, point := range points {
+		assert.Zero(t, point.Load)
+		assert.Nil(t, point.ACWR)
+		assert.False(t, point.Flagged)
+	}
+}
+
+func TestBandValidate(t *testing.T) {
+	assert.NoError(t, analytics.DefaultBand.Validate())
+	assert.Error(t, analytics.Band{Low: 1.5, High: 1.2}.Validate())
+	assert.Error(t, analytics.Band{Low: 0, High: 1.2}.Validate())
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lesi97/internal/analytics"
+	"github.com/lesi97/internal/middleware"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/units"
+	"github.com/lesi97/internal/utils"
+)
+
+type AnalyticsHandler struct {
+	analyticsStore store.AnalyticsStore
+	logger         *log.Logger
+}
+
+func NewAnalyticsHandler(analyticsStore store.AnalyticsStore, logger *log.Logger) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		analyticsStore: analyticsStore,
+		logger:         logger,
+	}
+}
+
+// HandleGetAnalytics returns volume, frequency and intensity bucketed by ?interval= (day, week or month) between ?from= and ?to=,
+// cut in ?tz= and optionally narrowed to one or more ?exercise_id=, volume is in ?units= or the user's preferred unit
+// and distance in km, or mi when that's lb
+func (ah *AnalyticsHandler) HandleGetAnalytics(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	interval, err := analytics.ParseInterval(query.Get("interval"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	loc, err := readTimeZone(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	from, to, err := readAnalyticsRange(query, interval, loc)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	exerciseIDs, err := readExerciseIDs(query)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	filter := store.AnalyticsFilter{
+		UserID:      middleware.GetUser(r).ID,
+		From:        from,
+		To:          to,
+		Interval:    string(interval),
+		TimeZone:    loc.String(),
+		ExerciseIDs: exerciseIDs,
+	}
+
+	sessions, err := ah.analyticsStore.SessionSeries(filter)
+	if err != nil {
+		ah.logger.Printf("ERROR: SessionSeries: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	muscles, err := ah.analyticsStore.MuscleGroupSeries(filter)
+	if err != nil {
+		ah.logger.Printf("ERROR: MuscleGroupSeries: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	distanceUnit := units.DefaultDistance(unit)
+
+	series := analytics.BuildSeries(interval, from, to, sessions, muscles)
+	for i := range series {
+		series[i].TotalVolume = units.FromCanonical(series[i].TotalVolume, unit)
+		series[i].TotalDistance = units.DistanceFromCanonical(series[i].TotalDistance, distanceUnit)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"interval":      interval,
+		"from":          from,
+		"to":            to,
+		"units":         unit,
+		"distance_unit": distanceUnit,
+		"series":        series,
+	})
+}
+
+// HandleGetLoad returns daily training load with acute:chronic workload ratio, monotony and strain between ?from= and ?to=,
+// flagging days whose ACWR falls outside ?acwr_low= to ?acwr_high= (0.8 to 1.3 by default)
+func (ah *AnalyticsHandler) HandleGetLoad(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	loc, err := readTimeZone(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	from, to, err := readAnalyticsRange(query, analytics.Day, loc)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if query.Get("from") == "" {
+		// a day interval would default to 12 days, a full chronic window is more useful here
+		from = analytics.Day.Start(to.AddDate(0, 0, -(analytics.ChronicDays - 1)))
+	}
+
+	band, err := readBand(query)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	daily, err := ah.analyticsStore.DailyLoads(middleware.GetUser(r).ID, analytics.LoadHistoryStart(from), to, loc.String())
+	if err != nil {
+		ah.logger.Printf("ERROR: DailyLoads: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	days := analytics.Load(daily, from, to, band)
+
+	flagged := []string{}
+	for _, day := range days {
+		if day.Flagged {
+			flagged = append(flagged, day.Date)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"from":         from,
+		"to":           to,
+		"band":         band,
+		"days":         days,
+		"flagged_days": flagged,
+	})
+}
+
+// readBand reads ?acwr_low= and ?acwr_high=, either can be left off to keep the default
+func readBand(query url.Values) (analytics.Band, error) {
+	band := analytics.DefaultBand
+
+	// in order rather than from a map so the same request always gets the same error
+	limits := []struct {
+		key   string
+		limit *float64
+	}{
+		{"acwr_low", &band.Low},
+		{"acwr_high", &band.High},
+	}
+	for _, limit := range limits {
+		raw := query.Get(limit.key)
+		if raw == "" {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return analytics.Band{}, fmt.Errorf("%s must be a number", limit.key)
+		}
+		*limit.limit = value
+	}
+
+	return band, band.Validate()
+}
+
+// readTimeZone reads ?tz=, the user's own time zone when it's left off so days are cut where the user's day ends
+func readTimeZone(r *http.Request) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return userLocation(middleware.GetUser(r)), nil
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, errors.New("tz must be an IANA time zone, e.g. Europe/London")
+	}
+
+	return loc, nil
+}
+
+// readAnalyticsRange defaults to the last 12 buckets up to now, from is pulled back to the start of its bucket so the first point is a whole one
+func readAnalyticsRange(query url.Values, interval analytics.Interval, loc *time.Location) (time.Time, time.Time, error) {
+	to := time.Now().In(loc)
+	toParam, err := utils.ReadDateQueryIn(query, "to", true, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if toParam != nil {
+		to = toParam.In(loc)
+	}
+
+	from := interval.Start(to)
+	for i := 1; i < 12; i++ {
+		from = interval.Start(from.Add(-time.Nanosecond))
+	}
+
+	fromParam, err := utils.ReadDateQueryIn(query, "from", false, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if fromParam != nil {
+		from = interval.Start(fromParam.In(loc))
+	}
+
+	if !to.After(from) {
+		return time.Time{}, time.Time{}, errors.New("to must be after from")
+	}
+
+	if len(interval.Buckets(from, to)) > analytics.MaxBuckets {
+		return time.Time{}, time.Time{}, errors.New("range is too long for that interval, use a bigger interval or a shorter range")
+	}
+
+	return from, to, nil
+}
+
+// readExerciseIDs reads any number of ?exercise_id= params
+func readExerciseIDs(query url.Values) ([]int64, error) {
+	ids := []int64{}
+	for _, raw := range query["exercise_id"] {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id < 1 {
+			return nil, errors.New("exercise_id must be a positive whole number")
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
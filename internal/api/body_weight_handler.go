@@ -0,0 +1,123 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/lesi97/internal/middleware"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/units"
+	"github.com/lesi97/internal/utils"
+)
+
+const (
+	defaultBodyWeightLimit = 30
+	maxBodyWeightLimit     = 365
+)
+
+type BodyWeightHandler struct {
+	bodyWeightStore store.BodyWeightStore
+	logger          *log.Logger
+}
+
+func NewBodyWeightHandler(bodyWeightStore store.BodyWeightStore, logger *log.Logger) *BodyWeightHandler {
+	return &BodyWeightHandler{
+		bodyWeightStore: bodyWeightStore,
+		logger:          logger,
+	}
+}
+
+// HandleListBodyWeights returns the user's weigh-ins newest first, ?limit= caps how many (30 by default)
+func (bh *BodyWeightHandler) HandleListBodyWeights(w http.ResponseWriter, r *http.Request) {
+	limit, err := utils.ReadIntQuery(r.URL.Query(), "limit", defaultBodyWeightLimit)
+	if err != nil || limit < 1 || limit > maxBodyWeightLimit {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "limit must be between 1 and 365"})
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	bodyWeights, err := bh.bodyWeightStore.ListBodyWeights(middleware.GetUser(r).ID, limit)
+	if err != nil {
+		bh.logger.Printf("ERROR: ListBodyWeights: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	for _, bodyWeight := range bodyWeights {
+		bodyWeightToDisplay(bodyWeight, unit)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"body_weights": bodyWeights})
+}
+
+// HandleCreateBodyWeight logs a weigh-in, measured_at defaults to now
+func (bh *BodyWeightHandler) HandleCreateBodyWeight(w http.ResponseWriter, r *http.Request) {
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	var bodyWeight store.BodyWeight
+	err := json.NewDecoder(r.Body).Decode(&bodyWeight)
+	if err != nil {
+		bh.logger.Printf("ERROR: decodingCreateBodyWeight: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	if bodyWeight.Weight <= 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "weight must be greater than 0"})
+		return
+	}
+
+	err = weightToCanonical(&bodyWeight.Weight, &bodyWeight.WeightUnit, unit)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	bodyWeight.ID = 0
+	bodyWeight.UserID = middleware.GetUser(r).ID
+
+	err = bh.bodyWeightStore.CreateBodyWeight(&bodyWeight)
+	if err != nil {
+		bh.logger.Printf("ERROR: CreateBodyWeight: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to log body weight"})
+		return
+	}
+	bodyWeightToDisplay(&bodyWeight, unit)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"body_weight": bodyWeight})
+}
+
+func (bh *BodyWeightHandler) HandleDeleteBodyWeight(w http.ResponseWriter, r *http.Request) {
+	bodyWeightId, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid body weight id"})
+		return
+	}
+
+	err = bh.bodyWeightStore.DeleteBodyWeight(middleware.GetUser(r).ID, bodyWeightId)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "body weight not found"})
+		return
+	}
+	if err != nil {
+		bh.logger.Printf("ERROR: DeleteBodyWeight: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func bodyWeightToDisplay(bodyWeight *store.BodyWeight, unit units.Unit) {
+	weightToDisplay(&bodyWeight.Weight, &bodyWeight.WeightUnit, unit)
+}
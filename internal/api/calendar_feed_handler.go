@@ -0,0 +1,208 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lesi97/internal/calendar"
+	"github.com/lesi97/internal/middleware"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/tokens"
+	"github.com/lesi97/internal/utils"
+)
+
+const (
+	calendarFeedTTL        = 5 * 365 * 24 * time.Hour // calendar apps poll forever, the user rotates it if it leaks
+	calendarFeedPastDays   = 90
+	calendarFeedFutureDays = 365
+)
+
+type CalendarFeedHandler struct {
+	tokenStore          store.TokenStore
+	userStore           store.UserStore
+	plannedWorkoutStore store.PlannedWorkoutStore
+	workoutStore        store.WorkoutStore
+	logger              *log.Logger
+}
+
+func NewCalendarFeedHandler(tokenStore store.TokenStore, userStore store.UserStore, plannedWorkoutStore store.PlannedWorkoutStore, workoutStore store.WorkoutStore, logger *log.Logger) *CalendarFeedHandler {
+	return &CalendarFeedHandler{
+		tokenStore:          tokenStore,
+		userStore:           userStore,
+		plannedWorkoutStore: plannedWorkoutStore,
+		workoutStore:        workoutStore,
+		logger:              logger,
+	}
+}
+
+// HandleRotateFeedToken issues a new feed URL, any previous one stops working straight away
+func (ch *CalendarFeedHandler) HandleRotateFeedToken(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	err := ch.tokenStore.DeleteAllTokenForUser(currentUser.ID, tokens.ScopeCalendarFeed)
+	if err != nil {
+		ch.logger.Printf("ERROR: DeleteAllTokenForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	token, err := ch.tokenStore.CreateNewToken(currentUser.ID, calendarFeedTTL, tokens.ScopeCalendarFeed)
+	if err != nil {
+		ch.logger.Printf("ERROR: creatingToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"feed_url": fmt.Sprintf("%s://%s/calendar/feed/%s.ics", scheme, r.Host, token.Plaintext),
+		"expiry":   token.Expiry,
+	})
+}
+
+func (ch *CalendarFeedHandler) HandleRevokeFeedToken(w http.ResponseWriter, r *http.Request) {
+	err := ch.tokenStore.DeleteAllTokenForUser(middleware.GetUser(r).ID, tokens.ScopeCalendarFeed)
+	if err != nil {
+		ch.logger.Printf("ERROR: DeleteAllTokenForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetFeed serves the user's planned and logged workouts as text/calendar, the token in the URL is the only auth
+func (ch *CalendarFeedHandler) HandleGetFeed(w http.ResponseWriter, r *http.Request) {
+	user, err := ch.userStore.GetUserToken(tokens.ScopeCalendarFeed, chi.URLParam(r, "token"))
+	if err != nil {
+		ch.logger.Printf("ERROR: GetUserToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "feed does not exist"})
+		return
+	}
+
+	now := time.Now()
+	from := now.AddDate(0, 0, -calendarFeedPastDays)
+	to := now.AddDate(0, 0, calendarFeedFutureDays)
+
+	events, err := ch.buildFeedEvents(user, from, to, now)
+	if err != nil {
+		ch.logger.Printf("ERROR: buildFeedEvents: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="workouts.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=900")
+
+	err = calendar.WriteICS(w, user.Username+"'s workouts", events)
+	if err != nil {
+		ch.logger.Printf("ERROR: WriteICS: %v", err)
+	}
+}
+
+func (ch *CalendarFeedHandler) buildFeedEvents(user *store.User, from time.Time, to time.Time, now time.Time) ([]calendar.Event, error) {
+	plans, err := ch.plannedWorkoutStore.ListPlannedWorkouts(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := ch.plannedWorkoutStore.ListOccurrenceRecords(user.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences, err := calendar.Expand(plans, records, from, to, time.UTC, now)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []calendar.Event{}
+	linkedWorkouts := map[int]bool{}
+
+	for _, occurrence := range occurrences {
+		event := calendar.Event{
+			UID:         fmt.Sprintf("planned-%d-%d@workouts", occurrence.PlannedWorkoutID, occurrence.StartsAt.Unix()),
+			Summary:     occurrence.Title,
+			Description: fmt.Sprintf("Status: %s", occurrence.Status),
+			Start:       occurrence.StartsAt,
+			End:         occurrence.EndsAt,
+			Status:      "CONFIRMED",
+			Updated:     now,
+		}
+
+		switch occurrence.Status {
+		case store.OccurrenceCompleted:
+			event.Summary = "✓ " + occurrence.Title
+			if occurrence.WorkoutID != nil {
+				linkedWorkouts[*occurrence.WorkoutID] = true // already on the calendar, don't show it twice
+			}
+		case store.OccurrenceSkipped:
+			event.Status = "CANCELLED"
+		case store.OccurrencePlanned:
+			event.Status = "TENTATIVE"
+		}
+
+		if occurrence.Note != "" {
+			event.Description += "\n" + occurrence.Note
+		}
+
+		events = append(events, event)
+	}
+
+	// logged workouts, a page at a time so a long history doesn't all land in memory at once
+	filter := store.WorkoutFilter{
+		UserID: user.ID,
+		From:   &from,
+		To:     &to,
+		Sort:   "started_at",
+		Limit:  store.MaxWorkoutPageLimit,
+	}
+
+	for {
+		page, err := ch.workoutStore.ListWorkouts(filter)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, workout := range page.Workouts {
+			if linkedWorkouts[workout.ID] {
+				continue
+			}
+
+			end := workout.StartedAt.Add(time.Duration(workout.DurationMinutes) * time.Minute)
+			if workout.EndedAt != nil {
+				end = *workout.EndedAt
+			}
+
+			events = append(events, calendar.Event{
+				UID:         fmt.Sprintf("workout-%d@workouts", workout.ID),
+				Summary:     "✓ " + workout.Title,
+				Description: workout.Description,
+				Start:       workout.StartedAt,
+				End:         end,
+				Status:      "CONFIRMED",
+				Updated:     workout.UpdatedAt,
+			})
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+
+	return events, nil
+}
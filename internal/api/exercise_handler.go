@@ -0,0 +1,248 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/lesi97/internal/middleware"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/utils"
+)
+
+type ExerciseHandler struct {
+	exerciseStore store.ExerciseStore
+	logger        *log.Logger
+}
+
+func NewExerciseHandler(exerciseStore store.ExerciseStore, logger *log.Logger) *ExerciseHandler {
+	return &ExerciseHandler{
+		exerciseStore: exerciseStore,
+		logger:        logger,
+	}
+}
+
+// HandleListExercises returns the shared catalog plus the user's custom exercises, filtered by ?q=, ?muscle=, ?equipment= and ?pattern=
+func (eh *ExerciseHandler) HandleListExercises(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := store.ExerciseFilter{
+		Search:    strings.TrimSpace(query.Get("q")),
+		Muscle:    query.Get("muscle"),
+		Equipment: query.Get("equipment"),
+		Pattern:   query.Get("pattern"),
+	}
+
+	exercises, err := eh.exerciseStore.ListExercises(middleware.GetUser(r).ID, filter)
+	if err != nil {
+		eh.logger.Printf("ERROR: ListExercises: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exercises": exercises})
+}
+
+func (eh *ExerciseHandler) HandleGetExerciseById(w http.ResponseWriter, r *http.Request) {
+	exercise, ok := eh.readVisibleExercise(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exercise": exercise})
+}
+
+// HandleMatchExercise shows what ?name= would resolve to when logged as an entry
+func (eh *ExerciseHandler) HandleMatchExercise(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required"})
+		return
+	}
+
+	exercise, score, err := eh.exerciseStore.MatchExercise(middleware.GetUser(r).ID, name)
+	if err != nil {
+		eh.logger.Printf("ERROR: MatchExercise: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if exercise == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "no matching exercise"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exercise": exercise, "score": score})
+}
+
+func (eh *ExerciseHandler) HandleCreateExercise(w http.ResponseWriter, r *http.Request) {
+	var exercise store.Exercise
+	err := json.NewDecoder(r.Body).Decode(&exercise)
+	if err != nil {
+		eh.logger.Printf("ERROR: decodingCreateExercise: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	// anything created through the API is a custom exercise
+	userID := middleware.GetUser(r).ID
+	exercise.UserID = &userID
+
+	err = validateExercise(&exercise)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = eh.exerciseStore.CreateExercise(&exercise)
+	if err != nil {
+		eh.writeExerciseError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"exercise": exercise})
+}
+
+func (eh *ExerciseHandler) HandleUpdateExercise(w http.ResponseWriter, r *http.Request) {
+	existing, ok := eh.readOwnedExercise(w, r)
+	if !ok {
+		return
+	}
+
+	var exercise store.Exercise
+	err := json.NewDecoder(r.Body).Decode(&exercise)
+	if err != nil {
+		eh.logger.Printf("ERROR: decodingUpdateExercise: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	exercise.ID = existing.ID
+	exercise.UserID = existing.UserID
+
+	err = validateExercise(&exercise)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = eh.exerciseStore.UpdateExercise(&exercise)
+	if err != nil {
+		eh.writeExerciseError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exercise": exercise})
+}
+
+// HandleDeleteExercise removes a custom exercise, entries that used it keep their exercise_name and lose the link
+func (eh *ExerciseHandler) HandleDeleteExercise(w http.ResponseWriter, r *http.Request) {
+	exercise, ok := eh.readOwnedExercise(w, r)
+	if !ok {
+		return
+	}
+
+	err := eh.exerciseStore.DeleteExercise(int64(exercise.ID))
+	if err != nil {
+		eh.writeExerciseError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readVisibleExercise reads {id} and writes a 404 for anything the user can't see, someone else's custom exercise included
+func (eh *ExerciseHandler) readVisibleExercise(w http.ResponseWriter, r *http.Request) (*store.Exercise, bool) {
+	exerciseId, err := utils.ReadIDParam(r)
+	if err != nil {
+		eh.logger.Printf("ERROR: ReadIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid exercise id"})
+		return nil, false
+	}
+
+	exercise, err := eh.exerciseStore.GetExerciseById(exerciseId)
+	if err != nil {
+		eh.logger.Printf("ERROR: GetExerciseById: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+
+	if exercise == nil || (exercise.UserID != nil && *exercise.UserID != middleware.GetUser(r).ID) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "exercise does not exist"})
+		return nil, false
+	}
+
+	return exercise, true
+}
+
+func (eh *ExerciseHandler) readOwnedExercise(w http.ResponseWriter, r *http.Request) (*store.Exercise, bool) {
+	exercise, ok := eh.readVisibleExercise(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if exercise.UserID == nil {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "exercises in the shared catalog cannot be changed"})
+		return nil, false
+	}
+
+	return exercise, true
+}
+
+func (eh *ExerciseHandler) writeExerciseError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrDuplicateExercise):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "exercise does not exist"})
+	default:
+		eh.logger.Printf("ERROR: exercise: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+}
+
+func validateExercise(exercise *store.Exercise) error {
+	exercise.Name = strings.TrimSpace(exercise.Name)
+	if exercise.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(exercise.Name) > 255 {
+		return errors.New("name cannot be greater than 255 characters")
+	}
+
+	if len(exercise.PrimaryMuscles) == 0 {
+		return errors.New("primary_muscles needs at least one muscle group")
+	}
+
+	for _, muscle := range slices.Concat(exercise.PrimaryMuscles, exercise.SecondaryMuscles) {
+		if !slices.Contains(store.MuscleGroups, muscle) {
+			return fmt.Errorf("unknown muscle group %q, must be one of %s", muscle, strings.Join(store.MuscleGroups, ", "))
+		}
+	}
+
+	if exercise.Equipment == "" {
+		exercise.Equipment = "other"
+	}
+	if !slices.Contains(store.Equipment, exercise.Equipment) {
+		return fmt.Errorf("equipment must be one of %s", strings.Join(store.Equipment, ", "))
+	}
+
+	if exercise.MovementPattern == "" {
+		exercise.MovementPattern = "other"
+	}
+	if !slices.Contains(store.MovementPatterns, exercise.MovementPattern) {
+		return fmt.Errorf("movement_pattern must be one of %s", strings.Join(store.MovementPatterns, ", "))
+	}
+
+	if exercise.MET != nil && (*exercise.MET <= 0 || *exercise.MET > 25) {
+		return errors.New("met must be greater than 0 and no more than 25")
+	}
+
+	return nil
+}
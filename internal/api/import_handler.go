@@ -0,0 +1,462 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lesi97/internal/importer"
+	"github.com/lesi97/internal/middleware"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/utils"
+)
+
+const (
+	// MaxImportBytes caps the uploaded file, years of Strong history comes in at a few MB
+	MaxImportBytes = 20 << 20
+
+	// ImportBatchSize is how many workouts go to CreateWorkouts at once, progress is saved after each batch
+	ImportBatchSize = 100
+
+	importJobsLimit = 50
+)
+
+type ImportHandler struct {
+	importJobStore  store.ImportJobStore
+	workoutStore    store.WorkoutStore
+	exerciseStore   store.ExerciseStore
+	bodyWeightStore store.BodyWeightStore
+	logger          *log.Logger
+}
+
+func NewImportHandler(importJobStore store.ImportJobStore, workoutStore store.WorkoutStore, exerciseStore store.ExerciseStore, bodyWeightStore store.BodyWeightStore, logger *log.Logger) *ImportHandler {
+	return &ImportHandler{
+		importJobStore:  importJobStore,
+		workoutStore:    workoutStore,
+		exerciseStore:   exerciseStore,
+		bodyWeightStore: bodyWeightStore,
+		logger:          logger,
+	}
+}
+
+// importPreview is what a dry run sends back instead of starting a job
+type importPreview struct {
+	Format      importer.Format        `json:"format"`
+	Workouts    int                    `json:"workouts"`
+	New         int                    `json:"new"` // the rest have been imported before and would be skipped
+	From        *time.Time             `json:"from"`
+	To          *time.Time             `json:"to"`
+	Exercises   []importExercise       `json:"exercises"`
+	Preview     []importPreviewWorkout `json:"preview"`
+	Warnings    []string               `json:"warnings"`
+	SkippedRows int                    `json:"skipped_rows"`
+}
+
+// importExercise is a name from the file and the catalog exercise it'll be linked to
+type importExercise struct {
+	Name         string `json:"name"`
+	ExerciseID   *int   `json:"exercise_id"` // nil when nothing in the catalog was close enough, the entry is kept under its own name
+	ExerciseName string `json:"exercise_name,omitempty"`
+	Workouts     int    `json:"workouts"` // how many workouts it's in
+}
+
+type importPreviewWorkout struct {
+	StartedAt       time.Time `json:"started_at"`
+	Title           string    `json:"title"`
+	DurationMinutes int       `json:"duration_minutes"`
+	Exercises       int       `json:"exercises"`
+	Sets            int       `json:"sets"`
+	Duplicate       bool      `json:"duplicate"`
+}
+
+// HandleCreateImport reads a Strong, Hevy or FitNotes CSV export, sent either as the "file" field of a multipart form
+// or as the whole body. The format is worked out from the headers unless ?format= says. ?units= is what Strong's
+// weights are in as its export doesn't say (the user's preferred unit by default), ?tz= is the zone the apps' times
+// are read in. With ?dry_run=true nothing is written and a preview comes back, otherwise the workouts are created
+// by a background job and this returns 202 with the job to poll at GET /imports/{id}
+func (ih *ImportHandler) HandleCreateImport(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	query := r.URL.Query()
+
+	format, err := importer.ParseFormat(query.Get("format"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	loc, err := readTimeZone(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	dryRun := false
+	if value := query.Get("dry_run"); value != "" {
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "dry_run must be true or false"})
+			return
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportBytes)
+
+	file, err := readImportFile(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	result, err := importer.Parse(file, importer.Options{Format: format, Unit: unit, Location: loc})
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": fmt.Sprintf("file cannot be larger than %d MB", MaxImportBytes>>20)})
+		case errors.Is(err, importer.ErrUnknownFormat):
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		default:
+			ih.logger.Printf("ERROR: importer.Parse: %v", err)
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "could not read the file as CSV"})
+		}
+		return
+	}
+
+	// every entry is matched in one go rather than a catalog lookup per workout
+	entries := []store.WorkoutEntry{}
+	for _, workout := range result.Workouts {
+		entries = append(entries, workout.Entries...)
+	}
+	if !resolveExercises(w, ih.exerciseStore, ih.logger, currentUser.ID, entries) {
+		return
+	}
+	for i := range result.Workouts {
+		n := copy(result.Workouts[i].Entries, entries)
+		entries = entries[n:]
+	}
+
+	if dryRun {
+		preview, err := ih.previewImport(currentUser.ID, result)
+		if err != nil {
+			ih.logger.Printf("ERROR: previewImport: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"preview": preview})
+		return
+	}
+
+	if len(result.Workouts) == 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "no workouts found in the file", "warnings": result.Warnings})
+		return
+	}
+
+	job := &store.ImportJob{
+		UserID:   currentUser.ID,
+		Format:   string(result.Format),
+		Total:    len(result.Workouts),
+		Warnings: result.Warnings,
+	}
+
+	err = ih.importJobStore.CreateImportJob(job)
+	if err != nil {
+		ih.logger.Printf("ERROR: CreateImportJob: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to start import"})
+		return
+	}
+
+	// the response is written before the job starts changing it
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"import": job})
+
+	go ih.runImport(job, result.Workouts)
+}
+
+// HandleListImports is the user's most recent imports, newest first
+func (ih *ImportHandler) HandleListImports(w http.ResponseWriter, r *http.Request) {
+	jobs, err := ih.importJobStore.ListImportJobs(middleware.GetUser(r).ID, importJobsLimit)
+	if err != nil {
+		ih.logger.Printf("ERROR: ListImportJobs: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"imports": jobs})
+}
+
+// HandleGetImport is how a client follows a job's progress
+func (ih *ImportHandler) HandleGetImport(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid import id"})
+		return
+	}
+
+	job, err := ih.importJobStore.GetImportJob(middleware.GetUser(r).ID, id)
+	if err != nil {
+		ih.logger.Printf("ERROR: GetImportJob: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if job == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "import not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"import": job})
+}
+
+// readImportFile finds the "file" field of a multipart form without buffering the rest of the form, anything else is
+// taken to be the file itself
+func readImportFile(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, errors.New("invalid multipart form")
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("file is required")
+		}
+		if err != nil {
+			return nil, errors.New("invalid multipart form")
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+func (ih *ImportHandler) previewImport(userID int, result *importer.Result) (*importPreview, error) {
+	existing, err := ih.existingStartTimes(userID, result.Workouts)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := ih.exerciseStore.ListExercises(userID, store.ExerciseFilter{})
+	if err != nil {
+		return nil, err
+	}
+	catalogNames := map[int]string{}
+	for _, exercise := range catalog {
+		catalogNames[exercise.ID] = exercise.Name
+	}
+
+	preview := &importPreview{
+		Format:      result.Format,
+		Workouts:    len(result.Workouts),
+		Exercises:   []importExercise{},
+		Preview:     make([]importPreviewWorkout, 0, len(result.Workouts)),
+		Warnings:    result.Warnings,
+		SkippedRows: result.Skipped,
+	}
+	if len(result.Workouts) > 0 {
+		preview.From = &result.Workouts[0].StartedAt
+		preview.To = &result.Workouts[len(result.Workouts)-1].StartedAt
+	}
+
+	exercises := map[string]*importExercise{}
+	for _, workout := range result.Workouts {
+		summary := importPreviewWorkout{
+			StartedAt:       workout.StartedAt,
+			Title:           workout.Title,
+			DurationMinutes: workout.DurationMinutes,
+			Exercises:       len(workout.Entries),
+			Duplicate:       existing[workout.StartedAt.Unix()],
+		}
+		if !summary.Duplicate {
+			preview.New++
+		}
+
+		seen := map[string]bool{}
+		for _, entry := range workout.Entries {
+			summary.Sets += len(entry.Sets)
+
+			exercise, ok := exercises[entry.ExerciseName]
+			if !ok {
+				exercise = &importExercise{Name: entry.ExerciseName, ExerciseID: entry.ExerciseID}
+				if entry.ExerciseID != nil {
+					exercise.ExerciseName = catalogNames[*entry.ExerciseID]
+				}
+				exercises[entry.ExerciseName] = exercise
+			}
+			if !seen[entry.ExerciseName] {
+				exercise.Workouts++
+				seen[entry.ExerciseName] = true
+			}
+		}
+
+		preview.Preview = append(preview.Preview, summary)
+	}
+
+	for _, exercise := range exercises {
+		preview.Exercises = append(preview.Exercises, *exercise)
+	}
+	sort.Slice(preview.Exercises, func(a, b int) bool {
+		return preview.Exercises[a].Name < preview.Exercises[b].Name
+	})
+
+	return preview, nil
+}
+
+// existingStartTimes is the unix seconds each of the user's workouts over the file's range started at. The apps only
+// write times to the second, so a workout starting at the same second as one already logged is taken to be the same
+// one and skipped, which is what makes importing a newer export of the same history safe
+func (ih *ImportHandler) existingStartTimes(userID int, workouts []store.Workout) (map[int64]bool, error) {
+	existing := map[int64]bool{}
+	if len(workouts) == 0 {
+		return existing, nil
+	}
+
+	times, err := ih.workoutStore.ListWorkoutStartTimes(userID, workouts[0].StartedAt, workouts[len(workouts)-1].StartedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, startedAt := range times {
+		existing[startedAt.Unix()] = true
+	}
+
+	return existing, nil
+}
+
+// runImport is the background half of POST /imports. There's no request to answer by now, so problems go to the
+// log and onto the job for the client to find
+func (ih *ImportHandler) runImport(job *store.ImportJob, workouts []store.Workout) {
+	startedAt := time.Now()
+	job.Status = store.ImportRunning
+	job.StartedAt = &startedAt
+	ih.saveImportJob(job)
+
+	defer func() {
+		// a panic here would take the whole server down rather than just the one request
+		if recovered := recover(); recovered != nil {
+			ih.logger.Printf("ERROR: runImport: panic: %v", recovered)
+			ih.finishImportJob(job, store.ImportFailed)
+		}
+	}()
+
+	err := ih.importWorkouts(job, workouts)
+	if err != nil {
+		ih.logger.Printf("ERROR: importWorkouts: %v", err)
+		ih.finishImportJob(job, store.ImportFailed)
+		return
+	}
+
+	ih.finishImportJob(job, store.ImportCompleted)
+}
+
+// importWorkouts creates the workouts a batch at a time, oldest first so personal records come out as they would
+// have if each workout had been logged on the day
+func (ih *ImportHandler) importWorkouts(job *store.ImportJob, workouts []store.Workout) error {
+	existing, err := ih.existingStartTimes(job.UserID, workouts)
+	if err != nil {
+		return err
+	}
+
+	// only loaded if something needs an estimate, none of the apps export calories
+	var estimator *calorieInputs
+
+	for start := 0; start < len(workouts); start += ImportBatchSize {
+		end := start + ImportBatchSize
+		if end > len(workouts) {
+			end = len(workouts)
+		}
+
+		batch := []*store.Workout{}
+		for i := start; i < end; i++ {
+			workout := &workouts[i]
+			workout.UserID = job.UserID
+
+			if existing[workout.StartedAt.Unix()] {
+				job.Skipped++
+				continue
+			}
+
+			err = validateWorkout(workout)
+			if err != nil {
+				importFailed(job, workout, err.Error())
+				continue
+			}
+
+			if !keepMeasuredCalories(workout) {
+				if estimator == nil {
+					estimator, err = loadCalorieInputs(ih.exerciseStore, ih.bodyWeightStore, job.UserID)
+					if err != nil {
+						return err
+					}
+				}
+				err = estimator.estimate(workout)
+				if err != nil {
+					return err
+				}
+			}
+
+			batch = append(batch, workout)
+		}
+
+		created := batch
+		err = ih.workoutStore.CreateWorkouts(batch)
+		if err != nil {
+			ih.logger.Printf("ERROR: CreateWorkouts, creating one at a time: %v", err)
+			created = []*store.Workout{}
+			for i, ok := range createWorkoutsEach(ih.workoutStore, ih.logger, batch) {
+				if !ok {
+					importFailed(job, batch[i], "failed to create workout")
+					continue
+				}
+				created = append(created, batch[i])
+			}
+		}
+
+		job.Created += len(created)
+
+		job.Processed = end
+		ih.saveImportJob(job)
+	}
+
+	return nil
+}
+
+func (ih *ImportHandler) finishImportJob(job *store.ImportJob, status string) {
+	finishedAt := time.Now()
+	job.Status = status
+	job.FinishedAt = &finishedAt
+	if status == store.ImportFailed {
+		job.Errors = append(job.Errors, "the import stopped early, workouts created before then have been kept")
+	}
+	ih.saveImportJob(job)
+}
+
+// saveImportJob only logs a failure, the import itself carries on regardless
+func (ih *ImportHandler) saveImportJob(job *store.ImportJob) {
+	err := ih.importJobStore.UpdateImportJob(job)
+	if err != nil {
+		ih.logger.Printf("ERROR: UpdateImportJob: %v", err)
+	}
+}
+
+// importFailed counts a workout that couldn't be created, the reasons are kept up to importer.MaxWarnings
+func importFailed(job *store.ImportJob, workout *store.Workout, reason string) {
+	job.Failed++
+	if len(job.Errors) < importer.MaxWarnings {
+		job.Errors = append(job.Errors, fmt.Sprintf("%s %q: %s", workout.StartedAt.Format("2006-01-02 15:04"), workout.Title, reason))
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/lesi97/internal/middleware"
+	"github.com/lesi97/internal/records"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/units"
+	"github.com/lesi97/internal/utils"
+)
+
+type PersonalRecordHandler struct {
+	personalRecordStore store.PersonalRecordStore
+	logger              *log.Logger
+}
+
+func NewPersonalRecordHandler(personalRecordStore store.PersonalRecordStore, logger *log.Logger) *PersonalRecordHandler {
+	return &PersonalRecordHandler{
+		personalRecordStore: personalRecordStore,
+		logger:              logger,
+	}
+}
+
+// HandleListPersonalRecords returns the user's current records, ?formula= picks the 1RM estimate (epley by default) and ?exercise_id= narrows it down
+func (ph *PersonalRecordHandler) HandleListPersonalRecords(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	formula, err := records.ParseFormula(query.Get("formula"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	exerciseID, err := utils.ReadIntQuery(query, "exercise_id", 0)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	personalRecords, err := ph.personalRecordStore.ListPersonalRecords(middleware.GetUser(r).ID, formula, exerciseID)
+	if err != nil {
+		ph.logger.Printf("ERROR: ListPersonalRecords: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	recordsToDisplay(personalRecords, unit)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"records": personalRecords})
+}
+
+// reportRecords is the records a write set, as the store handed them back with the workout, for the response in unit.
+// Only the 1RM for the formula asked for is shown
+func reportRecords(set []*store.PersonalRecord, formula records.Formula, unit units.Unit) []*store.PersonalRecord {
+	newRecords := []*store.PersonalRecord{}
+	for _, record := range set {
+		if record.Kind == records.EstimatedOneRepMax && record.Formula != formula {
+			continue
+		}
+		newRecords = append(newRecords, record)
+	}
+	recordsToDisplay(newRecords, unit)
+
+	return newRecords
+}
+
+// recordsToDisplay converts stored kg weights and values to unit, a most_reps value is a rep count so it's left alone
+func recordsToDisplay(personalRecords []*store.PersonalRecord, unit units.Unit) {
+	for _, record := range personalRecords {
+		if record.Weight != nil {
+			weight := units.FromCanonical(*record.Weight, unit)
+			record.Weight = &weight
+		}
+
+		if record.Kind != records.MostReps {
+			record.Value = units.FromCanonical(record.Value, unit)
+		}
+	}
+}
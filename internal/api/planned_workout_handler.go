@@ -0,0 +1,438 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lesi97/internal/calendar"
+	"github.com/lesi97/internal/middleware"
+	"github.com/lesi97/internal/rrule"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/utils"
+)
+
+const (
+	defaultCalendarDays = 28
+	maxCalendarDays     = 366 // a daily rule over a long range is a lot of occurrences to build
+)
+
+type PlannedWorkoutHandler struct {
+	plannedWorkoutStore store.PlannedWorkoutStore
+	workoutStore        store.WorkoutStore
+	templateStore       store.TemplateStore
+	logger              *log.Logger
+}
+
+type plannedWorkoutRequest struct {
+	TemplateID      *int   `json:"template_id"`
+	Title           string `json:"title"`
+	Notes           string `json:"notes"`
+	StartsAt        string `json:"starts_at"` // RFC3339, or 2025-01-06T07:00:00 for wall clock time in time_zone
+	TimeZone        string `json:"time_zone"`
+	DurationMinutes int    `json:"duration_minutes"`
+	RRule           string `json:"rrule"`
+}
+
+type recordOccurrenceRequest struct {
+	OccursAt  time.Time              `json:"occurs_at"`
+	Status    store.OccurrenceStatus `json:"status"`
+	WorkoutID *int                   `json:"workout_id"`
+	Note      string                 `json:"note"`
+}
+
+func NewPlannedWorkoutHandler(plannedWorkoutStore store.PlannedWorkoutStore, workoutStore store.WorkoutStore, templateStore store.TemplateStore, logger *log.Logger) *PlannedWorkoutHandler {
+	return &PlannedWorkoutHandler{
+		plannedWorkoutStore: plannedWorkoutStore,
+		workoutStore:        workoutStore,
+		templateStore:       templateStore,
+		logger:              logger,
+	}
+}
+
+func (ph *PlannedWorkoutHandler) HandleListPlannedWorkouts(w http.ResponseWriter, r *http.Request) {
+	plans, err := ph.plannedWorkoutStore.ListPlannedWorkouts(middleware.GetUser(r).ID)
+	if err != nil {
+		ph.logger.Printf("ERROR: ListPlannedWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"planned_workouts": plans})
+}
+
+func (ph *PlannedWorkoutHandler) HandleGetPlannedWorkoutById(w http.ResponseWriter, r *http.Request) {
+	planId, ok := ph.readOwnedPlanId(w, r)
+	if !ok {
+		return
+	}
+
+	plan, err := ph.plannedWorkoutStore.GetPlannedWorkoutById(planId)
+	if err != nil {
+		ph.logger.Printf("ERROR: GetPlannedWorkoutById: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"planned_workout": plan})
+}
+
+func (ph *PlannedWorkoutHandler) HandleCreatePlannedWorkout(w http.ResponseWriter, r *http.Request) {
+	var req plannedWorkoutRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ph.logger.Printf("ERROR: decodingCreatePlannedWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	plan, err := ph.planFromRequest(&req, currentUser)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	createdPlan, err := ph.plannedWorkoutStore.CreatePlannedWorkout(plan)
+	if err != nil {
+		ph.logger.Printf("ERROR: CreatePlannedWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create planned workout"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"planned_workout": createdPlan})
+}
+
+func (ph *PlannedWorkoutHandler) HandleUpdatePlannedWorkout(w http.ResponseWriter, r *http.Request) {
+	planId, ok := ph.readOwnedPlanId(w, r)
+	if !ok {
+		return
+	}
+
+	var req plannedWorkoutRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ph.logger.Printf("ERROR: decodingUpdatePlannedWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	plan, err := ph.planFromRequest(&req, middleware.GetUser(r))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	plan.ID = int(planId)
+
+	err = ph.plannedWorkoutStore.UpdatePlannedWorkout(plan, planId)
+	if err != nil {
+		ph.logger.Printf("ERROR: UpdatePlannedWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"planned_workout": plan})
+}
+
+func (ph *PlannedWorkoutHandler) HandleDeletePlannedWorkout(w http.ResponseWriter, r *http.Request) {
+	planId, ok := ph.readOwnedPlanId(w, r)
+	if !ok {
+		return
+	}
+
+	err := ph.plannedWorkoutStore.DeletePlannedWorkout(planId)
+	if err != nil {
+		ph.logger.Printf("ERROR: DeletePlannedWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to delete planned workout"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRecordOccurrence marks a single occurrence as completed (linked to a logged workout) or skipped
+func (ph *PlannedWorkoutHandler) HandleRecordOccurrence(w http.ResponseWriter, r *http.Request) {
+	planId, ok := ph.readOwnedPlanId(w, r)
+	if !ok {
+		return
+	}
+
+	var req recordOccurrenceRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ph.logger.Printf("ERROR: decodingRecordOccurrence: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	switch req.Status {
+	case store.OccurrenceCompleted:
+		if req.WorkoutID == nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "workout_id is required to complete an occurrence"})
+			return
+		}
+
+		workoutOwner, err := ph.workoutStore.GetWorkoutOwner(int64(*req.WorkoutID))
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && workoutOwner != currentUser.ID) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "workout does not exist"})
+			return
+		}
+		if err != nil {
+			ph.logger.Printf("ERROR: GetWorkoutOwner: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	case store.OccurrenceSkipped:
+		req.WorkoutID = nil
+	default:
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "status must be completed or skipped"})
+		return
+	}
+
+	plan, err := ph.plannedWorkoutStore.GetPlannedWorkoutById(planId)
+	if err != nil {
+		ph.logger.Printf("ERROR: GetPlannedWorkoutById: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	isOccurrence, err := calendar.IsOccurrence(plan, req.OccursAt)
+	if err != nil {
+		ph.logger.Printf("ERROR: IsOccurrence: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if !isOccurrence {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "occurs_at is not an occurrence of this planned workout"})
+		return
+	}
+
+	record := &store.OccurrenceRecord{
+		PlannedWorkoutID: plan.ID,
+		OccursAt:         req.OccursAt,
+		Status:           req.Status,
+		WorkoutID:        req.WorkoutID,
+		Note:             req.Note,
+	}
+
+	err = ph.plannedWorkoutStore.RecordOccurrence(record)
+	if err != nil {
+		ph.logger.Printf("ERROR: RecordOccurrence: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"occurrence": record})
+}
+
+// HandleDeleteOccurrence clears whatever was recorded, putting the occurrence back to planned (or missed)
+func (ph *PlannedWorkoutHandler) HandleDeleteOccurrence(w http.ResponseWriter, r *http.Request) {
+	planId, ok := ph.readOwnedPlanId(w, r)
+	if !ok {
+		return
+	}
+
+	occursAt, err := time.Parse(time.RFC3339, r.URL.Query().Get("occurs_at"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "occurs_at must be an RFC3339 timestamp"})
+		return
+	}
+
+	err = ph.plannedWorkoutStore.DeleteOccurrenceRecord(planId, occursAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "nothing recorded for that occurrence"})
+			return
+		}
+
+		ph.logger.Printf("ERROR: DeleteOccurrenceRecord: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetCalendar expands every plan the user has into occurrences between ?from= and ?to=, shown in ?tz=
+func (ph *PlannedWorkoutHandler) HandleGetCalendar(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	loc, err := readTimeZone(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	from, to, err := readCalendarRange(r, loc)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	plans, err := ph.plannedWorkoutStore.ListPlannedWorkouts(currentUser.ID)
+	if err != nil {
+		ph.logger.Printf("ERROR: ListPlannedWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	records, err := ph.plannedWorkoutStore.ListOccurrenceRecords(currentUser.ID, from, to)
+	if err != nil {
+		ph.logger.Printf("ERROR: ListOccurrenceRecords: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	occurrences, err := calendar.Expand(plans, records, from, to, loc, time.Now())
+	if err != nil {
+		ph.logger.Printf("ERROR: calendar.Expand: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"from":        from.In(loc),
+		"to":          to.In(loc),
+		"time_zone":   loc.String(),
+		"occurrences": occurrences,
+	})
+}
+
+// readCalendarRange defaults to the next four weeks starting today in loc
+func readCalendarRange(r *http.Request, loc *time.Location) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+
+	now := time.Now().In(loc)
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	fromParam, err := utils.ReadDateQueryIn(query, "from", false, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if fromParam != nil {
+		from = *fromParam
+	}
+
+	to := from.AddDate(0, 0, defaultCalendarDays)
+	toParam, err := utils.ReadDateQueryIn(query, "to", true, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if toParam != nil {
+		to = *toParam
+	}
+
+	if !to.After(from) {
+		return time.Time{}, time.Time{}, errors.New("to must be after from")
+	}
+
+	if to.Sub(from) > maxCalendarDays*24*time.Hour {
+		return time.Time{}, time.Time{}, errors.New("calendar range cannot be more than a year")
+	}
+
+	return from, to, nil
+}
+
+func (ph *PlannedWorkoutHandler) planFromRequest(req *plannedWorkoutRequest, currentUser *store.User) (*store.PlannedWorkout, error) {
+	if req.Title == "" {
+		return nil, errors.New("title is required")
+	}
+
+	if len(req.Title) > 255 {
+		return nil, errors.New("title cannot be greater than 255 characters")
+	}
+
+	if req.DurationMinutes <= 0 {
+		return nil, errors.New("duration_minutes must be greater than 0")
+	}
+
+	if req.TimeZone == "" {
+		req.TimeZone = userLocation(currentUser).String()
+	}
+
+	loc, err := time.LoadLocation(req.TimeZone)
+	if err != nil {
+		return nil, errors.New("time_zone must be an IANA time zone, e.g. Europe/London")
+	}
+
+	startsAt, err := parseLocalTime(req.StartsAt, loc)
+	if err != nil {
+		return nil, errors.New("starts_at must be an RFC3339 timestamp or a local date time like 2025-01-06T07:00:00")
+	}
+
+	if req.RRule != "" {
+		rule, err := rrule.Parse(req.RRule)
+		if err != nil {
+			return nil, err
+		}
+		req.RRule = rule.String()
+	}
+
+	if req.TemplateID != nil {
+		templateOwner, err := ph.templateStore.GetTemplateOwner(int64(*req.TemplateID))
+		if err != nil || templateOwner != currentUser.ID {
+			return nil, errors.New("template does not exist")
+		}
+	}
+
+	return &store.PlannedWorkout{
+		UserID:          currentUser.ID,
+		TemplateID:      req.TemplateID,
+		Title:           req.Title,
+		Notes:           req.Notes,
+		StartsAt:        startsAt,
+		TimeZone:        loc.String(),
+		DurationMinutes: req.DurationMinutes,
+		RRule:           req.RRule,
+	}, nil
+}
+
+// parseLocalTime takes an RFC3339 timestamp as is, anything without an offset is wall clock time in loc
+func parseLocalTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(loc), nil
+	}
+
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New("invalid time")
+}
+
+func (ph *PlannedWorkoutHandler) readOwnedPlanId(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	planId, err := utils.ReadIDParam(r)
+	if err != nil {
+		ph.logger.Printf("ERROR: ReadIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid planned workout id"})
+		return 0, false
+	}
+
+	planOwner, err := ph.plannedWorkoutStore.GetPlannedWorkoutOwner(planId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "planned workout does not exist"})
+			return 0, false
+		}
+
+		ph.logger.Printf("ERROR: GetPlannedWorkoutOwner: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return 0, false
+	}
+
+	if planOwner != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "unauthorized"})
+		return 0, false
+	}
+
+	return planId, true
+}
@@ -0,0 +1,489 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lesi97/internal/middleware"
+	"github.com/lesi97/internal/records"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/units"
+	"github.com/lesi97/internal/utils"
+)
+
+type TemplateHandler struct {
+	templateStore   store.TemplateStore
+	workoutStore    store.WorkoutStore
+	exerciseStore   store.ExerciseStore
+	bodyWeightStore store.BodyWeightStore
+	logger          *log.Logger
+}
+
+// startTemplateRequest lets the client tweak the workout before it's created, anything left nil comes from the template
+type startTemplateRequest struct {
+	Title           *string              `json:"title"`
+	Description     *string              `json:"description"`
+	DurationMinutes *int                 `json:"duration_minutes"`
+	CaloriesBurned  *int                 `json:"calories_burned"`
+	SessionRPE      *int                 `json:"session_rpe"`
+	StartedAt       *time.Time           `json:"started_at"`
+	EndedAt         *time.Time           `json:"ended_at"`
+	TimeZone        *string              `json:"time_zone"`
+	Entries         []store.WorkoutEntry `json:"entries"` // replaces the template's entries outright when present
+}
+
+type saveAsTemplateRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+func NewTemplateHandler(templateStore store.TemplateStore, workoutStore store.WorkoutStore, exerciseStore store.ExerciseStore, bodyWeightStore store.BodyWeightStore, logger *log.Logger) *TemplateHandler {
+	return &TemplateHandler{
+		templateStore:   templateStore,
+		workoutStore:    workoutStore,
+		exerciseStore:   exerciseStore,
+		bodyWeightStore: bodyWeightStore,
+		logger:          logger,
+	}
+}
+
+func (th *TemplateHandler) HandleListTemplates(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	templates, err := th.templateStore.ListTemplates(currentUser.ID)
+	if err != nil {
+		th.logger.Printf("ERROR: ListTemplates: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	for _, template := range templates {
+		templateEntriesToDisplay(template, unit)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"templates": templates})
+}
+
+func (th *TemplateHandler) HandleGetTemplateById(w http.ResponseWriter, r *http.Request) {
+	templateId, ok := th.readOwnedTemplateId(w, r)
+	if !ok {
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	template, err := th.templateStore.GetTemplateById(templateId)
+	if err != nil {
+		th.logger.Printf("ERROR: GetTemplateById: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	templateEntriesToDisplay(template, unit)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"template": template})
+}
+
+func (th *TemplateHandler) HandleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var template store.WorkoutTemplate
+
+	err := json.NewDecoder(r.Body).Decode(&template)
+	if err != nil {
+		th.logger.Printf("ERROR: decodingCreateTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	template.UserID = middleware.GetUser(r).ID
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	if !th.resolveTemplateExercises(w, &template) {
+		return
+	}
+
+	err = validateTemplate(&template)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = templateEntriesToCanonical(&template, unit)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	createdTemplate, err := th.templateStore.CreateTemplate(&template)
+	if err != nil {
+		th.logger.Printf("ERROR: CreateTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create template"})
+		return
+	}
+	templateEntriesToDisplay(createdTemplate, unit)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"template": createdTemplate})
+}
+
+func (th *TemplateHandler) HandleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	templateId, ok := th.readOwnedTemplateId(w, r)
+	if !ok {
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	var template store.WorkoutTemplate
+	err := json.NewDecoder(r.Body).Decode(&template)
+	if err != nil {
+		th.logger.Printf("ERROR: decodingUpdateTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	template.ID = int(templateId)
+	template.UserID = middleware.GetUser(r).ID
+
+	if !th.resolveTemplateExercises(w, &template) {
+		return
+	}
+
+	err = validateTemplate(&template)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = templateEntriesToCanonical(&template, unit)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = th.templateStore.UpdateTemplate(&template, templateId)
+	if err != nil {
+		th.logger.Printf("ERROR: UpdateTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	templateEntriesToDisplay(&template, unit)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"template": template})
+}
+
+func (th *TemplateHandler) HandleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	templateId, ok := th.readOwnedTemplateId(w, r)
+	if !ok {
+		return
+	}
+
+	err := th.templateStore.DeleteTemplate(templateId)
+	if err != nil {
+		th.logger.Printf("ERROR: DeleteTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to delete template"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleStartTemplate logs a new workout pre-filled from the template
+func (th *TemplateHandler) HandleStartTemplate(w http.ResponseWriter, r *http.Request) {
+	templateId, ok := th.readOwnedTemplateId(w, r)
+	if !ok {
+		return
+	}
+
+	formula, err := records.ParseFormula(r.URL.Query().Get("formula"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	var req startTemplateRequest
+	err = decodeOptionalBody(r, &req)
+	if err != nil {
+		th.logger.Printf("ERROR: decodingStartTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	template, err := th.templateStore.GetTemplateById(templateId)
+	if err != nil {
+		th.logger.Printf("ERROR: GetTemplateById: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	workout := template.ToWorkout()
+	workout.UserID = middleware.GetUser(r).ID
+	workout.TimeZone = userLocation(middleware.GetUser(r)).String()
+
+	if req.Title != nil {
+		workout.Title = *req.Title
+	}
+
+	if req.Description != nil {
+		workout.Description = *req.Description
+	}
+
+	if req.DurationMinutes != nil {
+		workout.DurationMinutes = *req.DurationMinutes
+	}
+
+	if req.CaloriesBurned != nil {
+		workout.CaloriesBurned = *req.CaloriesBurned
+	}
+
+	workout.SessionRPE = req.SessionRPE
+	workout.EndedAt = req.EndedAt
+
+	if req.StartedAt != nil {
+		workout.StartedAt = *req.StartedAt
+	}
+
+	if req.TimeZone != nil {
+		workout.TimeZone = *req.TimeZone
+	}
+
+	if req.Entries != nil {
+		workout.Entries = req.Entries
+		for i := range workout.Entries {
+			workout.Entries[i].ID = 0
+		}
+
+		// the template's own entries are already in kg, only ones sent with the request need converting
+		err = entriesToCanonical(workout.Entries, unit)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+
+	if !resolveExercises(w, th.exerciseStore, th.logger, workout.UserID, workout.Entries) {
+		return
+	}
+
+	err = validateWorkout(workout)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = fillCalories(th.exerciseStore, th.bodyWeightStore, workout.UserID, workout)
+	if err != nil {
+		th.logger.Printf("ERROR: fillCalories: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	createdWorkout, err := th.workoutStore.CreateWorkout(workout)
+	if err != nil {
+		th.logger.Printf("ERROR: CreatingWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create workout"})
+		return
+	}
+
+	newRecords := reportRecords(createdWorkout.NewRecords, formula, unit)
+	entriesToDisplay(createdWorkout.Entries, unit)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout, "new_records": newRecords})
+}
+
+// HandleSaveWorkoutAsTemplate copies a logged workout into a new template, lives here rather than on WorkoutHandler as it's a template being created
+func (th *TemplateHandler) HandleSaveWorkoutAsTemplate(w http.ResponseWriter, r *http.Request) {
+	workoutId, err := utils.ReadIDParam(r)
+	if err != nil {
+		th.logger.Printf("ERROR: ReadIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	workoutOwner, err := th.workoutStore.GetWorkoutOwner(workoutId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout does not exist"})
+			return
+		}
+
+		th.logger.Printf("ERROR: GetWorkoutOwner: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if workoutOwner != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	var req saveAsTemplateRequest
+	err = decodeOptionalBody(r, &req)
+	if err != nil {
+		th.logger.Printf("ERROR: decodingSaveAsTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	workout, err := th.workoutStore.GetWorkoutById(workoutId)
+	if err != nil {
+		th.logger.Printf("ERROR: GetWorkoutById: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	template := store.NewTemplateFromWorkout(workout)
+	template.UserID = currentUser.ID
+
+	if req.Name != nil {
+		template.Name = *req.Name
+	}
+
+	if req.Description != nil {
+		template.Description = *req.Description
+	}
+
+	err = validateTemplate(template)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	createdTemplate, err := th.templateStore.CreateTemplate(template)
+	if err != nil {
+		th.logger.Printf("ERROR: CreateTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create template"})
+		return
+	}
+	templateEntriesToDisplay(createdTemplate, unit)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"template": createdTemplate})
+}
+
+func (th *TemplateHandler) readOwnedTemplateId(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	templateId, err := utils.ReadIDParam(r)
+	if err != nil {
+		th.logger.Printf("ERROR: ReadIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid template id"})
+		return 0, false
+	}
+
+	templateOwner, err := th.templateStore.GetTemplateOwner(templateId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "template does not exist"})
+			return 0, false
+		}
+
+		th.logger.Printf("ERROR: GetTemplateOwner: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return 0, false
+	}
+
+	if templateOwner != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "unauthorized"})
+		return 0, false
+	}
+
+	return templateId, true
+}
+
+// resolveTemplateExercises runs the template's entries through the same catalog matching as workout entries
+func (th *TemplateHandler) resolveTemplateExercises(w http.ResponseWriter, template *store.WorkoutTemplate) bool {
+	entries := template.ToWorkout().Entries
+	if !resolveExercises(w, th.exerciseStore, th.logger, template.UserID, entries) {
+		return false
+	}
+
+	for i := range template.Entries {
+		template.Entries[i].ExerciseID = entries[i].ExerciseID
+		template.Entries[i].ExerciseName = entries[i].ExerciseName
+	}
+
+	return true
+}
+
+func templateEntriesToCanonical(template *store.WorkoutTemplate, fallback units.Unit) error {
+	for i := range template.Entries {
+		err := weightToCanonical(template.Entries[i].Weight, &template.Entries[i].WeightUnit, fallback)
+		if err != nil {
+			return fmt.Errorf("entries[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func templateEntriesToDisplay(template *store.WorkoutTemplate, unit units.Unit) {
+	for i := range template.Entries {
+		weightToDisplay(template.Entries[i].Weight, &template.Entries[i].WeightUnit, unit)
+	}
+}
+
+func validateTemplate(template *store.WorkoutTemplate) error {
+	if template.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(template.Name) > 255 {
+		return errors.New("name cannot be greater than 255 characters")
+	}
+
+	if template.DurationMinutes < 0 {
+		return errors.New("duration_minutes cannot be negative")
+	}
+
+	// template entries follow the same rules as workout entries, they'll become one eventually
+	orderIndexes := map[int]bool{}
+	for i, entry := range template.ToWorkout().Entries {
+		err := validateWorkoutEntry(&entry)
+		if err != nil {
+			return fmt.Errorf("entries[%d]: %w", i, err)
+		}
+
+		if orderIndexes[entry.OrderIndex] {
+			return fmt.Errorf("entries[%d]: order_index %d is used more than once", i, entry.OrderIndex)
+		}
+		orderIndexes[entry.OrderIndex] = true
+	}
+
+	return nil
+}
+
+// decodeOptionalBody is json.NewDecoder().Decode but an empty body is fine and leaves dst alone
+func decodeOptionalBody(r *http.Request, dst interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(dst)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
@@ -6,8 +6,11 @@ import (
 	"log"
 	"net/http"
 	"regexp"
+	"time"
 
+	"github.com/lesi97/internal/middleware"
 	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/units"
 	"github.com/lesi97/internal/utils"
 )
 
@@ -16,6 +19,16 @@ type registerUserRequest struct {
 	Email 		string `json:"email"`
 	Password 	string `json:"password"`
 	Bio 		string `json:"bio"`
+	PreferredUnit string `json:"preferred_unit"`
+	TimeZone 	string `json:"time_zone"`
+}
+
+// updatePreferencesRequest leaves anything that's nil as it is, a heart rate of 0 clears it
+type updatePreferencesRequest struct {
+	PreferredUnit *string `json:"preferred_unit"`
+	TimeZone 	*string `json:"time_zone"`
+	MaxHeartRate *int `json:"max_heart_rate"`
+	RestingHeartRate *int `json:"resting_heart_rate"`
 }
 
 type UserHandler struct {
@@ -52,6 +65,16 @@ func (h *UserHandler) validateRegisterRequest(req *registerUserRequest) error {
 		return errors.New("password is required")
 	}
 
+	if _, err := units.Parse(req.PreferredUnit); err != nil {
+		return errors.New("preferred_unit must be kg or lb")
+	}
+
+	if req.TimeZone != "" {
+		if _, err := time.LoadLocation(req.TimeZone); err != nil {
+			return errors.New("time_zone must be an IANA time zone, e.g. Europe/London")
+		}
+	}
+
 	return nil
 }
 
@@ -73,6 +96,8 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 	user := &store.User{
 		Username: req.Username,
 		Email: req.Email,
+		PreferredUnit: req.PreferredUnit, // the store defaults it to kg when it's left off
+		TimeZone: req.TimeZone, // and this to UTC
 	}
 
 	if req.Bio != "" {
@@ -95,4 +120,90 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"user": user})
 
+}
+
+// HandleUpdatePreferences sets the unit weights are shown in when a request doesn't pass ?units=, the time zone
+// new workouts default to and days are cut in when a request doesn't pass ?tz=, and the max and resting heart rates
+// heart rate zones are worked out from
+func (h *UserHandler) HandleUpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	var req updatePreferencesRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.logger.Printf("ERROR: decoding preferences request: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	if req.PreferredUnit == nil && req.TimeZone == nil && req.MaxHeartRate == nil && req.RestingHeartRate == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "preferred_unit, time_zone, max_heart_rate or resting_heart_rate is required"})
+		return
+	}
+
+	user := middleware.GetUser(r)
+	updated := *user
+
+	if req.PreferredUnit != nil {
+		unit, err := units.Parse(*req.PreferredUnit)
+		if err != nil || unit == "" {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "preferred_unit must be kg or lb"})
+			return
+		}
+		updated.PreferredUnit = string(unit)
+	}
+
+	if req.TimeZone != nil {
+		loc, err := time.LoadLocation(*req.TimeZone)
+		if err != nil || *req.TimeZone == "" {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "time_zone must be an IANA time zone, e.g. Europe/London"})
+			return
+		}
+		updated.TimeZone = loc.String()
+	}
+
+	if req.MaxHeartRate != nil {
+		updated.MaxHeartRate = req.MaxHeartRate
+		if *req.MaxHeartRate == 0 {
+			updated.MaxHeartRate = nil
+		}
+	}
+
+	if req.RestingHeartRate != nil {
+		updated.RestingHeartRate = req.RestingHeartRate
+		if *req.RestingHeartRate == 0 {
+			updated.RestingHeartRate = nil
+		}
+	}
+
+	err = validateHeartRates(updated.MaxHeartRate, updated.RestingHeartRate)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = h.userStore.UpdatePreferences(&updated)
+	if err != nil {
+		h.logger.Printf("ERROR: updating preferences: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	*user = updated
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// validateHeartRates checks against the valid_user_heart_rate constraint
+func validateHeartRates(maxHeartRate *int, restingHeartRate *int) error {
+	if maxHeartRate != nil && (*maxHeartRate < 100 || *maxHeartRate > 250) {
+		return errors.New("max_heart_rate must be between 100 and 250")
+	}
+
+	if restingHeartRate != nil && (*restingHeartRate < 20 || *restingHeartRate > 150) {
+		return errors.New("resting_heart_rate must be between 20 and 150")
+	}
+
+	if maxHeartRate != nil && restingHeartRate != nil && *restingHeartRate >= *maxHeartRate {
+		return errors.New("resting_heart_rate must be lower than max_heart_rate")
+	}
+
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/lesi97/internal/middleware"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/utils"
+)
+
+// MaxBulkWorkouts caps a single POST /workouts/bulk, bigger histories are sent in several requests
+const MaxBulkWorkouts = 1000
+
+// how a bulk create handles a workout that can't be created
+const (
+	BulkAtomic     = "atomic"      // nothing is created unless everything can be
+	BulkBestEffort = "best_effort" // everything that can be created is, the rest are reported back
+)
+
+// status of a single workout in a bulk create
+const (
+	BulkCreated = "created"
+	BulkFailed  = "failed"
+	BulkSkipped = "skipped" // valid, but not created as another workout in an atomic request failed
+)
+
+type bulkWorkoutRequest struct {
+	Mode     string          `json:"mode"` // BulkAtomic when left off
+	Workouts []store.Workout `json:"workouts"`
+}
+
+// bulkWorkoutResult is one per workout in the request, in the same order
+type bulkWorkoutResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	ID     int    `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HandleBulkCreateWorkouts is POST /workouts/bulk, for creating a whole history at once. Every workout goes through
+// the same checks as a single create, then the ones that pass are written together by CreateWorkouts.
+// Only ids come back, GET /workouts for the rest
+func (wh *WorkoutHandler) HandleBulkCreateWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	var req bulkWorkoutRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.logger.Printf("ERROR: decodingBulkCreateWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = BulkAtomic
+	}
+	if req.Mode != BulkAtomic && req.Mode != BulkBestEffort {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("mode must be %s or %s", BulkAtomic, BulkBestEffort)})
+		return
+	}
+
+	if len(req.Workouts) == 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "workouts is required"})
+		return
+	}
+	if len(req.Workouts) > MaxBulkWorkouts {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("cannot create more than %d workouts at once", MaxBulkWorkouts)})
+		return
+	}
+
+	// only loaded if something needs an estimate, then shared by every workout that does
+	var estimator *calorieInputs
+
+	results := make([]bulkWorkoutResult, len(req.Workouts))
+	valid := []*store.Workout{}
+	validIndexes := []int{}
+
+	for i := range req.Workouts {
+		workout := &req.Workouts[i]
+		results[i] = bulkWorkoutResult{Index: i}
+
+		workout.ID = 0
+		workout.UserID = currentUser.ID
+		if workout.TimeZone == "" {
+			workout.TimeZone = userLocation(currentUser).String()
+		}
+
+		err = wh.exerciseStore.ResolveEntries(currentUser.ID, workout.Entries)
+		if err != nil && !errors.Is(err, store.ErrExerciseNotFound) {
+			wh.logger.Printf("ERROR: ResolveEntries: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		if err == nil {
+			err = validateWorkout(workout)
+		}
+		if err == nil {
+			err = entriesToCanonical(workout.Entries, unit)
+		}
+		if err != nil {
+			results[i].Status = BulkFailed
+			results[i].Error = err.Error()
+			continue
+		}
+
+		if !keepMeasuredCalories(workout) {
+			if estimator == nil {
+				estimator, err = loadCalorieInputs(wh.exerciseStore, wh.bodyWeightStore, currentUser.ID)
+				if err != nil {
+					wh.logger.Printf("ERROR: loadCalorieInputs: %v", err)
+					utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+					return
+				}
+			}
+			err = estimator.estimate(workout)
+			if err != nil {
+				wh.logger.Printf("ERROR: estimate: %v", err)
+				utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+				return
+			}
+		}
+
+		valid = append(valid, workout)
+		validIndexes = append(validIndexes, i)
+	}
+
+	if req.Mode == BulkAtomic && len(valid) < len(req.Workouts) {
+		for _, i := range validIndexes {
+			results[i].Status = BulkSkipped
+		}
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "no workouts were created", "created": 0, "results": results})
+		return
+	}
+
+	err = wh.workoutStore.CreateWorkouts(valid)
+	if err != nil && req.Mode == BulkAtomic {
+		wh.logger.Printf("ERROR: CreateWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create workouts"})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: CreateWorkouts, creating one at a time: %v", err)
+		for j, ok := range createWorkoutsEach(wh.workoutStore, wh.logger, valid) {
+			if !ok {
+				results[validIndexes[j]].Status = BulkFailed
+				results[validIndexes[j]].Error = "failed to create workout"
+			}
+		}
+	}
+
+	created := []*store.Workout{}
+	for j, workout := range valid {
+		if results[validIndexes[j]].Status == BulkFailed {
+			continue
+		}
+		results[validIndexes[j]].Status = BulkCreated
+		results[validIndexes[j]].ID = workout.ID
+		created = append(created, workout)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"created": len(created), "results": results})
+}
+
+// createWorkoutsEach is the fallback for a failed CreateWorkouts, one bad row fails the whole batch so this creates
+// them one at a time to find out which. created[i] says whether workouts[i] made it, the ones that did are updated in place
+func createWorkoutsEach(workoutStore store.WorkoutStore, logger *log.Logger, workouts []*store.Workout) []bool {
+	created := make([]bool, len(workouts))
+
+	for i, workout := range workouts {
+		createdWorkout, err := workoutStore.CreateWorkout(workout)
+		if err != nil {
+			logger.Printf("ERROR: CreatingWorkout: %v", err)
+			continue
+		}
+		*workout = *createdWorkout
+		created[i] = true
+	}
+
+	return created
+}
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/lesi97/internal/middleware"
+	"github.com/lesi97/internal/patch"
+	"github.com/lesi97/internal/records"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/utils"
+)
+
+type reorderEntriesRequest struct {
+	EntryIDs []int64 `json:"entry_ids"`
+}
+
+func (wh *WorkoutHandler) HandleListWorkoutEntries(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := wh.readOwnedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := wh.workoutStore.ListWorkoutEntries(workoutId)
+	if err != nil {
+		wh.logger.Printf("ERROR: ListWorkoutEntries: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	entriesToDisplay(entries, unit)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"entries": entries})
+}
+
+func (wh *WorkoutHandler) HandleGetWorkoutEntry(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := wh.readOwnedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	entryId, err := utils.ReadNamedIDParam(r, "entryId")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid entry id"})
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	entry, err := wh.workoutStore.GetWorkoutEntry(workoutId, entryId)
+	if err != nil {
+		wh.writeEntryError(w, err)
+		return
+	}
+	entryToDisplay(entry, unit)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"entry": entry})
+}
+
+func (wh *WorkoutHandler) HandleCreateWorkoutEntry(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := wh.readOwnedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	formula, err := records.ParseFormula(r.URL.Query().Get("formula"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	var entry store.WorkoutEntry
+	err = json.NewDecoder(r.Body).Decode(&entry)
+	if err != nil {
+		wh.logger.Printf("ERROR: decodingCreateWorkoutEntry: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+	entry.ID = 0 // always a new entry, an ID in the body would otherwise be ignored anyway
+
+	entries := []store.WorkoutEntry{entry}
+	if !resolveExercises(w, wh.exerciseStore, wh.logger, middleware.GetUser(r).ID, entries) {
+		return
+	}
+	entry = entries[0]
+
+	err = validateWorkoutEntry(&entry)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = entryToCanonical(&entry, unit)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	saved, err := wh.workoutStore.CreateWorkoutEntry(workoutId, &entry)
+	if err != nil {
+		wh.writeEntryError(w, err)
+		return
+	}
+
+	newRecords := reportRecords(saved, formula, unit)
+	entryToDisplay(&entry, unit)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"entry": entry, "new_records": newRecords})
+}
+
+func (wh *WorkoutHandler) HandlePatchWorkoutEntry(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := wh.readOwnedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	entryId, err := utils.ReadNamedIDParam(r, "entryId")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid entry id"})
+		return
+	}
+
+	applyPatch, err := patchFuncForRequest(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnsupportedMediaType, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	formula, err := records.ParseFormula(r.URL.Query().Get("formula"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	patchDoc, err := io.ReadAll(r.Body)
+	if err != nil {
+		wh.logger.Printf("ERROR: reading patch body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	var applyErr error
+	entry, saved, err := wh.workoutStore.PatchWorkoutEntry(workoutId, entryId, func(existing *store.WorkoutEntry) error {
+		stored := storedEntry(*existing)
+		entryToDisplay(existing, unit)
+		shown := *existing
+
+		applyErr = applyEntryPatch(existing, patchDoc, applyPatch)
+		if applyErr != nil {
+			return applyErr
+		}
+
+		applyErr = patchedEntryToCanonical(existing, &shown, &stored, unit)
+		if applyErr != nil {
+			return applyErr
+		}
+
+		entries := []store.WorkoutEntry{*existing}
+		err := wh.exerciseStore.ResolveEntries(middleware.GetUser(r).ID, entries)
+		if errors.Is(err, store.ErrExerciseNotFound) {
+			applyErr = err
+		}
+		*existing = entries[0]
+		return err
+	})
+	if applyErr != nil {
+		switch {
+		case errors.Is(applyErr, patch.ErrTestFailed):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": applyErr.Error()})
+		default:
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": applyErr.Error()})
+		}
+		return
+	}
+	if err != nil {
+		wh.writeEntryError(w, err)
+		return
+	}
+
+	newRecords := reportRecords(saved, formula, unit)
+	entryToDisplay(entry, unit)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"entry": entry, "new_records": newRecords})
+}
+
+func applyEntryPatch(existing *store.WorkoutEntry, patchDoc []byte, applyPatch patchFunc) error {
+	original, err := json.Marshal(existing)
+	if err != nil {
+		return err
+	}
+
+	patched, err := applyPatch(original, patchDoc)
+	if err != nil {
+		return err
+	}
+
+	var entry store.WorkoutEntry
+	err = json.Unmarshal(patched, &entry)
+	if err != nil {
+		return fmt.Errorf("patched entry is invalid: %v", err)
+	}
+	entry.ID = existing.ID
+	clearStaleExerciseID(existing, &entry)
+
+	err = validateWorkoutEntry(&entry)
+	if err != nil {
+		return err
+	}
+
+	*existing = entry
+	return nil
+}
+
+// clearStaleExerciseID drops the catalog link when a patch renames the exercise without touching exercise_id, so the new name gets matched
+func clearStaleExerciseID(before *store.WorkoutEntry, after *store.WorkoutEntry) {
+	if after.ExerciseName == before.ExerciseName || after.ExerciseID == nil || before.ExerciseID == nil {
+		return
+	}
+
+	if *after.ExerciseID == *before.ExerciseID {
+		after.ExerciseID = nil
+	}
+}
+
+func (wh *WorkoutHandler) HandleDeleteWorkoutEntry(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := wh.readOwnedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	entryId, err := utils.ReadNamedIDParam(r, "entryId")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid entry id"})
+		return
+	}
+
+	err = wh.workoutStore.DeleteWorkoutEntry(workoutId, entryId)
+	if err != nil {
+		wh.writeEntryError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (wh *WorkoutHandler) HandleReorderWorkoutEntries(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := wh.readOwnedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	var req reorderEntriesRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.logger.Printf("ERROR: decodingReorderEntries: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	entries, err := wh.workoutStore.ReorderWorkoutEntries(workoutId, req.EntryIDs)
+	if err != nil {
+		wh.writeEntryError(w, err)
+		return
+	}
+	entriesToDisplay(entries, unit)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"entries": entries})
+}
+
+// readOwnedWorkoutId reads {id} and checks it belongs to the current user, writing the error response if not
+func (wh *WorkoutHandler) readOwnedWorkoutId(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	workoutId, err := utils.ReadIDParam(r)
+	if err != nil {
+		wh.logger.Printf("ERROR: ReadIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+		return 0, false
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil || currentUser.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return 0, false
+	}
+
+	if !wh.requireWorkoutOwner(w, workoutId, currentUser) {
+		return 0, false
+	}
+
+	return workoutId, true
+}
+
+func (wh *WorkoutHandler) writeEntryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, store.ErrEntryNotFound):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "entry does not exist"})
+	case errors.Is(err, store.ErrOrderIndexTaken):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+	case errors.Is(err, store.ErrInvalidReorder), errors.Is(err, store.ErrGroupNotFound), errors.Is(err, store.ErrGroupTooSmall):
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	default:
+		wh.logger.Printf("ERROR: workout entry: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+}
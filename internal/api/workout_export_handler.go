@@ -0,0 +1,287 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lesi97/internal/middleware"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/units"
+	"github.com/lesi97/internal/utils"
+	"github.com/lesi97/internal/xlsx"
+)
+
+// exportColumns are the headers of every export, only ever add to the end so spreadsheets built on them keep working
+var exportColumns = []interface{}{
+	"workout_id",
+	"date",
+	"started_at",
+	"ended_at",
+	"time_zone",
+	"title",
+	"duration_minutes",
+	"calories_burned",
+	"calories_source",
+	"session_rpe",
+	"exercise",
+	"order_index",
+	"group_type",
+	"sets",
+	"set_number",
+	"reps",
+	"duration_seconds",
+	"weight",
+	"weight_unit",
+	"rpe",
+	"rir",
+	"rest_seconds",
+	"warmup",
+	"drop_set",
+	"failure",
+	"notes",
+	"distance",
+	"distance_unit",
+	"pace_seconds_per_km",
+	"avg_heart_rate",
+	"max_heart_rate",
+	"cadence",
+	"power",
+	"elevation_gain_meters",
+}
+
+// exportWriter is a CSV or XLSX file being written a row at a time
+type exportWriter interface {
+	WriteRow(cells []interface{}) error
+	Close() error
+}
+
+// HandleExportWorkouts streams the user's history as ?format=csv (the default) or xlsx, ?from= and ?to= work as they
+// do for GET /workouts. Rows are written as they come off the database, so once the first one is out an error can
+// only cut the file short rather than turn into an error response
+func (wh *WorkoutHandler) HandleExportWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "xlsx" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "format must be csv or xlsx"})
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	loc, err := readTimeZone(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	filter := store.WorkoutFilter{UserID: currentUser.ID}
+
+	filter.From, err = utils.ReadDateQueryIn(query, "from", false, loc)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	filter.To, err = utils.ReadDateQueryIn(query, "to", true, loc)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	// nothing is sent until there's a row (or the query has finished with none) so a query that fails straight away still gets a 500
+	var out exportWriter
+	start := func() error {
+		filename := "workouts-" + time.Now().In(loc).Format("2006-01-02") + "." + format
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+		if format == "xlsx" {
+			w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+			sheet, err := xlsx.NewWriter(w, "Workouts")
+			if err != nil {
+				return err
+			}
+			out = sheet
+		} else {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			out = &csvExportWriter{csv: csv.NewWriter(w)}
+		}
+
+		return out.WriteRow(exportColumns)
+	}
+
+	// most histories only have a zone or two, no need to load them again for every row
+	locations := map[string]*time.Location{}
+
+	err = wh.workoutStore.ExportWorkouts(filter, func(row *store.ExportRow) error {
+		if out == nil {
+			err := start()
+			if err != nil {
+				return err
+			}
+		}
+
+		workoutLoc, ok := locations[row.TimeZone]
+		if !ok {
+			loaded, err := time.LoadLocation(row.TimeZone)
+			if err != nil {
+				loaded = time.UTC
+			}
+			workoutLoc = loaded
+			locations[row.TimeZone] = loaded
+		}
+
+		return out.WriteRow(exportCells(row, unit, workoutLoc))
+	})
+	if err != nil && out == nil {
+		wh.logger.Printf("ERROR: ExportWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: ExportWorkouts, export cut short: %v", err)
+		return
+	}
+
+	if out == nil {
+		err = start()
+		if err != nil {
+			wh.logger.Printf("ERROR: starting export: %v", err)
+			return
+		}
+	}
+
+	err = out.Close()
+	if err != nil {
+		wh.logger.Printf("ERROR: finishing export: %v", err)
+	}
+}
+
+// exportCells lines a row up with exportColumns, times are written in loc, the time zone the workout was done in
+func exportCells(row *store.ExportRow, unit units.Unit, loc *time.Location) []interface{} {
+	var endedAt interface{}
+	if row.EndedAt != nil {
+		endedAt = row.EndedAt.In(loc).Format(time.RFC3339)
+	}
+
+	var weight, weightUnit interface{}
+	if row.Weight != nil {
+		weight = units.FromCanonical(*row.Weight, unit)
+		weightUnit = string(unit)
+	}
+
+	// distances go out in the unit the entry was logged in, as they do everywhere else
+	var distance, distanceUnit interface{}
+	if row.Distance != nil && row.DistanceUnit != nil {
+		distance = units.DistanceFromCanonical(*row.Distance, units.DistanceUnit(*row.DistanceUnit))
+		distanceUnit = *row.DistanceUnit
+	}
+
+	return []interface{}{
+		row.WorkoutID,
+		row.StartedAt.In(loc).Format("2006-01-02"),
+		row.StartedAt.In(loc).Format(time.RFC3339),
+		endedAt,
+		row.TimeZone,
+		row.Title,
+		row.DurationMinutes,
+		row.CaloriesBurned,
+		row.CaloriesSource,
+		intCell(row.SessionRPE),
+		stringCell(row.ExerciseName),
+		intCell(row.OrderIndex),
+		stringCell(row.GroupType),
+		intCell(row.SetCount),
+		intCell(row.SetNumber),
+		intCell(row.Reps),
+		intCell(row.DurationSeconds),
+		weight,
+		weightUnit,
+		floatCell(row.RPE),
+		intCell(row.RIR),
+		intCell(row.RestSeconds),
+		boolCell(row.IsWarmup),
+		boolCell(row.IsDropSet),
+		boolCell(row.IsFailure),
+		stringCell(row.Notes),
+		distance,
+		distanceUnit,
+		floatCell(row.PaceSecondsPerKm),
+		intCell(row.AvgHeartRate),
+		intCell(row.MaxHeartRate),
+		intCell(row.Cadence),
+		intCell(row.Power),
+		floatCell(row.ElevationGainMeters),
+	}
+}
+
+// the cell helpers turn nil pointers into empty cells rather than typed nils, which the writers would print
+
+func intCell(value *int) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func floatCell(value *float64) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func boolCell(value *bool) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func stringCell(value *string) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+type csvExportWriter struct {
+	csv *csv.Writer
+}
+
+// WriteRow guards text that a spreadsheet would read as a formula with a leading ', the usual CSV injection fix
+func (c *csvExportWriter) WriteRow(cells []interface{}) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		switch value := cell.(type) {
+		case nil:
+			record[i] = ""
+		case string:
+			if value != "" && (value[0] == '=' || value[0] == '+' || value[0] == '-' || value[0] == '@' || value[0] == '\t' || value[0] == '\r') {
+				value = "'" + value
+			}
+			record[i] = value
+		case float64:
+			record[i] = strconv.FormatFloat(value, 'f', -1, 64)
+		default:
+			record[i] = fmt.Sprint(value)
+		}
+	}
+
+	return c.csv.Write(record)
+}
+
+func (c *csvExportWriter) Close() error {
+	c.csv.Flush()
+	return c.csv.Error()
+}
@@ -4,22 +4,38 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/lesi97/internal/calories"
 	"github.com/lesi97/internal/middleware"
+	"github.com/lesi97/internal/patch"
+	"github.com/lesi97/internal/records"
 	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/units"
 	"github.com/lesi97/internal/utils"
 )
 
 type WorkoutHandler struct {
 	workoutStore store.WorkoutStore
+	exerciseStore store.ExerciseStore
+	bodyWeightStore store.BodyWeightStore
 	logger *log.Logger
 }
 
-func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *log.Logger) *WorkoutHandler {
+func NewWorkoutHandler(workoutStore store.WorkoutStore, exerciseStore store.ExerciseStore, bodyWeightStore store.BodyWeightStore, logger *log.Logger) *WorkoutHandler {
 	return &WorkoutHandler{
 		workoutStore: workoutStore,
+		exerciseStore: exerciseStore,
+		bodyWeightStore: bodyWeightStore,
 		logger: logger,
 	}
 }
@@ -32,6 +48,11 @@ func (wh *WorkoutHandler) HandleGetWorkoutById(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
 	workout, err := wh.workoutStore.GetWorkoutById(workoutId)
 	if err != nil {
 		wh.logger.Printf("ERROR: GetWorkoutById: %v", err)
@@ -39,13 +60,35 @@ func (wh *WorkoutHandler) HandleGetWorkoutById(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if workout == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout does not exist"})
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(workout, unit))
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		tags, anyVersion := parseETags(ifNoneMatch)
+		if anyVersion || matchesTag(tags, workout.Version, unit) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	entriesToDisplay(workout.Entries, unit)
+
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
 }
 
 func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Request) {
+	formula, err := records.ParseFormula(r.URL.Query().Get("formula"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
 	var workout store.Workout
 
-	err := json.NewDecoder(r.Body).Decode(&workout) // Use NewDecoder when accepting JSON from HTTP, Unmarshal for internal JSON
+	err = json.NewDecoder(r.Body).Decode(&workout) // Use NewDecoder when accepting JSON from HTTP, Unmarshal for internal JSON
 	if err != nil {
 		wh.logger.Printf("ERROR: decodingCreateWorkout: %v", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
@@ -58,6 +101,37 @@ func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 	workout.UserID = currentUser.ID
+	if workout.TimeZone == "" {
+		workout.TimeZone = userLocation(currentUser).String()
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	if !resolveExercises(w, wh.exerciseStore, wh.logger, currentUser.ID, workout.Entries) {
+		return
+	}
+
+	err = validateWorkout(&workout)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = entriesToCanonical(workout.Entries, unit)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = fillCalories(wh.exerciseStore, wh.bodyWeightStore, currentUser.ID, &workout)
+	if err != nil {
+		wh.logger.Printf("ERROR: fillCalories: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
 
 	createdWorkout, err := wh.workoutStore.CreateWorkout(&workout)
 	if err != nil {
@@ -66,7 +140,10 @@ func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": createdWorkout})
+	newRecords := reportRecords(createdWorkout.NewRecords, formula, unit)
+	entriesToDisplay(createdWorkout.Entries, unit)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": createdWorkout, "new_records": newRecords})
 }
 
 func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Request) {
@@ -77,81 +154,94 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	existingWorkout, err := wh.workoutStore.GetWorkoutById(workoutId)
-	if err != nil {
-		wh.logger.Printf("ERROR: GetWorkoutById: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to get workout"})
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil || currentUser.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
 		return
 	}
 
-	if existingWorkout == nil {
-		wh.logger.Printf("ERROR: GetWorkoutById: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "workout does not exist"})
+	if !wh.requireWorkoutOwner(w, workoutId, currentUser) {
 		return
 	}
 
-	var updateWorkoutRequest store.UpdateWorkout
+	versions, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
 
-	err = json.NewDecoder(r.Body).Decode(&updateWorkoutRequest)
+	formula, err := records.ParseFormula(r.URL.Query().Get("formula"))
 	if err != nil {
-		wh.logger.Printf("ERROR: decodingUpdateWorkout: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
 		return
 	}
 
-	if updateWorkoutRequest.Title != nil {
-		existingWorkout.Title = *updateWorkoutRequest.Title // Assign the value of the pointer to the existing workout, otherwise leave as is
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
 	}
 
-	if updateWorkoutRequest.Description != nil {
-		existingWorkout.Description = *updateWorkoutRequest.Description
+	// PUT replaces the whole workout, anything left out of the body (entries included) is gone afterwards, use PATCH for partial updates
+	var workout store.Workout
+	err = json.NewDecoder(r.Body).Decode(&workout)
+	if err != nil {
+		wh.logger.Printf("ERROR: decodingUpdateWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
 	}
 
-	if updateWorkoutRequest.DurationMinutes != nil {
-		existingWorkout.DurationMinutes = *updateWorkoutRequest.DurationMinutes
-	}
+	workout.ID = int(workoutId)
+	workout.UserID = currentUser.ID
 
-	if updateWorkoutRequest.CaloriesBurned != nil {
-		existingWorkout.CaloriesBurned = *updateWorkoutRequest.CaloriesBurned
+	if !resolveExercises(w, wh.exerciseStore, wh.logger, currentUser.ID, workout.Entries) {
+		return
 	}
 
-	if updateWorkoutRequest.Entries != nil {
-		existingWorkout.Entries = updateWorkoutRequest.Entries // entries zero val is nil so doesn't need a pointer
+	err = validateWorkout(&workout)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
 	}
 
-	currentUser := middleware.GetUser(r)
-	if currentUser == nil || currentUser.IsAnonymous() {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+	err = entriesToCanonical(workout.Entries, unit)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
 		return
 	}
 
-	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(workoutId)
+	// a PUT sends back the calories_source it was given, so a figure that changed is the user correcting it like
+	// it is for PATCH. If-Match means the stored workout is the one the body was written against or the update fails
+	stored, err := wh.workoutStore.GetWorkoutById(workoutId)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout does not exist"})
-			return
-		}
-
+		wh.logger.Printf("ERROR: GetWorkoutById: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
+	if stored != nil && workout.CaloriesBurned > 0 && workout.CaloriesBurned != stored.CaloriesBurned {
+		workout.CaloriesSource = store.CaloriesMeasured
+	}
 
-	if workoutOwner != currentUser.ID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "unauthorized"})
+	err = fillCalories(wh.exerciseStore, wh.bodyWeightStore, currentUser.ID, &workout)
+	if err != nil {
+		wh.logger.Printf("ERROR: fillCalories: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	err = wh.workoutStore.UpdateWorkout(existingWorkout, workoutId)
+	err = wh.workoutStore.UpdateWorkout(&workout, workoutId, versions)
 	if err != nil {
-		wh.logger.Printf("ERROR: UpadteWorkout: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		wh.writeUpdateError(w, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": existingWorkout})
+	newRecords := reportRecords(workout.NewRecords, formula, unit)
+	entriesToDisplay(workout.Entries, unit)
+
+	w.Header().Set("ETag", workoutETag(&workout, unit))
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout, "new_records": newRecords})
 }
 
-func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Request) {
+func (wh *WorkoutHandler) HandlePatchWorkout(w http.ResponseWriter, r *http.Request) {
 	workoutId, err := utils.ReadIDParam(r)
 	if err != nil {
 		wh.logger.Printf("ERROR: ReadIDParam: %v", err)
@@ -165,33 +255,1103 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(workoutId)
+	if !wh.requireWorkoutOwner(w, workoutId, currentUser) {
+		return
+	}
+
+	applyPatch, err := patchFuncForRequest(r)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout does not exist"})
-			return
-		}
+		utils.WriteJSON(w, http.StatusUnsupportedMediaType, utils.Envelope{"error": err.Error()})
+		return
+	}
 
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	formula, err := records.ParseFormula(r.URL.Query().Get("formula"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
 		return
 	}
 
-	if workoutOwner != currentUser.ID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "unauthorized"})
+	unit, ok := readUnits(w, r)
+	if !ok {
 		return
 	}
 
-	err = wh.workoutStore.DeleteWorkout(workoutId)
-	if err == sql.ErrNoRows {
-		wh.logger.Printf("ERROR: DeleteWorkout: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to delete workout"})
+	// If-Match is optional here, a JSON patch can carry its own test ops instead
+	var versions []int
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		versions = ifMatchVersions(ifMatch)
+	}
+
+	patchDoc, err := io.ReadAll(r.Body)
+	if err != nil {
+		wh.logger.Printf("ERROR: reading patch body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request"})
+		return
+	}
+
+	// errors from inside apply are the client's fault, anything else coming out of PatchWorkout is ours
+	var applyErr error
+	workout, err := wh.workoutStore.PatchWorkout(workoutId, versions, func(existing *store.Workout) error {
+		// the patch is written against what a GET returns, so it's applied to the workout in the same units
+		stored := storedEntries(existing.Entries)
+		entriesToDisplay(existing.Entries, unit)
+		shown := existing.Entries
+		caloriesBefore := existing.CaloriesBurned
+
+		applyErr = applyWorkoutPatch(existing, patchDoc, applyPatch)
+		if applyErr != nil {
+			return applyErr
+		}
+
+		applyErr = patchedEntriesToCanonical(existing.Entries, shown, stored, unit)
+		if applyErr != nil {
+			return applyErr
+		}
+
+		err := wh.exerciseStore.ResolveEntries(currentUser.ID, existing.Entries)
+		if errors.Is(err, store.ErrExerciseNotFound) {
+			applyErr = err
+		}
+		if err != nil {
+			return err
+		}
+
+		// a patch that changes the figure is the user correcting it, one that leaves an estimate alone gets it worked out again
+		if existing.CaloriesBurned != caloriesBefore && existing.CaloriesBurned > 0 {
+			existing.CaloriesSource = store.CaloriesMeasured
+		}
+		return fillCalories(wh.exerciseStore, wh.bodyWeightStore, currentUser.ID, existing)
+	})
+	if applyErr != nil {
+		switch {
+		case errors.Is(applyErr, patch.ErrTestFailed):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": applyErr.Error()})
+		default:
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": applyErr.Error()})
+		}
 		return
 	}
 	if err != nil {
-		wh.logger.Printf("ERROR: DeleteWorkout: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to delete workout"})
+		wh.writeUpdateError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+	newRecords := reportRecords(workout.NewRecords, formula, unit)
+	entriesToDisplay(workout.Entries, unit)
+
+	w.Header().Set("ETag", workoutETag(workout, unit))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout, "new_records": newRecords})
+}
+
+type patchFunc func(original []byte, patchDoc []byte) ([]byte, error)
+
+// patchFuncForRequest picks merge patch or JSON patch from the Content-Type header,
+// plain application/json (or nothing at all) is treated as a merge patch as that's what most clients mean by it
+func patchFuncForRequest(r *http.Request) (patchFunc, error) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return patch.MergePatch, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, errors.New("invalid content type")
+	}
+
+	switch mediaType {
+	case patch.MergePatchContentType, "application/json":
+		return patch.MergePatch, nil
+	case patch.JSONPatchContentType:
+		return patch.ApplyJSONPatch, nil
+	default:
+		return nil, errors.New("content type must be " + patch.MergePatchContentType + " or " + patch.JSONPatchContentType)
+	}
+}
+
+// applyWorkoutPatch runs the patch against the JSON form of existing and swaps in the result once it passes validation
+func applyWorkoutPatch(existing *store.Workout, patchDoc []byte, applyPatch patchFunc) error {
+	original, err := json.Marshal(existing)
+	if err != nil {
+		return err
+	}
+
+	patched, err := applyPatch(original, patchDoc)
+	if err != nil {
+		return err
+	}
+
+	var workout store.Workout
+	err = json.Unmarshal(patched, &workout)
+	if err != nil {
+		return fmt.Errorf("patched workout is invalid: %v", err)
+	}
+
+	// these aren't the client's to change
+	workout.ID = existing.ID
+	workout.UserID = existing.UserID
+
+	existingEntries := map[int]*store.WorkoutEntry{}
+	for i := range existing.Entries {
+		existingEntries[existing.Entries[i].ID] = &existing.Entries[i]
+	}
+	for i := range workout.Entries {
+		if before, ok := existingEntries[workout.Entries[i].ID]; ok {
+			clearStaleExerciseID(before, &workout.Entries[i])
+		}
+	}
+
+	err = validateWorkout(&workout)
+	if err != nil {
+		return err
+	}
+
+	*existing = workout
+	return nil
+}
+
+// resolveExercises links entries to the exercise catalog, an exercise_id wins over exercise_name when both are sent.
+// Writes the error response itself, so callers just return when it gives back false
+func resolveExercises(w http.ResponseWriter, exerciseStore store.ExerciseStore, logger *log.Logger, userID int, entries []store.WorkoutEntry) bool {
+	err := exerciseStore.ResolveEntries(userID, entries)
+	if err != nil {
+		if errors.Is(err, store.ErrExerciseNotFound) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return false
+		}
+
+		logger.Printf("ERROR: ResolveEntries: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+
+	return true
+}
+
+// fillCalories estimates calories_burned from MET values when the client didn't send it. A workout that comes back
+// with calories_source still estimated (a GET sent straight back as a PUT) is estimated again, as the entries or
+// duration may have changed since, so sending calories_burned with calories_source measured is how to pin a figure
+func fillCalories(exerciseStore store.ExerciseStore, bodyWeightStore store.BodyWeightStore, userID int, workout *store.Workout) error {
+	if keepMeasuredCalories(workout) {
+		return nil
+	}
+
+	inputs, err := loadCalorieInputs(exerciseStore, bodyWeightStore, userID)
+	if err != nil {
+		return err
+	}
+
+	return inputs.estimate(workout)
+}
+
+// keepMeasuredCalories marks a figure the client sent as measured, false when it needs estimating
+func keepMeasuredCalories(workout *store.Workout) bool {
+	if workout.CaloriesBurned > 0 && workout.CaloriesSource != store.CaloriesEstimated {
+		workout.CaloriesSource = store.CaloriesMeasured
+		return true
+	}
+	return false
+}
+
+// calorieInputs is what an estimate needs from the stores. The body weight is loaded once per request and exercises
+// as workouts turn up that use them, so a bulk create looks each one up once rather than once per workout
+type calorieInputs struct {
+	exerciseStore store.ExerciseStore
+	userID        int
+	bodyWeightKg  float64
+	exercises     map[int]*store.Exercise // nil for an ID that was looked up and isn't there
+}
+
+func loadCalorieInputs(exerciseStore store.ExerciseStore, bodyWeightStore store.BodyWeightStore, userID int) (*calorieInputs, error) {
+	inputs := &calorieInputs{
+		exerciseStore: exerciseStore,
+		userID:        userID,
+		bodyWeightKg:  calories.ReferenceBodyWeightKg,
+		exercises:     map[int]*store.Exercise{},
+	}
+
+	bodyWeight, err := bodyWeightStore.GetLatestBodyWeight(userID)
+	if err != nil {
+		return nil, err
+	}
+	if bodyWeight != nil {
+		inputs.bodyWeightKg = bodyWeight.Weight
+	}
+
+	return inputs, nil
+}
+
+// loadExercises fetches the exercises the workout's entries point at that haven't been fetched already
+func (inputs *calorieInputs) loadExercises(workout *store.Workout) error {
+	missing := []int64{}
+	for _, entry := range workout.Entries {
+		if entry.ExerciseID == nil {
+			continue
+		}
+		if _, ok := inputs.exercises[*entry.ExerciseID]; !ok {
+			inputs.exercises[*entry.ExerciseID] = nil
+			missing = append(missing, int64(*entry.ExerciseID))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	exercises, err := inputs.exerciseStore.ListExercises(inputs.userID, store.ExerciseFilter{IDs: missing})
+	if err != nil {
+		return err
+	}
+
+	for _, exercise := range exercises {
+		inputs.exercises[exercise.ID] = exercise
+	}
+	return nil
+}
+
+func (inputs *calorieInputs) estimate(workout *store.Workout) error {
+	err := inputs.loadExercises(workout)
+	if err != nil {
+		return err
+	}
+
+	activities := make([]calories.Activity, 0, len(workout.Entries))
+	for _, entry := range workout.Entries {
+		var met *float64
+		pattern := ""
+		if entry.ExerciseID != nil {
+			if exercise := inputs.exercises[*entry.ExerciseID]; exercise != nil {
+				met = exercise.MET
+				pattern = exercise.MovementPattern
+			}
+		}
+
+		activities = append(activities, entryActivity(entry, calories.MET(met, pattern)))
+	}
+
+	workout.CaloriesBurned = calories.Estimate(inputs.bodyWeightKg, workout.DurationMinutes, activities)
+	workout.CaloriesSource = store.CaloriesEstimated
+	return nil
+}
+
+// entryActivity is how much of the session an entry took up, timed sets count for their duration and sets of reps for calories.SecondsPerSet
+func entryActivity(entry store.WorkoutEntry, met float64) calories.Activity {
+	activity := calories.Activity{MET: met}
+
+	if len(entry.Sets) == 0 {
+		if entry.DurationSeconds != nil {
+			activity.TimeSeconds = entry.SetCount * *entry.DurationSeconds
+		} else {
+			activity.Sets = entry.SetCount
+		}
+		return activity
+	}
+
+	for _, set := range entry.Sets {
+		if set.DurationSeconds != nil {
+			activity.TimeSeconds += *set.DurationSeconds
+		} else {
+			activity.Sets++
+		}
+	}
+	return activity
+}
+
+// readUnits is the unit weights go back out in, ?units= when it's given and the user's preferred unit otherwise.
+// Writes the error response itself, so callers just return when it gives back false
+func readUnits(w http.ResponseWriter, r *http.Request) (units.Unit, bool) {
+	unit, err := units.Parse(r.URL.Query().Get("units"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return "", false
+	}
+
+	if unit == "" {
+		unit = preferredUnit(middleware.GetUser(r))
+	}
+
+	return unit, true
+}
+
+func preferredUnit(user *store.User) units.Unit {
+	if user.PreferredUnit == "" {
+		return units.Canonical
+	}
+	return units.Unit(user.PreferredUnit)
+}
+
+// userLocation is the user's default time zone, UTC if it's never been set
+func userLocation(user *store.User) *time.Location {
+	if user == nil || user.TimeZone == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(user.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// weightToCanonical converts an incoming weight to kg in place, a blank weightUnit means the weight is in fallback
+func weightToCanonical(weight *float64, weightUnit *string, fallback units.Unit) error {
+	unit, err := units.Parse(*weightUnit)
+	if err != nil {
+		return errors.New("weight_unit must be kg or lb")
+	}
+	if unit == "" {
+		unit = fallback
+	}
+
+	*weightUnit = string(unit)
+	if weight != nil {
+		*weight = units.ToCanonical(*weight, unit)
+	}
+
+	return nil
+}
+
+// weightToDisplay converts a stored kg weight to unit in place, weight_unit going out is the unit weight is now in
+// so a response can be sent straight back as a request
+func weightToDisplay(weight *float64, weightUnit *string, unit units.Unit) {
+	*weightUnit = string(unit)
+	if weight != nil {
+		*weight = units.FromCanonical(*weight, unit)
+	}
+}
+
+// distanceToCanonical converts an incoming distance to metres in place, a blank distanceUnit means the distance is in
+// whatever goes with the fallback weight unit
+func distanceToCanonical(distance *float64, distanceUnit *string, fallback units.Unit) error {
+	unit, err := units.ParseDistance(*distanceUnit)
+	if err != nil {
+		return err
+	}
+	if unit == "" {
+		unit = units.DefaultDistance(fallback)
+	}
+
+	*distanceUnit = string(unit)
+	if distance != nil {
+		*distance = units.DistanceToCanonical(*distance, unit)
+	}
+
+	return nil
+}
+
+// entryToCanonical converts the entry's weight and its sets' weights, sets are always in the entry's weight_unit.
+// The distance is converted too
+func entryToCanonical(entry *store.WorkoutEntry, fallback units.Unit) error {
+	err := weightToCanonical(entry.Weight, &entry.WeightUnit, fallback)
+	if err != nil {
+		return err
+	}
+
+	err = distanceToCanonical(entry.Distance, &entry.DistanceUnit, fallback)
+	if err != nil {
+		return err
+	}
+
+	for i := range entry.Sets {
+		if entry.Sets[i].Weight != nil {
+			*entry.Sets[i].Weight = units.ToCanonical(*entry.Sets[i].Weight, units.Unit(entry.WeightUnit))
+		}
+	}
+
+	return nil
+}
+
+// entryToDisplay converts the entry to unit, apart from the distance which goes back out in the unit it came in as.
+// Nobody wants their 5 km run shown in miles because they lift in lb
+func entryToDisplay(entry *store.WorkoutEntry, unit units.Unit) {
+	weightToDisplay(entry.Weight, &entry.WeightUnit, unit)
+
+	if entry.Distance != nil {
+		*entry.Distance = units.DistanceFromCanonical(*entry.Distance, units.DistanceUnit(entry.DistanceUnit))
+	}
+
+	for i := range entry.Sets {
+		if entry.Sets[i].Weight != nil {
+			*entry.Sets[i].Weight = units.FromCanonical(*entry.Sets[i].Weight, unit)
+		}
+	}
+}
+
+func entriesToCanonical(entries []store.WorkoutEntry, fallback units.Unit) error {
+	for i := range entries {
+		err := entryToCanonical(&entries[i], fallback)
+		if err != nil {
+			return fmt.Errorf("entries[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func entriesToDisplay(entries []store.WorkoutEntry, unit units.Unit) {
+	for i := range entries {
+		entryToDisplay(&entries[i], unit)
+	}
+}
+
+// storedEntry copies an entry deeply enough that entryToDisplay can't reach the copy, so a patch can be checked
+// against what was stored
+func storedEntry(entry store.WorkoutEntry) store.WorkoutEntry {
+	entry.Weight = copyFloat(entry.Weight)
+	entry.Distance = copyFloat(entry.Distance)
+	entry.Sets = append([]store.WorkoutSet(nil), entry.Sets...)
+	for i := range entry.Sets {
+		entry.Sets[i].Weight = copyFloat(entry.Sets[i].Weight)
+	}
+	return entry
+}
+
+func storedEntries(entries []store.WorkoutEntry) []store.WorkoutEntry {
+	stored := make([]store.WorkoutEntry, len(entries))
+	for i := range entries {
+		stored[i] = storedEntry(entries[i])
+	}
+	return stored
+}
+
+func copyFloat(f *float64) *float64 {
+	if f == nil {
+		return nil
+	}
+	c := *f
+	return &c
+}
+
+func sameFloat(a *float64, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// patchedEntryToCanonical is entryToCanonical for an entry a patch was applied to, shown is the entry as the patch
+// saw it and stored is the same entry before it was converted for display. Anything the patch left alone goes back
+// exactly as it was stored, so a PATCH never rounds a weight off or swaps its weight_unit for the one being displayed
+func patchedEntryToCanonical(entry *store.WorkoutEntry, shown *store.WorkoutEntry, stored *store.WorkoutEntry, fallback units.Unit) error {
+	unit, err := units.Parse(entry.WeightUnit)
+	if err != nil {
+		return errors.New("weight_unit must be kg or lb")
+	}
+	if unit == "" {
+		unit = fallback
+	}
+	weightUntouched := entry.WeightUnit == shown.WeightUnit
+
+	if weightUntouched && sameFloat(entry.Weight, shown.Weight) {
+		entry.Weight, entry.WeightUnit = copyFloat(stored.Weight), stored.WeightUnit
+	} else {
+		err = weightToCanonical(entry.Weight, &entry.WeightUnit, fallback)
+		if err != nil {
+			return err
+		}
+	}
+
+	if entry.DistanceUnit == shown.DistanceUnit && sameFloat(entry.Distance, shown.Distance) {
+		entry.Distance = copyFloat(stored.Distance)
+	} else {
+		err = distanceToCanonical(entry.Distance, &entry.DistanceUnit, fallback)
+		if err != nil {
+			return err
+		}
+	}
+
+	// sets are in the entry's weight_unit as the patch left it, matched up with the stored ones by ID
+	shownSets := map[int]int{}
+	for i, set := range shown.Sets {
+		if set.ID != 0 {
+			shownSets[set.ID] = i
+		}
+	}
+	for i := range entry.Sets {
+		set := &entry.Sets[i]
+		j, ok := shownSets[set.ID]
+		if ok && set.ID != 0 && weightUntouched && sameFloat(set.Weight, shown.Sets[j].Weight) {
+			set.Weight = copyFloat(stored.Sets[j].Weight)
+			continue
+		}
+		if set.Weight != nil {
+			*set.Weight = units.ToCanonical(*set.Weight, unit)
+		}
+	}
+
+	return nil
+}
+
+// patchedEntriesToCanonical matches each patched entry up with the one it was by ID, entries the patch added are
+// converted with entryToCanonical
+func patchedEntriesToCanonical(entries []store.WorkoutEntry, shown []store.WorkoutEntry, stored []store.WorkoutEntry, fallback units.Unit) error {
+	byID := map[int]int{}
+	for i := range shown {
+		byID[shown[i].ID] = i
+	}
+
+	for i := range entries {
+		var err error
+		if j, ok := byID[entries[i].ID]; ok && entries[i].ID != 0 {
+			err = patchedEntryToCanonical(&entries[i], &shown[j], &stored[j], fallback)
+		} else {
+			err = entryToCanonical(&entries[i], fallback)
+		}
+		if err != nil {
+			return fmt.Errorf("entries[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (wh *WorkoutHandler) writeUpdateError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrEntryNotFound) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout does not exist"})
+		return
+	}
+
+	if errors.Is(err, store.ErrVersionMismatch) {
+		utils.WriteJSON(w, http.StatusPreconditionFailed, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	wh.logger.Printf("ERROR: UpdateWorkout: %v", err)
+	utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+}
+
+func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutId, err := utils.ReadIDParam(r)
+	if err != nil {
+		wh.logger.Printf("ERROR: ReadIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil || currentUser.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	if !wh.requireWorkoutOwner(w, workoutId, currentUser) {
+		return
+	}
+
+	versions, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err = wh.workoutStore.DeleteWorkout(workoutId, versions)
+	if errors.Is(err, store.ErrVersionMismatch) {
+		utils.WriteJSON(w, http.StatusPreconditionFailed, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err == sql.ErrNoRows {
+		wh.logger.Printf("ERROR: DeleteWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to delete workout"})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: DeleteWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to delete workout"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListTrash returns the user's deleted workouts, they stay restorable until the purge job removes them
+func (wh *WorkoutHandler) HandleListTrash(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	workouts, err := wh.workoutStore.ListTrashedWorkouts(currentUser.ID)
+	if err != nil {
+		wh.logger.Printf("ERROR: ListTrashedWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	for _, workout := range workouts {
+		entriesToDisplay(workout.Entries, unit)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": workouts})
+}
+
+func (wh *WorkoutHandler) HandleRestoreWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutId, err := utils.ReadIDParam(r)
+	if err != nil {
+		wh.logger.Printf("ERROR: ReadIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	// the store only restores from the user's own trash, so someone else's workout looks the same as one that isn't there
+	err = wh.workoutStore.RestoreWorkout(middleware.GetUser(r).ID, workoutId)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout is not in the trash"})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: RestoreWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	workout, err := wh.workoutStore.GetWorkoutById(workoutId)
+	if err != nil {
+		wh.logger.Printf("ERROR: GetWorkoutById: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	entriesToDisplay(workout.Entries, unit)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
+}
+
+// workoutETag is the workout's version and the unit its weights are in, the same workout in kg and in lb are two
+// different bodies so they can't share a tag. The unit comes from ?units or the user's preferred_unit, ?units is
+// part of the URL already and the Vary: Authorization every response gets covers the preferred unit
+func workoutETag(workout *store.Workout, unit units.Unit) string {
+	return `"` + strconv.Itoa(workout.Version) + "-" + string(unit) + `"`
+}
+
+// workoutTag is an ETag read back from a request, unit is "" for a tag with only the version in it
+type workoutTag struct {
+	version int
+	unit    units.Unit
+}
+
+// parseETags reads an If-Match or If-None-Match list back into tags, true for *.
+// Tags that aren't ours can never match so they're left out, weak tags compare the same as strong ones
+func parseETags(header string) ([]workoutTag, bool) {
+	tags := []workoutTag{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil, true
+		}
+
+		version, unit, _ := strings.Cut(strings.Trim(strings.TrimPrefix(tag, "W/"), `"`), "-")
+		v, err := strconv.Atoi(version)
+		if err == nil {
+			tags = append(tags, workoutTag{version: v, unit: units.Unit(unit)})
+		}
+	}
+	return tags, false
+}
+
+// ifMatchVersions is what the store takes for an If-Match header, nil for * so any version goes.
+// The unit doesn't matter for a write, it's only the version that says whether someone else got there first
+func ifMatchVersions(header string) []int {
+	tags, anyVersion := parseETags(header)
+	if anyVersion {
+		return nil
+	}
+
+	versions := []int{}
+	for _, tag := range tags {
+		versions = append(versions, tag.version)
+	}
+	return versions
+}
+
+// requireIfMatch is for writes that would overwrite someone else's changes without it,
+// writes the error response itself, so callers just return when it gives back false
+func requireIfMatch(w http.ResponseWriter, r *http.Request) ([]int, bool) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		utils.WriteJSON(w, http.StatusPreconditionRequired, utils.Envelope{"error": "If-Match is required, send the ETag from GET /workouts/{id}"})
+		return nil, false
+	}
+
+	return ifMatchVersions(ifMatch), true
+}
+
+// matchesTag is If-None-Match for a workout, the version and the unit both have to be the same
+func matchesTag(tags []workoutTag, version int, unit units.Unit) bool {
+	for _, tag := range tags {
+		if tag.version == version && tag.unit == unit {
+			return true
+		}
+	}
+	return false
+}
+
+// requireWorkoutOwner writes the error response itself, so callers just return when it gives back false
+func (wh *WorkoutHandler) requireWorkoutOwner(w http.ResponseWriter, workoutId int64, currentUser *store.User) bool {
+	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(workoutId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout does not exist"})
+			return false
+		}
+
+		wh.logger.Printf("ERROR: GetWorkoutOwner: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+
+	if workoutOwner != currentUser.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "unauthorized"})
+		return false
+	}
+
+	return true
+}
+
+func validateWorkout(workout *store.Workout) error {
+	if workout.Title == "" {
+		return errors.New("title is required")
+	}
+
+	if len(workout.Title) > 255 {
+		return errors.New("title cannot be greater than 255 characters")
+	}
+
+	if workout.TimeZone != "" {
+		if _, err := time.LoadLocation(workout.TimeZone); err != nil {
+			return errors.New("time_zone must be an IANA time zone, e.g. Europe/London")
+		}
+	}
+
+	if workout.EndedAt != nil {
+		if workout.StartedAt.IsZero() {
+			return errors.New("started_at is required when ended_at is set")
+		}
+		if !workout.EndedAt.After(workout.StartedAt) {
+			return errors.New("ended_at must be after started_at")
+		}
+		// the timestamps win over whatever duration_minutes was sent so the two can't disagree
+		workout.DurationMinutes = int(math.Ceil(workout.EndedAt.Sub(workout.StartedAt).Minutes()))
+	}
+
+	if workout.DurationMinutes <= 0 {
+		return errors.New("duration_minutes must be greater than 0")
+	}
+
+	if workout.CaloriesBurned < 0 {
+		return errors.New("calories_burned cannot be negative")
+	}
+
+	if workout.CaloriesSource != "" && workout.CaloriesSource != store.CaloriesMeasured && workout.CaloriesSource != store.CaloriesEstimated {
+		return errors.New("calories_source must be measured or estimated")
+	}
+
+	if workout.SessionRPE != nil && (*workout.SessionRPE < 1 || *workout.SessionRPE > 10) {
+		return errors.New("session_rpe must be between 1 and 10")
+	}
+
+	orderIndexes := map[int]bool{}
+	groupSizes := make([]int, len(workout.Groups))
+	for i, entry := range workout.Entries {
+		err := validateWorkoutEntry(&entry)
+		if err != nil {
+			return fmt.Errorf("entries[%d]: %w", i, err)
+		}
+
+		if orderIndexes[entry.OrderIndex] {
+			return fmt.Errorf("entries[%d]: order_index %d is used more than once", i, entry.OrderIndex)
+		}
+		orderIndexes[entry.OrderIndex] = true
+
+		if entry.GroupIndex != nil {
+			if *entry.GroupIndex < 0 || *entry.GroupIndex >= len(workout.Groups) {
+				return fmt.Errorf("entries[%d]: group_index %d does not match a group", i, *entry.GroupIndex)
+			}
+			groupSizes[*entry.GroupIndex]++
+		}
+	}
+
+	for i, group := range workout.Groups {
+		err := validateEntryGroup(&group, groupSizes[i])
+		if err != nil {
+			return fmt.Errorf("groups[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func validateEntryGroup(group *store.EntryGroup, entries int) error {
+	minEntries, ok := store.MinGroupEntries[group.Type]
+	if !ok {
+		return fmt.Errorf("type must be one of %s", strings.Join(store.EntryGroupTypes, ", "))
+	}
+
+	if entries < minEntries {
+		return fmt.Errorf("a %s needs at least %d entries", group.Type, minEntries)
+	}
+
+	// an amrap's rounds are however many got done, everything else needs at least one
+	if group.Rounds < 0 || (group.Rounds == 0 && group.Type != "amrap") {
+		return errors.New("rounds must be greater than 0")
+	}
+
+	if group.RestSeconds != nil && *group.RestSeconds < 0 {
+		return errors.New("rest_seconds cannot be negative")
+	}
+
+	if group.Type == "amrap" && (group.TimeCapSeconds == nil || *group.TimeCapSeconds <= 0) {
+		return errors.New("time_cap_seconds is required for an amrap")
+	}
+
+	if group.TimeCapSeconds != nil && *group.TimeCapSeconds <= 0 {
+		return errors.New("time_cap_seconds must be greater than 0")
+	}
+
+	return nil
+}
+
+func validateWorkoutEntry(entry *store.WorkoutEntry) error {
+	if entry.ExerciseName == "" {
+		return errors.New("exercise_name is required")
+	}
+
+	err := validateCardio(entry)
+	if err != nil {
+		return err
+	}
+
+	// with sets logged the entry's own set_count, reps and weight get worked out from them by the store
+	if len(entry.Sets) > 0 {
+		err = validateWorkoutSets(entry.Sets)
+		if err != nil {
+			return err
+		}
+		if entry.Distance != nil && entry.Sets[0].DurationSeconds == nil {
+			return errors.New("distance can only go with sets that use duration_seconds")
+		}
+		return nil
+	}
+
+	// a cardio entry is one set unless it says otherwise, the store fills that in
+	if entry.SetCount < 0 || (entry.SetCount == 0 && !entry.IsCardio()) {
+		return errors.New("set_count must be greater than 0")
+	}
+
+	// same rules as the valid_workout_entry constraint, nicer to tell the client here than send back a 500
+	if entry.Distance != nil {
+		if entry.Reps != nil {
+			return errors.New("reps cannot be combined with distance")
+		}
+		return nil
+	}
+
+	if (entry.Reps == nil) == (entry.DurationSeconds == nil) {
+		return errors.New("exactly one of reps or duration_seconds is required")
+	}
+
+	return nil
+}
+
+// validateCardio checks the cardio fields against the valid_workout_entry_cardio constraint
+func validateCardio(entry *store.WorkoutEntry) error {
+	if entry.Distance != nil && *entry.Distance <= 0 {
+		return errors.New("distance must be greater than 0")
+	}
+
+	if entry.AvgHeartRate != nil && (*entry.AvgHeartRate < 20 || *entry.AvgHeartRate > 250) {
+		return errors.New("avg_heart_rate must be between 20 and 250")
+	}
+
+	if entry.MaxHeartRate != nil && (*entry.MaxHeartRate < 20 || *entry.MaxHeartRate > 250) {
+		return errors.New("max_heart_rate must be between 20 and 250")
+	}
+
+	if entry.AvgHeartRate != nil && entry.MaxHeartRate != nil && *entry.MaxHeartRate < *entry.AvgHeartRate {
+		return errors.New("max_heart_rate cannot be lower than avg_heart_rate")
+	}
+
+	if entry.Cadence != nil && *entry.Cadence < 0 {
+		return errors.New("cadence cannot be negative")
+	}
+
+	if entry.Power != nil && *entry.Power < 0 {
+		return errors.New("power cannot be negative")
+	}
+
+	if entry.ElevationGainMeters != nil && *entry.ElevationGainMeters < 0 {
+		return errors.New("elevation_gain_meters cannot be negative")
+	}
+
+	return nil
+}
+
+func validateWorkoutSets(sets []store.WorkoutSet) error {
+	setNumbers := map[int]bool{}
+	timed := sets[0].DurationSeconds != nil
+
+	for i, set := range sets {
+		if (set.Reps == nil) == (set.DurationSeconds == nil) {
+			return fmt.Errorf("sets[%d]: exactly one of reps or duration_seconds is required", i)
+		}
+
+		// the entry summary can only be one or the other
+		if (set.DurationSeconds != nil) != timed {
+			return fmt.Errorf("sets[%d]: every set must use reps or every set must use duration_seconds", i)
+		}
+
+		if set.Weight != nil && *set.Weight < 0 {
+			return fmt.Errorf("sets[%d]: weight cannot be negative", i)
+		}
+
+		if set.RPE != nil && (*set.RPE < 1 || *set.RPE > 10) {
+			return fmt.Errorf("sets[%d]: rpe must be between 1 and 10", i)
+		}
+
+		if set.RIR != nil && *set.RIR < 0 {
+			return fmt.Errorf("sets[%d]: rir cannot be negative", i)
+		}
+
+		if set.RestSeconds != nil && *set.RestSeconds < 0 {
+			return fmt.Errorf("sets[%d]: rest_seconds cannot be negative", i)
+		}
+
+		setNumber := set.SetNumber
+		if setNumber == 0 {
+			setNumber = i + 1
+		}
+		if setNumber < 0 || setNumbers[setNumber] {
+			return fmt.Errorf("sets[%d]: set_number %d is used more than once or is invalid", i, setNumber)
+		}
+		setNumbers[setNumber] = true
+	}
+
+	return nil
+}
+
+func (wh *WorkoutHandler) HandleListWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil || currentUser.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	loc, err := readTimeZone(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	filter, err := parseWorkoutFilter(r.URL.Query(), loc)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	filter.UserID = currentUser.ID
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := wh.workoutStore.ListWorkouts(filter)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) || errors.Is(err, store.ErrInvalidSort) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		wh.logger.Printf("ERROR: ListWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	for _, workout := range page.Workouts {
+		entriesToDisplay(workout.Entries, unit)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": page.Workouts, "next_cursor": page.NextCursor})
+}
+
+func (wh *WorkoutHandler) HandleSearchWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil || currentUser.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		return
+	}
+
+	limit, err := utils.ReadIntQuery(r.URL.Query(), "limit", 0)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	results, err := wh.workoutStore.SearchWorkouts(currentUser.ID, r.URL.Query().Get("q"), limit)
+	if err != nil {
+		if errors.Is(err, store.ErrEmptySearch) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "q is required"})
+			return
+		}
+
+		wh.logger.Printf("ERROR: SearchWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"results": results})
+}
+
+// parseWorkoutFilter reads ?from= and ?to= as whole days in loc
+func parseWorkoutFilter(query url.Values, loc *time.Location) (store.WorkoutFilter, error) {
+	filter := store.WorkoutFilter{
+		Title: query.Get("title"),
+		ExerciseName: query.Get("exercise"),
+		Sort: query.Get("sort"),
+		Cursor: query.Get("cursor"),
+	}
+
+	var err error
+
+	filter.Limit, err = utils.ReadIntQuery(query, "limit", 0)
+	if err != nil {
+		return filter, err
+	}
+
+	filter.From, err = utils.ReadDateQueryIn(query, "from", false, loc)
+	if err != nil {
+		return filter, err
+	}
+
+	filter.To, err = utils.ReadDateQueryIn(query, "to", true, loc)
+	if err != nil {
+		return filter, err
+	}
+
+	// a slice rather than a map so the first bad param is always the one reported
+	intFilters := []struct {
+		key string
+		target **int
+	}{
+		{"min_duration", &filter.MinDuration},
+		{"max_duration", &filter.MaxDuration},
+		{"min_calories", &filter.MinCalories},
+		{"max_calories", &filter.MaxCalories},
+	}
+	for _, intFilter := range intFilters {
+		if query.Get(intFilter.key) == "" {
+			continue
+		}
+		value, err := utils.ReadIntQuery(query, intFilter.key, 0)
+		if err != nil {
+			return filter, err
+		}
+		*intFilter.target = &value
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/lesi97/internal/heartrate"
+	"github.com/lesi97/internal/middleware"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/utils"
+)
+
+// MaxHeartRateBytes caps an upload of heart rate samples, a day of them at one a second is well under 2 MB as CSV
+const MaxHeartRateBytes = 5 << 20
+
+const (
+	DefaultHeartRatePoints = 300
+	MaxHeartRatePoints     = 5000
+)
+
+// heartRateResponse is a workout's heart rate, zones is nil until the user has set their max and resting heart rate
+type heartRateResponse struct {
+	heartrate.Summary
+	MaxHeartRate      *int                    `json:"max_heart_rate"`
+	RestingHeartRate  *int                    `json:"resting_heart_rate"`
+	Zones             []heartrate.Zone        `json:"zones"`
+	BelowZonesSeconds int                     `json:"below_zones_seconds"`
+	Series            []store.HeartRateSample `json:"series"`
+}
+
+// HandleUploadHeartRate replaces the workout's heart rate samples with the ones sent, as the "file" field of a
+// multipart form or as the whole body. They can be CSV or a JSON array, worked out from the data unless ?format= says
+func (wh *WorkoutHandler) HandleUploadHeartRate(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := wh.readOwnedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	format, err := heartrate.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	workout, err := wh.workoutStore.GetWorkoutById(workoutId)
+	if err != nil {
+		wh.logger.Printf("ERROR: GetWorkoutById: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if workout == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout does not exist"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxHeartRateBytes)
+
+	file, err := readImportFile(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": fmt.Sprintf("file cannot be larger than %d MB", MaxHeartRateBytes>>20)})
+			return
+		}
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "could not read the file"})
+		return
+	}
+
+	samples, err := heartrate.Parse(data, format, workout.StartedAt, heartrate.MaxOffset(workout.DurationMinutes))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = wh.workoutStore.ReplaceHeartRateSamples(workoutId, samples)
+	if err != nil {
+		wh.logger.Printf("ERROR: ReplaceHeartRateSamples: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"heart_rate": heartrate.Summarize(samples)})
+}
+
+// HandleGetHeartRate returns the workout's heart rate summary, time in each zone and the samples averaged down to
+// at most ?points= (300 by default) for charting
+func (wh *WorkoutHandler) HandleGetHeartRate(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := wh.readOwnedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	points := DefaultHeartRatePoints
+	if value := r.URL.Query().Get("points"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > MaxHeartRatePoints {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("points must be between 1 and %d", MaxHeartRatePoints)})
+			return
+		}
+		points = parsed
+	}
+
+	samples, err := wh.workoutStore.GetHeartRateSamples(workoutId)
+	if err != nil {
+		wh.logger.Printf("ERROR: GetHeartRateSamples: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if samples == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout has no heart rate samples"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	response := heartRateResponse{
+		Summary:          heartrate.Summarize(samples),
+		MaxHeartRate:     currentUser.MaxHeartRate,
+		RestingHeartRate: currentUser.RestingHeartRate,
+		Series:           heartrate.Downsample(samples, points),
+	}
+
+	if currentUser.MaxHeartRate != nil && currentUser.RestingHeartRate != nil {
+		response.Zones = heartrate.Zones(*currentUser.MaxHeartRate, *currentUser.RestingHeartRate)
+		response.BelowZonesSeconds = heartrate.TimeInZones(samples, response.Zones)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"heart_rate": response})
+}
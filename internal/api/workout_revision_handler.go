@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/lesi97/internal/patch"
+	"github.com/lesi97/internal/records"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/units"
+	"github.com/lesi97/internal/utils"
+)
+
+// HandleListWorkoutRevisions lists the workout's history newest first, fetch a single revision for its snapshot
+func (wh *WorkoutHandler) HandleListWorkoutRevisions(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := wh.readOwnedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := wh.workoutStore.ListWorkoutRevisions(workoutId)
+	if err != nil {
+		wh.logger.Printf("ERROR: ListWorkoutRevisions: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"revisions": revisions})
+}
+
+func (wh *WorkoutHandler) HandleGetWorkoutRevision(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := wh.readOwnedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	revisionNumber, err := utils.ReadNamedIDParam(r, "rev")
+	if err != nil || revisionNumber < 1 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid revision"})
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	revision, ok := wh.readRevision(w, workoutId, int(revisionNumber), unit)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"revision": revision})
+}
+
+// HandleDiffWorkoutRevisions compares revision ?from= with ?to= (the latest revision when it's left off) field by field,
+// paths are JSON pointers into the workout so they line up with what a GET returns
+func (wh *WorkoutHandler) HandleDiffWorkoutRevisions(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := wh.readOwnedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	from, err := utils.ReadIntQuery(query, "from", 0)
+	if err != nil || from < 1 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "from must be a revision number"})
+		return
+	}
+
+	to, err := utils.ReadIntQuery(query, "to", 0)
+	if err != nil || to < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "to must be a revision number"})
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	fromRevision, ok := wh.readRevision(w, workoutId, from, unit)
+	if !ok {
+		return
+	}
+
+	toRevision, ok := wh.readRevision(w, workoutId, to, unit)
+	if !ok {
+		return
+	}
+
+	changes, err := diffWorkouts(fromRevision.Workout, toRevision.Workout)
+	if err != nil {
+		wh.logger.Printf("ERROR: diffWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"from":    fromRevision.Revision,
+		"to":      toRevision.Revision,
+		"changes": changes,
+	})
+}
+
+// HandleRevertWorkout puts the workout back to how it was at a revision, recorded as a new revision on top
+func (wh *WorkoutHandler) HandleRevertWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := wh.readOwnedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	revisionNumber, err := utils.ReadNamedIDParam(r, "rev")
+	if err != nil || revisionNumber < 1 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid revision"})
+		return
+	}
+
+	formula, err := records.ParseFormula(r.URL.Query().Get("formula"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	workout, err := wh.workoutStore.RevertWorkout(workoutId, int(revisionNumber))
+	if errors.Is(err, store.ErrRevisionNotFound) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		wh.writeUpdateError(w, err)
+		return
+	}
+
+	newRecords := reportRecords(workout.NewRecords, formula, unit)
+	entriesToDisplay(workout.Entries, unit)
+
+	w.Header().Set("ETag", workoutETag(workout, unit))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout, "new_records": newRecords})
+}
+
+// readRevision loads a revision with its snapshot in unit, 0 is the latest.
+// Writes the error response itself, so callers just return when it gives back false
+func (wh *WorkoutHandler) readRevision(w http.ResponseWriter, workoutId int64, revisionNumber int, unit units.Unit) (*store.WorkoutRevision, bool) {
+	revision, err := wh.workoutStore.GetWorkoutRevision(workoutId, revisionNumber)
+	if errors.Is(err, store.ErrRevisionNotFound) {
+		message := err.Error()
+		if revisionNumber > 0 {
+			message = "revision " + strconv.Itoa(revisionNumber) + " not found"
+		}
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": message})
+		return nil, false
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: GetWorkoutRevision: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+
+	entriesToDisplay(revision.Workout.Entries, unit)
+	return revision, true
+}
+
+// diffWorkouts leaves out updated_at and version as they change with every revision and say nothing about what changed
+func diffWorkouts(from *store.Workout, to *store.Workout) ([]patch.Change, error) {
+	fromJSON, err := json.Marshal(from)
+	if err != nil {
+		return nil, err
+	}
+
+	toJSON, err := json.Marshal(to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := patch.Diff(fromJSON, toJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []patch.Change{}
+	for _, change := range changes {
+		if change.Path != "/updated_at" && change.Path != "/version" {
+			filtered = append(filtered, change)
+		}
+	}
+
+	return filtered, nil
+}
@@ -0,0 +1,309 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/lesi97/internal/middleware"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/track"
+	"github.com/lesi97/internal/units"
+	"github.com/lesi97/internal/utils"
+)
+
+// MaxTrackBytes caps an uploaded GPX or TCX file, a five hour ride recorded every second is under 10 MB
+const MaxTrackBytes = 25 << 20
+
+// sportExercises is the exercise each sport's entry is logged as, names from the catalog so they link up
+var sportExercises = map[string]string{
+	track.Running:  "Running",
+	track.Cycling:  "Cycling",
+	track.Walking:  "Walking",
+	track.Hiking:   "Hiking",
+	track.Swimming: "Swimming",
+	track.Rowing:   "Rowing",
+}
+
+// trackResponse adds the pace, it's only ever worked out from the speed so it isn't stored
+type trackResponse struct {
+	*store.WorkoutTrack
+	AvgPaceSecondsPerKm *float64 `json:"avg_pace_seconds_per_km"`
+}
+
+// HandleUploadTrack creates a workout from a GPX or TCX recording, sent as the "file" field of a multipart form or as
+// the whole body. The format is worked out from the file unless ?format= says. The workout gets a single entry for
+// the sport lasting the moving time, the track's summary comes back alongside it and the file is kept as it was sent
+func (wh *WorkoutHandler) HandleUploadTrack(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	format, err := track.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxTrackBytes)
+
+	file, err := readImportFile(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": fmt.Sprintf("file cannot be larger than %d MB", MaxTrackBytes>>20)})
+			return
+		}
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "could not read the file"})
+		return
+	}
+
+	parsed, err := track.Parse(data, format)
+	if err != nil {
+		if errors.Is(err, track.ErrUnknownFormat) || errors.Is(err, track.ErrTooShort) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		wh.logger.Printf("ERROR: track.Parse: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "could not read the file as GPX or TCX"})
+		return
+	}
+
+	summary := parsed.Summarize()
+
+	// uploading the same recording twice is an easy mistake to make
+	existing, err := wh.workoutStore.ListWorkoutStartTimes(currentUser.ID, summary.StartedAt, summary.StartedAt)
+	if err != nil {
+		wh.logger.Printf("ERROR: ListWorkoutStartTimes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if len(existing) > 0 {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "a workout starting at the same time already exists"})
+		return
+	}
+
+	workout := trackWorkout(parsed, summary, currentUser)
+
+	if !resolveExercises(w, wh.exerciseStore, wh.logger, currentUser.ID, workout.Entries) {
+		return
+	}
+
+	err = validateWorkout(&workout)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = fillCalories(wh.exerciseStore, wh.bodyWeightStore, currentUser.ID, &workout)
+	if err != nil {
+		wh.logger.Printf("ERROR: fillCalories: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	workoutTrack := &store.WorkoutTrack{Format: string(parsed.Format), Raw: data}
+	applySummary(workoutTrack, parsed, summary)
+
+	createdWorkout, err := wh.workoutStore.CreateWorkoutWithTrack(&workout, workoutTrack)
+	if err != nil {
+		wh.logger.Printf("ERROR: CreateWorkoutWithTrack: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create workout"})
+		return
+	}
+
+	entriesToDisplay(createdWorkout.Entries, unit)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": createdWorkout, "track": newTrackResponse(workoutTrack)})
+}
+
+func (wh *WorkoutHandler) HandleGetWorkoutTrack(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := wh.readOwnedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	workoutTrack, ok := wh.readWorkoutTrack(w, workoutId)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"track": newTrackResponse(workoutTrack)})
+}
+
+// HandleReprocessWorkoutTrack works the summary out again from the stored file, for tracks uploaded before a change
+// to how it's calculated. The entry the track made gets the new time, distance, heart rate and climbing, which is
+// recorded as a revision like any other change to the workout, and the workout comes back alongside the track
+func (wh *WorkoutHandler) HandleReprocessWorkoutTrack(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := wh.readOwnedWorkoutId(w, r)
+	if !ok {
+		return
+	}
+
+	unit, ok := readUnits(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	// errors from parsing are the stored file's fault, anything else coming out of ReprocessWorkoutTrack is ours
+	var parseErr error
+	workoutTrack, workout, err := wh.workoutStore.ReprocessWorkoutTrack(workoutId, func(workoutTrack *store.WorkoutTrack, workout *store.Workout) error {
+		parsed, err := track.Parse(workoutTrack.Raw, track.Format(workoutTrack.Format))
+		if err != nil {
+			parseErr = err
+			return err
+		}
+
+		// found before the summary's applied, the sport can come out differently the second time round
+		entry := trackEntry(workout, workoutTrack.Sport)
+
+		summary := parsed.Summarize()
+		applySummary(workoutTrack, parsed, summary)
+		if entry != nil {
+			applyTrackEntry(entry, summary)
+		}
+
+		return fillCalories(wh.exerciseStore, wh.bodyWeightStore, currentUser.ID, workout)
+	})
+	if parseErr != nil {
+		wh.logger.Printf("ERROR: track.Parse: %v", parseErr)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "could not process the stored file"})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: ReprocessWorkoutTrack: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if workoutTrack == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout has no track"})
+		return
+	}
+
+	entriesToDisplay(workout.Entries, unit)
+
+	w.Header().Set("ETag", workoutETag(workout, unit))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"track": newTrackResponse(workoutTrack), "workout": workout})
+}
+
+func (wh *WorkoutHandler) readWorkoutTrack(w http.ResponseWriter, workoutId int64) (*store.WorkoutTrack, bool) {
+	workoutTrack, err := wh.workoutStore.GetWorkoutTrack(workoutId)
+	if err != nil {
+		wh.logger.Printf("ERROR: GetWorkoutTrack: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	if workoutTrack == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout has no track"})
+		return nil, false
+	}
+
+	return workoutTrack, true
+}
+
+// trackWorkout is the workout a recording becomes, named after the file's own name when it has one. The entry
+// carries the track's distance, heart rate and climbing, with the distance shown in the unit that goes with the
+// user's preferred weight unit
+func trackWorkout(parsed *track.Track, summary track.Summary, user *store.User) store.Workout {
+	exercise := sportExercise(parsed.Sport)
+
+	title := strings.TrimSpace(parsed.Name)
+	if title == "" {
+		title = exercise
+	}
+	if len(title) > 255 {
+		title = strings.ToValidUTF8(title[:255], "")
+	}
+
+	entry := store.WorkoutEntry{
+		ExerciseName: exercise,
+		SetCount:     1,
+		OrderIndex:   1,
+		DistanceUnit: string(units.DefaultDistance(preferredUnit(user))),
+	}
+	applyTrackEntry(&entry, summary)
+
+	endedAt := summary.EndedAt
+	return store.Workout{
+		UserID:    user.ID,
+		Title:     title,
+		StartedAt: summary.StartedAt,
+		EndedAt:   &endedAt,
+		TimeZone:  userLocation(user).String(),
+		Entries:   []store.WorkoutEntry{entry},
+	}
+}
+
+func sportExercise(sport string) string {
+	exercise, ok := sportExercises[sport]
+	if !ok {
+		return "Cardio"
+	}
+	return exercise
+}
+
+// trackEntry is the entry the track made when the workout was created, the first one for the track's sport. nil when
+// it's been renamed or deleted since
+func trackEntry(workout *store.Workout, sport string) *store.WorkoutEntry {
+	exercise := sportExercise(sport)
+	for i := range workout.Entries {
+		if strings.EqualFold(workout.Entries[i].ExerciseName, exercise) {
+			return &workout.Entries[i]
+		}
+	}
+	return nil
+}
+
+// applyTrackEntry fills in what an entry gets from its track, the time, distance, heart rate and climbing
+func applyTrackEntry(entry *store.WorkoutEntry, summary track.Summary) {
+	// a recording with no movement in it at all (a treadmill with no footpod, say) still took the time it took
+	seconds := summary.MovingSeconds
+	if seconds == 0 {
+		seconds = summary.ElapsedSeconds
+	}
+	entry.DurationSeconds = &seconds
+
+	entry.Distance = nil
+	if summary.DistanceMeters > 0 {
+		distance := summary.DistanceMeters
+		entry.Distance = &distance
+	}
+
+	entry.AvgHeartRate = summary.AvgHeartRate
+	entry.MaxHeartRate = summary.MaxHeartRate
+
+	entry.ElevationGainMeters = nil
+	if summary.ElevationGainMeters > 0 {
+		elevation := summary.ElevationGainMeters
+		entry.ElevationGainMeters = &elevation
+	}
+}
+
+func applySummary(workoutTrack *store.WorkoutTrack, parsed *track.Track, summary track.Summary) {
+	workoutTrack.Sport = parsed.Sport
+	workoutTrack.Points = summary.Points
+	workoutTrack.DistanceMeters = summary.DistanceMeters
+	workoutTrack.ElapsedSeconds = summary.ElapsedSeconds
+	workoutTrack.MovingSeconds = summary.MovingSeconds
+	workoutTrack.ElevationGainMeters = summary.ElevationGainMeters
+	workoutTrack.AvgSpeedMps = summary.AvgSpeedMps
+	workoutTrack.AvgHeartRate = summary.AvgHeartRate
+	workoutTrack.MaxHeartRate = summary.MaxHeartRate
+}
+
+func newTrackResponse(workoutTrack *store.WorkoutTrack) trackResponse {
+	return trackResponse{WorkoutTrack: workoutTrack, AvgPaceSecondsPerKm: track.PaceSecondsPerKm(workoutTrack.AvgSpeedMps)}
+}
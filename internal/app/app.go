@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/lesi97/internal/api"
 	"github.com/lesi97/internal/middleware"
@@ -17,9 +18,18 @@ type Application struct {
 	DB 				*sql.DB
 	Logger 			*log.Logger
 	Middleware 		middleware.UserMiddleware
+	WorkoutStore 	store.WorkoutStore
 	WorkoutHandler 	*api.WorkoutHandler
 	UserHandler 	*api.UserHandler
 	TokenHandler 	*api.TokenHandler
+	TemplateHandler *api.TemplateHandler
+	PlannedWorkoutHandler *api.PlannedWorkoutHandler
+	CalendarFeedHandler *api.CalendarFeedHandler
+	ExerciseHandler *api.ExerciseHandler
+	PersonalRecordHandler *api.PersonalRecordHandler
+	AnalyticsHandler *api.AnalyticsHandler
+	BodyWeightHandler *api.BodyWeightHandler
+	ImportHandler *api.ImportHandler
 }
 
 func NewApplication() (*Application, error) {
@@ -39,24 +49,75 @@ func NewApplication() (*Application, error) {
 	workoutStore := store.NewPostgresWorkoutStore(pgDB)
 	userStore := store.NewPostgresUserStore(pgDB)
 	tokenStore := store.NewPostgresTokenStore(pgDB)
+	templateStore := store.NewPostgresTemplateStore(pgDB)
+	plannedWorkoutStore := store.NewPostgresPlannedWorkoutStore(pgDB)
+	exerciseStore := store.NewPostgresExerciseStore(pgDB)
+	personalRecordStore := store.NewPostgresPersonalRecordStore(pgDB)
+	analyticsStore := store.NewPostgresAnalyticsStore(pgDB)
+	bodyWeightStore := store.NewPostgresBodyWeightStore(pgDB)
+	importJobStore := store.NewPostgresImportJobStore(pgDB)
+
+	// imports run in this process, so any still going belonged to one that's gone
+	interrupted, err := importJobStore.FailInterruptedImportJobs()
+	if err != nil {
+		return nil, err
+	}
+	if interrupted > 0 {
+		logger.Printf("marked %d interrupted imports as failed", interrupted)
+	}
 
 	middlewareHandler := middleware.UserMiddleware{UserStore: userStore, Logger: logger}
-	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
+	workoutHandler := api.NewWorkoutHandler(workoutStore, exerciseStore, bodyWeightStore, logger)
 	userHandler := api.NewUserHandler(userStore, logger)
 	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
+	templateHandler := api.NewTemplateHandler(templateStore, workoutStore, exerciseStore, bodyWeightStore, logger)
+	plannedWorkoutHandler := api.NewPlannedWorkoutHandler(plannedWorkoutStore, workoutStore, templateStore, logger)
+	calendarFeedHandler := api.NewCalendarFeedHandler(tokenStore, userStore, plannedWorkoutStore, workoutStore, logger)
+	exerciseHandler := api.NewExerciseHandler(exerciseStore, logger)
+	personalRecordHandler := api.NewPersonalRecordHandler(personalRecordStore, logger)
+	analyticsHandler := api.NewAnalyticsHandler(analyticsStore, logger)
+	bodyWeightHandler := api.NewBodyWeightHandler(bodyWeightStore, logger)
+	importHandler := api.NewImportHandler(importJobStore, workoutStore, exerciseStore, bodyWeightStore, logger)
 
 	app := &Application{
 		DB: pgDB,
 		Logger: logger,
 		Middleware: middlewareHandler,
+		WorkoutStore: workoutStore,
 		WorkoutHandler: workoutHandler,
 		UserHandler: userHandler,
 		TokenHandler: tokenHandler,
+		TemplateHandler: templateHandler,
+		PlannedWorkoutHandler: plannedWorkoutHandler,
+		CalendarFeedHandler: calendarFeedHandler,
+		ExerciseHandler: exerciseHandler,
+		PersonalRecordHandler: personalRecordHandler,
+		AnalyticsHandler: analyticsHandler,
+		BodyWeightHandler: bodyWeightHandler,
+		ImportHandler: importHandler,
 	}
 
 	return app, nil
 }
 
+// PurgeTrash permanently deletes workouts that have been in the trash for longer than retention, checking every interval.
+// It never returns so run it in its own goroutine
+func (a *Application) PurgeTrash(retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := a.WorkoutStore.PurgeDeletedWorkouts(time.Now().Add(-retention))
+		if err != nil {
+			a.Logger.Printf("ERROR: PurgeDeletedWorkouts: %v", err)
+		} else if purged > 0 {
+			a.Logger.Printf("purged %d workouts from the trash", purged)
+		}
+
+		<-ticker.C
+	}
+}
+
 func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "Status is available\n") // Fprint allows response to writer??!??!?
 	fmt.Println("Status is available")
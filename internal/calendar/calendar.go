@@ -0,0 +1,115 @@
+package calendar
+
+import (
+	"sort"
+	"time"
+
+	"github.com/lesi97/internal/rrule"
+	"github.com/lesi97/internal/store"
+)
+
+// Occurrence is a single session of a planned workout as it shows up on the calendar
+type Occurrence struct {
+	PlannedWorkoutID int                    `json:"planned_workout_id"`
+	Title            string                 `json:"title"`
+	StartsAt         time.Time              `json:"starts_at"`
+	EndsAt           time.Time              `json:"ends_at"`
+	Status           store.OccurrenceStatus `json:"status"`
+	WorkoutID        *int                   `json:"workout_id"`
+	Note             string                 `json:"note"`
+}
+
+// Location loads a plan's IANA time zone, anything broken falls back to UTC rather than taking the calendar down
+func Location(plan *store.PlannedWorkout) *time.Location {
+	loc, err := time.LoadLocation(plan.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Occurrences expands a single plan into its start times within [from, to)
+// the rule is expanded in the plan's own zone, so "every monday at 7am" means 7am wherever the plan was made
+func Occurrences(plan *store.PlannedWorkout, from time.Time, to time.Time) ([]time.Time, error) {
+	dtstart := plan.StartsAt.In(Location(plan))
+
+	if plan.RRule == "" {
+		if !dtstart.Before(from) && dtstart.Before(to) {
+			return []time.Time{dtstart}, nil
+		}
+		return []time.Time{}, nil
+	}
+
+	rule, err := rrule.Parse(plan.RRule)
+	if err != nil {
+		return nil, err
+	}
+
+	return rule.Between(dtstart, from, to), nil
+}
+
+// IsOccurrence checks t is one of the plan's start times, so records can't be made up for dates that were never planned
+func IsOccurrence(plan *store.PlannedWorkout, t time.Time) (bool, error) {
+	occurrences, err := Occurrences(plan, t, t.Add(time.Second))
+	if err != nil {
+		return false, err
+	}
+
+	for _, occurrence := range occurrences {
+		if occurrence.Equal(t) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Expand builds the calendar for [from, to), merging in whatever has been recorded against each occurrence
+// anything that finished before now without a record is missed, times are returned in loc
+func Expand(plans []*store.PlannedWorkout, records []*store.OccurrenceRecord, from time.Time, to time.Time, loc *time.Location, now time.Time) ([]Occurrence, error) {
+	type recordKey struct {
+		planID int
+		at     int64
+	}
+
+	recorded := map[recordKey]*store.OccurrenceRecord{}
+	for _, record := range records {
+		recorded[recordKey{record.PlannedWorkoutID, record.OccursAt.Unix()}] = record
+	}
+
+	occurrences := []Occurrence{}
+	for _, plan := range plans {
+		startTimes, err := Occurrences(plan, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		duration := time.Duration(plan.DurationMinutes) * time.Minute
+
+		for _, startsAt := range startTimes {
+			occurrence := Occurrence{
+				PlannedWorkoutID: plan.ID,
+				Title:            plan.Title,
+				StartsAt:         startsAt.In(loc),
+				EndsAt:           startsAt.Add(duration).In(loc),
+				Status:           store.OccurrencePlanned,
+			}
+
+			if record, ok := recorded[recordKey{plan.ID, startsAt.Unix()}]; ok {
+				occurrence.Status = record.Status
+				occurrence.WorkoutID = record.WorkoutID
+				occurrence.Note = record.Note
+			} else if occurrence.EndsAt.Before(now) {
+				occurrence.Status = store.OccurrenceMissed
+			}
+
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].StartsAt.Before(occurrences[j].StartsAt)
+	})
+
+	return occurrences, nil
+}
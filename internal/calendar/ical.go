@@ -0,0 +1,85 @@
+package calendar
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// Event is a single VEVENT, times are written out in UTC so we don't need to ship VTIMEZONE definitions
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Start       time.Time
+	End         time.Time
+	Status      string // TENTATIVE, CONFIRMED or CANCELLED
+	Updated     time.Time
+}
+
+const icalTimeFormat = "20060102T150405Z"
+
+// WriteICS writes events as an RFC 5545 VCALENDAR
+func WriteICS(w io.Writer, name string, events []Event) error {
+	buf := bufio.NewWriter(w)
+
+	writeLine(buf, "BEGIN:VCALENDAR")
+	writeLine(buf, "VERSION:2.0")
+	writeLine(buf, "PRODID:-//lesi97//workouts//EN")
+	writeLine(buf, "CALSCALE:GREGORIAN")
+	writeLine(buf, "METHOD:PUBLISH")
+	writeLine(buf, "X-WR-CALNAME:"+escapeText(name))
+
+	for _, event := range events {
+		writeLine(buf, "BEGIN:VEVENT")
+		writeLine(buf, "UID:"+event.UID)
+		writeLine(buf, "DTSTAMP:"+event.Updated.UTC().Format(icalTimeFormat))
+		writeLine(buf, "DTSTART:"+event.Start.UTC().Format(icalTimeFormat))
+		writeLine(buf, "DTEND:"+event.End.UTC().Format(icalTimeFormat))
+		writeLine(buf, "SUMMARY:"+escapeText(event.Summary))
+		if event.Description != "" {
+			writeLine(buf, "DESCRIPTION:"+escapeText(event.Description))
+		}
+		if event.Status != "" {
+			writeLine(buf, "STATUS:"+event.Status)
+		}
+		writeLine(buf, "END:VEVENT")
+	}
+
+	writeLine(buf, "END:VCALENDAR")
+
+	return buf.Flush()
+}
+
+// writeLine folds anything longer than 75 octets onto continuation lines starting with a space, without splitting a UTF-8 character
+func writeLine(buf *bufio.Writer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		buf.WriteString(line[:cut])
+		buf.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74 // the leading space counts towards the next line
+	}
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func escapeText(s string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		`;`, `\;`,
+		`,`, `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	)
+	return replacer.Replace(s)
+}
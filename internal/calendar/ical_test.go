@@ -0,0 +1,43 @@
+package calendar_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lesi97/internal/calendar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteICS(t *testing.T) {
+	start := time.Date(2025, time.January, 6, 7, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	err := calendar.WriteICS(&buf, "test", []calendar.Event{
+		{
+			UID:         "planned-1@workouts",
+			Summary:     "Push; pull, legs",
+			Description: strings.Repeat("long description ", 10),
+			Start:       start,
+			End:         start.Add(time.Hour),
+			Status:      "CONFIRMED",
+			Updated:     start,
+		},
+	})
+	require.NoError(t, err)
+
+	out := buf.String()
+	assert.Contains(t, out, "DTSTART:20250106T070000Z\r\n")
+	assert.Contains(t, out, "DTEND:20250106T080000Z\r\n")
+	assert.Contains(t, out, `SUMMARY:Push\; pull\, legs`+"\r\n")
+
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, line)
+	}
+
+	// unfolding should give back the original description
+	unfolded := strings.ReplaceAll(out, "\r\n ", "")
+	assert.Contains(t, unfolded, "DESCRIPTION:"+strings.Repeat("long description ", 10))
+}
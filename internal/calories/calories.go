@@ -0,0 +1,78 @@
+package calories
+
+import "math"
+
+// DefaultMET is general resistance training in the Compendium of Physical Activities, used for anything without a better figure
+const DefaultMET = 5.0
+
+// ReferenceBodyWeightKg stands in for the user's body weight until they've logged one
+const ReferenceBodyWeightKg = 70.0
+
+// SecondsPerSet is roughly how long a set of reps takes including the rest after it, timed sets use their own duration
+const SecondsPerSet = 60
+
+// PatternMETs are the fallback per movement pattern for exercises that don't carry their own MET value
+var PatternMETs = map[string]float64{
+	"push":      5.0,
+	"pull":      5.0,
+	"squat":     6.0,
+	"hinge":     6.0,
+	"lunge":     5.0,
+	"carry":     6.0,
+	"core":      3.8,
+	"isolation": 3.5,
+	"cardio":    7.0,
+	"other":     DefaultMET,
+}
+
+// Activity is one entry of a workout boiled down to how hard it was and how much of the session it took up
+type Activity struct {
+	MET         float64
+	Sets        int // sets of reps, each counted as SecondsPerSet
+	TimeSeconds int // timed work, planks, runs and the like
+}
+
+// MET picks the exercise's own value when it has one, then its movement pattern's, then DefaultMET
+func MET(met *float64, movementPattern string) float64 {
+	if met != nil && *met > 0 {
+		return *met
+	}
+	if value, ok := PatternMETs[movementPattern]; ok {
+		return value
+	}
+	return DefaultMET
+}
+
+func (a Activity) seconds() float64 {
+	return float64(a.Sets*SecondsPerSet + a.TimeSeconds)
+}
+
+// Estimate works out kcal as MET x body weight (kg) x hours. The MET for the session is the average of the
+// activities weighted by how long each one took, the duration itself comes from the workout as rest and
+// changeovers are part of the session too
+func Estimate(bodyWeightKg float64, durationMinutes int, activities []Activity) int {
+	if bodyWeightKg <= 0 || durationMinutes <= 0 {
+		return 0
+	}
+
+	return int(math.Round(SessionMET(activities) * bodyWeightKg * float64(durationMinutes) / 60))
+}
+
+// SessionMET is the time weighted average MET of the activities, DefaultMET when there's nothing to go on
+func SessionMET(activities []Activity) float64 {
+	var total, weighted float64
+	for _, activity := range activities {
+		seconds := activity.seconds()
+		if seconds <= 0 || activity.MET <= 0 {
+			continue
+		}
+		total += seconds
+		weighted += activity.MET * seconds
+	}
+
+	if total == 0 {
+		return DefaultMET
+	}
+
+	return weighted / total
+}
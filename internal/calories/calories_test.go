@@ -0,0 +1,92 @@
+package calories_test
+
+import (
+	"testing"
+
+	"github.com/lesi97/internal/calories"
+	"github.com/stretchr/testify/assert"
+)
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestMET(t *testing.T) {
+	tests := []struct {
+		name    string
+		met     *float64
+		pattern string
+		want    float64
+	}{
+		{name: "exercise value wins", met: floatPtr(9.8), pattern: "cardio", want: 9.8},
+		{name: "pattern fallback", pattern: "isolation", want: 3.5},
+		{name: "zero is treated as missing", met: floatPtr(0), pattern: "hinge", want: 6.0},
+		{name: "unknown pattern", pattern: "juggling", want: calories.DefaultMET},
+		{name: "nothing at all", want: calories.DefaultMET},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, calories.MET(test.met, test.pattern))
+		})
+	}
+}
+
+func TestSessionMET(t *testing.T) {
+	tests := []struct {
+		name       string
+		activities []calories.Activity
+		want       float64
+	}{
+		{name: "no activities", want: calories.DefaultMET},
+		{
+			name:       "single activity",
+			activities: []calories.Activity{{MET: 6, Sets: 5}},
+			want:       6,
+		},
+		{
+			name: "weighted by time",
+			activities: []calories.Activity{
+				{MET: 3, Sets: 10},          // 600s
+				{MET: 9, TimeSeconds: 1800}, // 1800s
+			},
+			want: 7.5,
+		},
+		{
+			name: "activities with no time are ignored",
+			activities: []calories.Activity{
+				{MET: 3},
+				{MET: 8, Sets: 2},
+			},
+			want: 8,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.InDelta(t, test.want, calories.SessionMET(test.activities), 0.001)
+		})
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		name            string
+		bodyWeightKg    float64
+		durationMinutes int
+		activities      []calories.Activity
+		want            int
+	}{
+		{name: "hour of lifting at 80kg", bodyWeightKg: 80, durationMinutes: 60, activities: []calories.Activity{{MET: 5, Sets: 20}}, want: 400},
+		{name: "half hour run at 70kg", bodyWeightKg: 70, durationMinutes: 30, activities: []calories.Activity{{MET: 9.8, TimeSeconds: 1800}}, want: 343},
+		{name: "no entries uses the default", bodyWeightKg: 60, durationMinutes: 45, want: 225},
+		{name: "no body weight", durationMinutes: 60, activities: []calories.Activity{{MET: 5, Sets: 1}}, want: 0},
+		{name: "no duration", bodyWeightKg: 80, activities: []calories.Activity{{MET: 5, Sets: 1}}, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, calories.Estimate(test.bodyWeightKg, test.durationMinutes, test.activities))
+		})
+	}
+}
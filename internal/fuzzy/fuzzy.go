@@ -0,0 +1,96 @@
+package fuzzy
+
+import (
+	"strings"
+	"unicode"
+)
+
+// gym shorthand that would otherwise never look like the full name
+var abbreviations = map[string]string{
+	"bb":   "barbell",
+	"db":   "dumbbell",
+	"dbs":  "dumbbell",
+	"kb":   "kettlebell",
+	"ez":   "ez bar",
+	"ohp":  "overhead press",
+	"rdl":  "romanian deadlift",
+	"sldl": "stiff leg deadlift",
+	"bw":   "bodyweight",
+}
+
+type Candidate struct {
+	ID    int
+	Names []string // the name and any aliases
+}
+
+// Normalize lowercases, strips punctuation and expands abbreviations so "BB Bench-Press" and "barbell bench press" compare equal
+func Normalize(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	for i, word := range words {
+		if expanded, ok := abbreviations[word]; ok {
+			words[i] = expanded
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// Similarity is the Dice coefficient of the two strings' trigrams (the same idea as pg_trgm), 1 is identical and 0 is nothing in common
+func Similarity(a string, b string) float64 {
+	a, b = Normalize(a), Normalize(b)
+	if a == b {
+		return 1
+	}
+
+	gramsA, gramsB := trigrams(a), trigrams(b)
+	if len(gramsA) == 0 || len(gramsB) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for gram := range gramsA {
+		if gramsB[gram] {
+			shared++
+		}
+	}
+
+	return 2 * float64(shared) / float64(len(gramsA)+len(gramsB))
+}
+
+// BestMatch finds the candidate whose name or alias is most like input, ok is false when nothing reaches threshold
+func BestMatch(input string, candidates []Candidate, threshold float64) (id int, score float64, ok bool) {
+	normalized := Normalize(input)
+	if normalized == "" {
+		return 0, 0, false
+	}
+
+	for _, candidate := range candidates {
+		for _, name := range candidate.Names {
+			s := Similarity(normalized, name)
+			if s > score {
+				id, score = candidate.ID, s
+			}
+		}
+	}
+
+	if score < threshold {
+		return 0, score, false
+	}
+
+	return id, score, true
+}
+
+// trigrams pads each word like pg_trgm does so short words and word starts still count
+func trigrams(s string) map[string]bool {
+	grams := map[string]bool{}
+	for _, word := range strings.Fields(s) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			grams[string(padded[i:i+3])] = true
+		}
+	}
+	return grams
+}
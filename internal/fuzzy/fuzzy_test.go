@@ -0,0 +1,49 @@
+package fuzzy_test
+
+import (
+	"testing"
+
+	"github.com/lesi97/internal/fuzzy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "barbell bench press", fuzzy.Normalize("BB Bench-Press"))
+	assert.Equal(t, "dumbbell row", fuzzy.Normalize("  DB   row!! "))
+	assert.Equal(t, "", fuzzy.Normalize("---"))
+}
+
+func TestBestMatch(t *testing.T) {
+	candidates := []fuzzy.Candidate{
+		{ID: 1, Names: []string{"Barbell Bench Press", "bench press", "bench", "flat bench"}},
+		{ID: 2, Names: []string{"Barbell Back Squat", "squat", "back squat"}},
+		{ID: 3, Names: []string{"Romanian Deadlift", "rdl"}},
+		{ID: 4, Names: []string{"Dumbbell Bench Press", "db bench"}},
+	}
+
+	tests := []struct {
+		input  string
+		wantID int
+		wantOK bool
+	}{
+		{input: "Bench Press", wantID: 1, wantOK: true},
+		{input: "bench", wantID: 1, wantOK: true},
+		{input: "BB Bench", wantID: 1, wantOK: true},
+		{input: "bench pres", wantID: 1, wantOK: true},
+		{input: "RDL", wantID: 3, wantOK: true},
+		{input: "DB bench press", wantID: 4, wantOK: true},
+		{input: "squats", wantID: 2, wantOK: true},
+		{input: "zumba", wantOK: false},
+		{input: "", wantOK: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			id, _, ok := fuzzy.BestMatch(test.input, candidates, 0.6)
+			assert.Equal(t, test.wantOK, ok)
+			if test.wantOK {
+				assert.Equal(t, test.wantID, id)
+			}
+		})
+	}
+}
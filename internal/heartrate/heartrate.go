@@ -0,0 +1,265 @@
+// Package heartrate reads heart rate samples uploaded for a workout and works out what they add up to: time in each
+// zone, a summary, and a series thin enough to chart
+package heartrate
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lesi97/internal/store"
+)
+
+var (
+	ErrInvalidFormat  = errors.New("format must be csv or json")
+	ErrNoSamples      = errors.New("no heart rate samples found")
+	ErrTooManySamples = fmt.Errorf("cannot have more than %d samples", MaxSamples)
+)
+
+// Format is how the samples were sent
+type Format string
+
+const (
+	CSV  Format = "csv"
+	JSON Format = "json"
+)
+
+const (
+	// MaxSamples is a day at one a second, more than any workout needs
+	MaxSamples = 86400
+	MinBPM     = 20
+	MaxBPM     = 250
+	// OffsetGraceSeconds is how long after the workout ends samples can carry on, a strap left running through the
+	// cool down is fine but a time hours past the end is the wrong file or a timestamp in milliseconds
+	OffsetGraceSeconds = 3600
+)
+
+// MaxOffset is the latest a sample can be for a workout that lasted durationMinutes
+func MaxOffset(durationMinutes int) int {
+	return durationMinutes*60 + OffsetGraceSeconds
+}
+
+// ParseFormat reads a format from a query param, "" comes back as "" and Parse works it out from the data
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case "":
+		return "", nil
+	case CSV:
+		return CSV, nil
+	case JSON:
+		return JSON, nil
+	}
+	return "", ErrInvalidFormat
+}
+
+// Parse reads samples as CSV or as a JSON array, anything starting with [ is taken as JSON when format is "".
+// Either way a sample's time can be seconds from start or a timestamp, and samples with no time at all are one a
+// second from start. The samples come back in order with one per second at most, the last reading for a second wins.
+// A sample more than maxOffset seconds after start is an error, see MaxOffset
+//
+// CSV is time,bpm or just bpm, with or without a header. JSON is an array of numbers or of {"time": ..., "bpm": ...}
+func Parse(data []byte, format Format, start time.Time, maxOffset int) ([]store.HeartRateSample, error) {
+	if format == "" {
+		format = CSV
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+			format = JSON
+		}
+	}
+
+	var samples []store.HeartRateSample
+	var err error
+	if format == JSON {
+		samples, err = parseJSON(data, start)
+	} else {
+		samples, err = parseCSV(data, start)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return tidy(samples, maxOffset)
+}
+
+func parseCSV(data []byte, start time.Time) ([]store.HeartRateSample, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	samples := []store.HeartRateSample{}
+	timeColumn, bpmColumn := -1, 0
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line++
+
+		if line == 1 {
+			if len(record) > 1 {
+				timeColumn, bpmColumn = 0, 1
+			}
+			if header, ok := readHeader(record); ok {
+				timeColumn, bpmColumn = header[0], header[1]
+				continue
+			}
+		}
+
+		if bpmColumn >= len(record) {
+			return nil, fmt.Errorf("line %d: bpm is missing", line)
+		}
+
+		bpm, err := strconv.Atoi(strings.TrimSpace(record[bpmColumn]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bpm must be a whole number", line)
+		}
+
+		offset := len(samples)
+		if timeColumn >= 0 {
+			if timeColumn >= len(record) {
+				return nil, fmt.Errorf("line %d: time is missing", line)
+			}
+			offset, err = readOffset(strings.TrimSpace(record[timeColumn]), start)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+
+		samples = append(samples, store.HeartRateSample{OffsetSeconds: offset, BPM: bpm})
+	}
+
+	return samples, nil
+}
+
+// readHeader finds the time and bpm columns when the first line is a header, the time column is -1 when there isn't one
+func readHeader(record []string) ([2]int, bool) {
+	columns := [2]int{-1, -1}
+	for i, name := range record {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "time", "timestamp", "offset", "seconds":
+			columns[0] = i
+		case "bpm", "hr", "heart_rate", "heart rate":
+			columns[1] = i
+		}
+	}
+	return columns, columns[1] >= 0
+}
+
+type sampleJSON struct {
+	Time json.RawMessage `json:"time"`
+	BPM  *int            `json:"bpm"`
+}
+
+func parseJSON(data []byte, start time.Time) ([]store.HeartRateSample, error) {
+	var raw []json.RawMessage
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, errors.New("invalid JSON: expected an array of samples")
+	}
+
+	samples := make([]store.HeartRateSample, 0, len(raw))
+	for i, item := range raw {
+		sample := store.HeartRateSample{OffsetSeconds: i}
+
+		var bpm int
+		if json.Unmarshal(item, &bpm) == nil {
+			sample.BPM = bpm
+			samples = append(samples, sample)
+			continue
+		}
+
+		var object sampleJSON
+		err = json.Unmarshal(item, &object)
+		if err != nil || object.BPM == nil {
+			return nil, fmt.Errorf("samples[%d]: expected a bpm or an object with a bpm", i)
+		}
+		sample.BPM = *object.BPM
+
+		if len(object.Time) > 0 && string(object.Time) != "null" {
+			var value interface{}
+			err = json.Unmarshal(object.Time, &value)
+			if err != nil {
+				return nil, fmt.Errorf("samples[%d]: invalid time", i)
+			}
+			sample.OffsetSeconds, err = readOffset(fmt.Sprint(value), start)
+			if err != nil {
+				return nil, fmt.Errorf("samples[%d]: %w", i, err)
+			}
+		}
+
+		samples = append(samples, sample)
+	}
+
+	return samples, nil
+}
+
+// readOffset reads a time as seconds from start, either as it is or from a timestamp. Offsets are stored as INTEGER
+// so anything that doesn't fit one is turned away here, before it's converted and wraps around
+func readOffset(value string, start time.Time) (int, error) {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return 0, errors.New("time must be seconds from the start of the workout or an RFC 3339 timestamp")
+		}
+		seconds = at.Sub(start).Seconds()
+	}
+
+	// ParseFloat takes these too and they'd slip past the range check below
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, errors.New("time must be seconds from the start of the workout or an RFC 3339 timestamp")
+	}
+	if seconds < math.MinInt32 || seconds > math.MaxInt32 {
+		return 0, errors.New("time is too far from the start of the workout, it should be in seconds")
+	}
+	return int(seconds), nil
+}
+
+// tidy checks every sample and puts them in order with one a second
+func tidy(samples []store.HeartRateSample, maxOffset int) ([]store.HeartRateSample, error) {
+	if len(samples) == 0 {
+		return nil, ErrNoSamples
+	}
+
+	for i, sample := range samples {
+		if sample.BPM < MinBPM || sample.BPM > MaxBPM {
+			return nil, fmt.Errorf("samples[%d]: bpm must be between %d and %d", i, MinBPM, MaxBPM)
+		}
+		if sample.OffsetSeconds < 0 {
+			return nil, fmt.Errorf("samples[%d]: time is before the workout started", i)
+		}
+		if sample.OffsetSeconds > maxOffset {
+			return nil, fmt.Errorf("samples[%d]: time is long after the workout ended", i)
+		}
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].OffsetSeconds < samples[j].OffsetSeconds
+	})
+
+	tidied := samples[:0]
+	for _, sample := range samples {
+		if len(tidied) > 0 && tidied[len(tidied)-1].OffsetSeconds == sample.OffsetSeconds {
+			tidied[len(tidied)-1] = sample
+			continue
+		}
+		tidied = append(tidied, sample)
+	}
+
+	if len(tidied) > MaxSamples {
+		return nil, ErrTooManySamples
+	}
+
+	return tidied, nil
+}
@@ -0,0 +1,115 @@
+package heartrate_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lesi97/internal/heartrate"
+	"github.com/lesi97/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, time.March, 4, 7, 0, 0, 0, time.UTC)
+
+// maxOffset is for an hour long workout
+var maxOffset = heartrate.MaxOffset(60)
+
+func TestParseCSV(t *testing.T) {
+	samples, err := heartrate.Parse([]byte("time,bpm\n0,120\n2,130\n1,125\n2,131\n"), "", start, maxOffset)
+	require.NoError(t, err)
+	assert.Equal(t, []store.HeartRateSample{
+		{OffsetSeconds: 0, BPM: 120},
+		{OffsetSeconds: 1, BPM: 125},
+		{OffsetSeconds: 2, BPM: 131}, // the last reading for a second wins
+	}, samples)
+
+	// just the bpm is one a second
+	samples, err = heartrate.Parse([]byte("100\n101\n102\n"), heartrate.CSV, start, maxOffset)
+	require.NoError(t, err)
+	assert.Equal(t, 2, samples[2].OffsetSeconds)
+
+	samples, err = heartrate.Parse([]byte("2024-03-04T07:00:30Z,140\n"), "", start, maxOffset)
+	require.NoError(t, err)
+	assert.Equal(t, 30, samples[0].OffsetSeconds)
+}
+
+func TestParseJSON(t *testing.T) {
+	samples, err := heartrate.Parse([]byte(`[90, 95, 100]`), "", start, maxOffset)
+	require.NoError(t, err)
+	assert.Equal(t, store.HeartRateSample{OffsetSeconds: 2, BPM: 100}, samples[2])
+
+	samples, err = heartrate.Parse([]byte(`[{"time": 10, "bpm": 150}, {"time": "2024-03-04T07:01:00Z", "bpm": 160}]`), "", start, maxOffset)
+	require.NoError(t, err)
+	assert.Equal(t, []store.HeartRateSample{{OffsetSeconds: 10, BPM: 150}, {OffsetSeconds: 60, BPM: 160}}, samples)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := heartrate.Parse([]byte(`[]`), "", start, maxOffset)
+	assert.ErrorIs(t, err, heartrate.ErrNoSamples)
+
+	_, err = heartrate.Parse([]byte("0,300\n"), "", start, maxOffset)
+	assert.ErrorContains(t, err, "bpm must be between 20 and 250")
+
+	_, err = heartrate.Parse([]byte("2024-03-04T06:59:00Z,120\n"), "", start, maxOffset)
+	assert.ErrorContains(t, err, "before the workout started")
+
+	_, err = heartrate.Parse([]byte(`[{"time": 1}]`), "", start, maxOffset)
+	assert.Error(t, err)
+
+	// epoch milliseconds rather than seconds
+	_, err = heartrate.Parse([]byte(`[{"time": 1709535600000, "bpm": 120}]`), "", start, maxOffset)
+	assert.ErrorContains(t, err, "too far from the start")
+
+	_, err = heartrate.Parse([]byte("NaN,120\n"), "", start, maxOffset)
+	assert.ErrorContains(t, err, "time must be seconds")
+
+	_, err = heartrate.Parse([]byte(`[{"time": "-Inf", "bpm": 120}]`), "", start, maxOffset)
+	assert.ErrorContains(t, err, "time must be seconds")
+
+	_, err = heartrate.Parse([]byte("10800,120\n"), "", start, maxOffset)
+	assert.ErrorContains(t, err, "long after the workout ended")
+
+	_, err = heartrate.ParseFormat("fit")
+	assert.ErrorIs(t, err, heartrate.ErrInvalidFormat)
+}
+
+func TestZones(t *testing.T) {
+	zones := heartrate.Zones(190, 60)
+	require.Len(t, zones, 5)
+	assert.Equal(t, heartrate.Zone{Zone: 1, MinBPM: 125, MaxBPM: 138}, zones[0])
+	assert.Equal(t, heartrate.Zone{Zone: 5, MinBPM: 177, MaxBPM: 190}, zones[4])
+
+	samples := []store.HeartRateSample{
+		{OffsetSeconds: 0, BPM: 100},  // below zone 1
+		{OffsetSeconds: 1, BPM: 130},  // zone 1 for 2s
+		{OffsetSeconds: 3, BPM: 160},  // zone 3, a dropout so only counts for MaxGapSeconds
+		{OffsetSeconds: 60, BPM: 195}, // above max is still zone 5, the last sample is a second
+	}
+	below := heartrate.TimeInZones(samples, zones)
+	assert.Equal(t, 1, below)
+	assert.Equal(t, 2, zones[0].Seconds)
+	assert.Equal(t, heartrate.MaxGapSeconds, zones[2].Seconds)
+	assert.Equal(t, 1, zones[4].Seconds)
+}
+
+func TestSummarizeAndDownsample(t *testing.T) {
+	samples := []store.HeartRateSample{}
+	for i := 0; i < 100; i++ {
+		samples = append(samples, store.HeartRateSample{OffsetSeconds: i, BPM: 100 + i})
+	}
+
+	summary := heartrate.Summarize(samples)
+	assert.Equal(t, 100, summary.Samples)
+	assert.Equal(t, 99, summary.DurationSeconds)
+	assert.Equal(t, 150, summary.AvgBPM)
+	assert.Equal(t, 100, summary.MinBPM)
+	assert.Equal(t, 199, summary.MaxBPM)
+
+	downsampled := heartrate.Downsample(samples, 10)
+	require.Len(t, downsampled, 10)
+	assert.Equal(t, store.HeartRateSample{OffsetSeconds: 0, BPM: 105}, downsampled[0]) // 100 to 109 averaged
+	assert.Equal(t, 90, downsampled[9].OffsetSeconds)
+
+	assert.Equal(t, samples, heartrate.Downsample(samples, 500))
+}
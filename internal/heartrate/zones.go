@@ -0,0 +1,138 @@
+package heartrate
+
+import (
+	"math"
+
+	"github.com/lesi97/internal/store"
+)
+
+// MaxGapSeconds is the longest a single sample counts for, a longer gap is the strap dropping out rather than a
+// heart rate that held steady
+const MaxGapSeconds = 5
+
+// zoneIntensities are the edges of the five zones as a fraction of heart rate reserve
+var zoneIntensities = []float64{0.5, 0.6, 0.7, 0.8, 0.9, 1.0}
+
+// Zone is one heart rate zone and how long was spent in it. MinBPM is inclusive, MaxBPM isn't apart from zone 5's
+type Zone struct {
+	Zone    int `json:"zone"`
+	MinBPM  int `json:"min_bpm"`
+	MaxBPM  int `json:"max_bpm"`
+	Seconds int `json:"seconds"`
+}
+
+// Zones works out the five zones with the Karvonen method, each edge is resting + intensity * (max - resting)
+func Zones(maxHeartRate int, restingHeartRate int) []Zone {
+	reserve := float64(maxHeartRate - restingHeartRate)
+
+	edges := make([]int, len(zoneIntensities))
+	for i, intensity := range zoneIntensities {
+		edges[i] = restingHeartRate + int(math.Round(intensity*reserve))
+	}
+
+	zones := make([]Zone, 0, len(edges)-1)
+	for i := 0; i < len(edges)-1; i++ {
+		zones = append(zones, Zone{Zone: i + 1, MinBPM: edges[i], MaxBPM: edges[i+1]})
+	}
+	return zones
+}
+
+// TimeInZones fills in each zone's seconds, returning the seconds spent below zone 1. Anything above max heart rate
+// counts as zone 5. Each sample lasts until the next one, up to MaxGapSeconds, and the last one lasts a second
+func TimeInZones(samples []store.HeartRateSample, zones []Zone) int {
+	below := 0
+	for i, sample := range samples {
+		seconds := 1
+		if i+1 < len(samples) {
+			seconds = samples[i+1].OffsetSeconds - sample.OffsetSeconds
+			if seconds > MaxGapSeconds {
+				seconds = MaxGapSeconds
+			}
+		}
+
+		zone := -1
+		for z := range zones {
+			if sample.BPM >= zones[z].MinBPM {
+				zone = z
+			}
+		}
+
+		if zone < 0 {
+			below += seconds
+			continue
+		}
+		zones[zone].Seconds += seconds
+	}
+
+	return below
+}
+
+// Summary is what a workout's samples add up to
+type Summary struct {
+	Samples         int `json:"samples"`
+	DurationSeconds int `json:"duration_seconds"` // first sample to last
+	AvgBPM          int `json:"avg_bpm"`
+	MinBPM          int `json:"min_bpm"`
+	MaxBPM          int `json:"max_bpm"`
+}
+
+func Summarize(samples []store.HeartRateSample) Summary {
+	if len(samples) == 0 {
+		return Summary{}
+	}
+
+	summary := Summary{
+		Samples:         len(samples),
+		DurationSeconds: samples[len(samples)-1].OffsetSeconds - samples[0].OffsetSeconds,
+		MinBPM:          samples[0].BPM,
+		MaxBPM:          samples[0].BPM,
+	}
+
+	total := 0
+	for _, sample := range samples {
+		total += sample.BPM
+		if sample.BPM < summary.MinBPM {
+			summary.MinBPM = sample.BPM
+		}
+		if sample.BPM > summary.MaxBPM {
+			summary.MaxBPM = sample.BPM
+		}
+	}
+	summary.AvgBPM = int(math.Round(float64(total) / float64(len(samples))))
+
+	return summary
+}
+
+// Downsample averages the samples into at most points buckets of equal time for charting, each at the offset of
+// its first sample. Samples that already fit come back as they are
+func Downsample(samples []store.HeartRateSample, points int) []store.HeartRateSample {
+	if points <= 0 || len(samples) <= points {
+		return samples
+	}
+
+	first := samples[0].OffsetSeconds
+	span := samples[len(samples)-1].OffsetSeconds - first + 1
+	width := (span + points - 1) / points
+
+	downsampled := make([]store.HeartRateSample, 0, points)
+	bucket, total, count := -1, 0, 0
+	flush := func() {
+		if count > 0 {
+			downsampled[len(downsampled)-1].BPM = int(math.Round(float64(total) / float64(count)))
+		}
+	}
+
+	for _, sample := range samples {
+		b := (sample.OffsetSeconds - first) / width
+		if b != bucket {
+			flush()
+			bucket, total, count = b, 0, 0
+			downsampled = append(downsampled, store.HeartRateSample{OffsetSeconds: sample.OffsetSeconds})
+		}
+		total += sample.BPM
+		count++
+	}
+	flush()
+
+	return downsampled
+}
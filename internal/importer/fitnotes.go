@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/units"
+)
+
+// parseFitNotes reads FitNotes' export, one row per set with only a date to go on, so each day becomes one workout
+// named after the categories trained. The weight column's header says its unit
+func parseFitNotes(t *table, b *builder) error {
+	unit := units.Kilograms
+	weightColumn := "weight (kgs)"
+	if !t.has(weightColumn) && t.has("weight (lbs)") {
+		unit = units.Pounds
+		weightColumn = "weight (lbs)"
+	}
+
+	categories := map[*store.Workout][]string{}
+
+	for _, r := range t.rows {
+		date := r.get("date")
+		startedAt, err := parseTime(date, b.opts.Location, "2006-01-02")
+		if err != nil {
+			b.skip(r.line, err.Error())
+			continue
+		}
+
+		workout := b.workout(date, func() store.Workout {
+			return store.Workout{StartedAt: startedAt}
+		})
+
+		set := store.WorkoutSet{
+			Reps:   positiveInt(r.get("reps")),
+			Weight: weightKg(r.get(weightColumn), unit),
+		}
+		if set.Reps == nil {
+			set.DurationSeconds = clockSeconds(r.get("time"))
+		}
+
+		entry := b.addSet(r.line, workout, r.get("exercise"), r.get("comment"), unit, set)
+		category := r.get("category")
+		if entry >= 0 && category != "" && !containsString(categories[workout], category) {
+			categories[workout] = append(categories[workout], category)
+		}
+	}
+
+	for workout, names := range categories {
+		workout.Title = strings.Join(names, ", ")
+	}
+
+	return nil
+}
+
+// clockSeconds reads FitNotes' h:mm:ss (or m:ss) times, nil when there's no time or it's zero
+func clockSeconds(value string) *int {
+	if value == "" {
+		return nil
+	}
+
+	total := 0
+	for _, part := range strings.Split(value, ":") {
+		amount, err := strconv.Atoi(part)
+		if err != nil {
+			return nil
+		}
+		total = total*60 + amount
+	}
+
+	if total <= 0 {
+		return nil
+	}
+	return &total
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package importer
+
+import (
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/units"
+)
+
+var hevyTimeLayouts = []string{"2 Jan 2006, 15:04", "2 Jan 2006 15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// parseHevy reads Hevy's export, one row per set. Weights are in a weight_kg or weight_lbs column depending on
+// the app's setting, entries sharing a superset_id within a workout become a superset
+func parseHevy(t *table, b *builder) error {
+	unit := units.Kilograms
+	weightColumn := "weight_kg"
+	if !t.has(weightColumn) && t.has("weight_lbs") {
+		unit = units.Pounds
+		weightColumn = "weight_lbs"
+	}
+
+	// superset_id to group position, per workout
+	supersets := map[*store.Workout]map[string]int{}
+
+	for _, r := range t.rows {
+		start := r.get("start_time")
+		startedAt, err := parseTime(start, b.opts.Location, hevyTimeLayouts...)
+		if err != nil {
+			b.skip(r.line, err.Error())
+			continue
+		}
+
+		title := r.get("title")
+		workout := b.workout(start+"|"+title, func() store.Workout {
+			workout := store.Workout{
+				Title:       title,
+				Description: r.get("description"),
+				StartedAt:   startedAt,
+			}
+			if endedAt, err := parseTime(r.get("end_time"), b.opts.Location, hevyTimeLayouts...); err == nil {
+				workout.EndedAt = &endedAt
+			}
+			return workout
+		})
+
+		setType := r.get("set_type")
+		set := store.WorkoutSet{
+			Reps:      positiveInt(r.get("reps")),
+			Weight:    weightKg(r.get(weightColumn), unit),
+			RPE:       rpe(r.get("rpe")),
+			IsWarmup:  setType == "warmup",
+			IsDropSet: setType == "dropset",
+			IsFailure: setType == "failure",
+		}
+		if set.Reps == nil {
+			set.DurationSeconds = positiveInt(r.get("duration_seconds"))
+		}
+
+		entry := b.addSet(r.line, workout, r.get("exercise_title"), r.get("exercise_notes"), unit, set)
+		supersetID := r.get("superset_id")
+		if entry < 0 || supersetID == "" {
+			continue
+		}
+
+		if supersets[workout] == nil {
+			supersets[workout] = map[string]int{}
+		}
+		position, ok := supersets[workout][supersetID]
+		if !ok {
+			position = len(workout.Groups)
+			workout.Groups = append(workout.Groups, store.EntryGroup{Type: "superset"})
+			supersets[workout][supersetID] = position
+		}
+		workout.Entries[entry].GroupIndex = &position
+	}
+
+	return nil
+}
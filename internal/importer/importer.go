@@ -0,0 +1,433 @@
+// Package importer reads the CSV exports of other logging apps (Strong, Hevy and FitNotes) into workouts ready for
+// the store. Weights come out in kg like everything else in the store, exercise names are left the way the app wrote
+// them for the exercise catalog to match up. Distance isn't kept, the apps write
+// it per set and only entries have somewhere to put it
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lesi97/internal/calories"
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/units"
+)
+
+// Format is the app an export came from
+type Format string
+
+const (
+	Strong   Format = "strong"
+	Hevy     Format = "hevy"
+	FitNotes Format = "fitnotes"
+)
+
+var Formats = []Format{Strong, Hevy, FitNotes}
+
+// MaxWarnings caps how many problems are kept, a badly broken file would otherwise have one for every row
+const MaxWarnings = 100
+
+var (
+	ErrUnknownFormat = errors.New("file is not a Strong, Hevy or FitNotes CSV export")
+	ErrInvalidFormat = errors.New("format must be strong, hevy or fitnotes")
+)
+
+// ParseFormat reads a format from a query param, "" comes back as "" so the format gets detected
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case "":
+		return "", nil
+	case Strong:
+		return Strong, nil
+	case Hevy:
+		return Hevy, nil
+	case FitNotes:
+		return FitNotes, nil
+	}
+	return "", ErrInvalidFormat
+}
+
+type Options struct {
+	Format   Format         // detected from the header row when left empty
+	Unit     units.Unit     // what weights are in when the export doesn't say, Strong's doesn't
+	Location *time.Location // none of the apps write a time zone, so their times are read as local times in here
+}
+
+type Result struct {
+	Format   Format
+	Workouts []store.Workout // oldest first
+	Warnings []string        // rows that were skipped or changed, at most MaxWarnings
+	Skipped  int             // rows left out, which can be more than there are warnings
+}
+
+// Parse reads a whole export. It only fails when the file can't be read as one of the formats at all,
+// rows it can't make sense of are skipped with a warning instead
+func Parse(r io.Reader, opts Options) (*Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // Excel likes to add a BOM when a file's been through it
+
+	if opts.Unit == "" {
+		opts.Unit = units.Canonical
+	}
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+
+	t, err := readTable(data)
+	if err != nil {
+		return nil, err
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = t.detect()
+		if format == "" {
+			return nil, ErrUnknownFormat
+		}
+	}
+
+	b := &builder{opts: opts, result: &Result{Format: format}, byKey: map[string]*store.Workout{}}
+
+	switch format {
+	case Strong:
+		err = parseStrong(t, b)
+	case Hevy:
+		err = parseHevy(t, b)
+	case FitNotes:
+		err = parseFitNotes(t, b)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b.finish()
+	return b.result, nil
+}
+
+// table is a CSV file with its columns looked up by header rather than position, as the apps have moved them about between versions
+type table struct {
+	columns map[string]int // lower case header to position
+	rows    []row
+}
+
+type row struct {
+	fields  []string
+	columns map[string]int
+	line    int
+}
+
+// readTable works out whether the file is split on commas or semicolons (older Strong exports) from the header row
+func readTable(data []byte) (*table, error) {
+	header := data
+	if end := bytes.IndexByte(data, '\n'); end >= 0 {
+		header = data[:end]
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, ErrUnknownFormat
+	}
+
+	t := &table{columns: map[string]int{}}
+	for i, name := range records[0] {
+		t.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for i, fields := range records[1:] {
+		if len(fields) == 1 && strings.TrimSpace(fields[0]) == "" {
+			continue
+		}
+		t.rows = append(t.rows, row{fields: fields, columns: t.columns, line: i + 2})
+	}
+
+	return t, nil
+}
+
+func (t *table) has(name string) bool {
+	_, ok := t.columns[name]
+	return ok
+}
+
+func (t *table) detect() Format {
+	switch {
+	case t.has("exercise_title") && t.has("start_time"):
+		return Hevy
+	case t.has("workout name") && t.has("exercise name"):
+		return Strong
+	case t.has("exercise") && t.has("category") && t.has("date"):
+		return FitNotes
+	}
+	return ""
+}
+
+// get is the first of names the file has, trimmed, "" when it has none of them
+func (r row) get(names ...string) string {
+	for _, name := range names {
+		if i, ok := r.columns[name]; ok && i < len(r.fields) {
+			return strings.TrimSpace(r.fields[i])
+		}
+	}
+	return ""
+}
+
+// builder collects sets into entries and entries into workouts in the order they turn up in the file
+type builder struct {
+	opts     Options
+	result   *Result
+	workouts []*store.Workout
+	byKey    map[string]*store.Workout
+}
+
+// workout finds the workout a row belongs to by key, newWorkout is only called the first time a key is seen
+func (b *builder) workout(key string, newWorkout func() store.Workout) *store.Workout {
+	if workout, ok := b.byKey[key]; ok {
+		return workout
+	}
+
+	workout := newWorkout()
+	workout.TimeZone = b.opts.Location.String()
+	workout.Entries = []store.WorkoutEntry{}
+	workout.Groups = []store.EntryGroup{}
+
+	b.byKey[key] = &workout
+	b.workouts = append(b.workouts, &workout)
+	return &workout
+}
+
+// addSet puts the set on the workout's last entry if it's the same exercise, or starts a new entry for it.
+// Returns the entry's index, or -1 when the set had nothing to log and was skipped
+func (b *builder) addSet(line int, workout *store.Workout, exercise string, notes string, unit units.Unit, set store.WorkoutSet) int {
+	if exercise == "" {
+		b.skip(line, "no exercise name")
+		return -1
+	}
+
+	if set.Reps == nil && set.DurationSeconds == nil {
+		b.skip(line, "%s has no reps or time, distance isn't imported", exercise)
+		return -1
+	}
+
+	last := len(workout.Entries) - 1
+	if last < 0 || workout.Entries[last].ExerciseName != exercise {
+		workout.Entries = append(workout.Entries, store.WorkoutEntry{
+			ExerciseName: truncate(exercise, 255),
+			WeightUnit:   string(unit),
+			OrderIndex:   len(workout.Entries) + 1,
+			Sets:         []store.WorkoutSet{},
+		})
+		last++
+	}
+
+	entry := &workout.Entries[last]
+	entry.Sets = append(entry.Sets, set)
+	if notes != "" && !strings.Contains(entry.Notes, notes) {
+		if entry.Notes != "" {
+			entry.Notes += "\n"
+		}
+		entry.Notes += notes
+	}
+
+	return last
+}
+
+func (b *builder) warn(line int, format string, args ...interface{}) {
+	if len(b.result.Warnings) >= MaxWarnings {
+		return
+	}
+
+	message := fmt.Sprintf(format, args...)
+	if line > 0 {
+		message = fmt.Sprintf("line %d: %s", line, message)
+	}
+	b.result.Warnings = append(b.result.Warnings, message)
+}
+
+func (b *builder) skip(line int, format string, args ...interface{}) {
+	b.result.Skipped++
+	b.warn(line, format+", skipped", args...)
+}
+
+// finish tidies the workouts up so they pass the same checks as one sent to POST /workouts
+func (b *builder) finish() {
+	for _, workout := range b.workouts {
+		workout.Title = truncate(strings.TrimSpace(workout.Title), 255)
+		if workout.Title == "" {
+			workout.Title = "Workout"
+		}
+
+		if workout.EndedAt != nil && !workout.EndedAt.After(workout.StartedAt) {
+			workout.EndedAt = nil
+		}
+
+		totalSets := 0
+		for i := range workout.Entries {
+			entry := &workout.Entries[i]
+
+			// an entry's sets all have to be reps or all timed, the first set decides
+			timed := entry.Sets[0].DurationSeconds != nil
+			kept := entry.Sets[:0]
+			for _, set := range entry.Sets {
+				if (set.DurationSeconds != nil) == timed {
+					kept = append(kept, set)
+				}
+			}
+			if len(kept) < len(entry.Sets) {
+				b.result.Skipped += len(entry.Sets) - len(kept)
+				b.warn(0, "%s on %s mixes sets of reps with timed sets, only kept the ones like its first set", entry.ExerciseName, workout.StartedAt.Format("2006-01-02"))
+			}
+			entry.Sets = kept
+
+			for j := range entry.Sets {
+				entry.Sets[j].SetNumber = j + 1
+			}
+			totalSets += len(entry.Sets)
+		}
+
+		b.tidyGroups(workout)
+
+		// nothing to go on when the app didn't record how long it took, so allow the same time per set the calorie estimates do
+		if workout.DurationMinutes <= 0 && workout.EndedAt == nil {
+			workout.DurationMinutes = int(math.Ceil(float64(totalSets*calories.SecondsPerSet) / 60))
+			if workout.DurationMinutes < 1 {
+				workout.DurationMinutes = 1
+			}
+		}
+	}
+
+	sort.SliceStable(b.workouts, func(i, j int) bool {
+		return b.workouts[i].StartedAt.Before(b.workouts[j].StartedAt)
+	})
+
+	b.result.Workouts = make([]store.Workout, len(b.workouts))
+	for i, workout := range b.workouts {
+		b.result.Workouts[i] = *workout
+	}
+}
+
+// tidyGroups drops groups that ended up with a single entry, a superset needs two, and fills in their rounds
+func (b *builder) tidyGroups(workout *store.Workout) {
+	if len(workout.Groups) == 0 {
+		return
+	}
+
+	members := make([][]int, len(workout.Groups))
+	for i, entry := range workout.Entries {
+		if entry.GroupIndex != nil {
+			members[*entry.GroupIndex] = append(members[*entry.GroupIndex], i)
+		}
+	}
+
+	groups := []store.EntryGroup{}
+	for position, entries := range members {
+		if len(entries) < 2 {
+			for _, i := range entries {
+				workout.Entries[i].GroupIndex = nil
+			}
+			continue
+		}
+
+		group := workout.Groups[position]
+		group.Rounds = 1
+		newPosition := len(groups)
+		for _, i := range entries {
+			workout.Entries[i].GroupIndex = &newPosition
+			if len(workout.Entries[i].Sets) > group.Rounds {
+				group.Rounds = len(workout.Entries[i].Sets)
+			}
+		}
+		groups = append(groups, group)
+	}
+
+	workout.Groups = groups
+}
+
+// parseTime tries each layout in turn, all of them read in loc
+func parseTime(value string, loc *time.Location, layouts ...string) (time.Time, error) {
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, value, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date this import understands", value)
+}
+
+// parseNumber is nil for an empty cell, a decimal comma is taken as a point as long as there's only the one
+func parseNumber(value string) *float64 {
+	if value == "" {
+		return nil
+	}
+	if strings.Count(value, ",") == 1 && !strings.Contains(value, ".") {
+		value = strings.Replace(value, ",", ".", 1)
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return nil
+	}
+	return &number
+}
+
+// positiveInt is nil unless the cell holds a number above 0, the apps write 0 into columns a set doesn't use
+func positiveInt(value string) *int {
+	number := parseNumber(value)
+	if number == nil || *number < 1 {
+		return nil
+	}
+
+	rounded := int(math.Round(*number))
+	return &rounded
+}
+
+// weightKg is nil for an empty, zero or negative weight (bodyweight and assisted exercises)
+func weightKg(value string, unit units.Unit) *float64 {
+	number := parseNumber(value)
+	if number == nil || *number <= 0 {
+		return nil
+	}
+
+	kg := units.ToCanonical(*number, unit)
+	return &kg
+}
+
+// rpe is nil outside the 1-10 the store allows
+func rpe(value string) *float64 {
+	number := parseNumber(value)
+	if number == nil || *number < 1 || *number > 10 {
+		return nil
+	}
+	return number
+}
+
+// truncate cuts s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
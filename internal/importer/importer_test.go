@@ -0,0 +1,157 @@
+package importer_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lesi97/internal/importer"
+	"github.com/lesi97/internal/units"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStrong(t *testing.T) {
+	export := "\xef\xbb\xbf" + `Date,Workout Name,Duration,Exercise Name,Set Order,Weight,Reps,Distance,Seconds,Notes,Workout Notes,RPE
+2024-03-04 07:30:00,"Push, heavy",1h 5m,Bench Press (Barbell),W,60,10,0,0,,felt good,
+2024-03-04 07:30:00,"Push, heavy",1h 5m,Bench Press (Barbell),1,100,5,0,0,paused,felt good,8
+2024-03-04 07:30:00,"Push, heavy",1h 5m,Bench Press (Barbell),Rest Timer,0,0,0,180,,felt good,
+2024-03-04 07:30:00,"Push, heavy",1h 5m,Bench Press (Barbell),2,100,5,0,0,,felt good,
+2024-03-04 07:30:00,"Push, heavy",1h 5m,Plank,1,0,0,0,60,,felt good,
+2024-03-04 07:30:00,"Push, heavy",1h 5m,Running,1,0,0,5,0,,felt good,
+2024-03-01 18:00:00,Legs,45m,Squat (Barbell),1,140,3,0,0,,,
+`
+
+	result, err := importer.Parse(strings.NewReader(export), importer.Options{Unit: units.Kilograms, Location: time.UTC})
+	require.NoError(t, err)
+
+	assert.Equal(t, importer.Strong, result.Format)
+	assert.Equal(t, 1, result.Skipped) // the run has distance and nothing else
+	require.Len(t, result.Workouts, 2)
+
+	legs := result.Workouts[0]
+	assert.Equal(t, "Legs", legs.Title)
+	assert.Equal(t, 45, legs.DurationMinutes)
+
+	push := result.Workouts[1]
+	assert.Equal(t, "Push, heavy", push.Title)
+	assert.Equal(t, "felt good", push.Description)
+	assert.Equal(t, 65, push.DurationMinutes)
+	assert.Equal(t, time.Date(2024, time.March, 4, 7, 30, 0, 0, time.UTC), push.StartedAt)
+	require.Len(t, push.Entries, 2)
+
+	bench := push.Entries[0]
+	assert.Equal(t, "Bench Press (Barbell)", bench.ExerciseName)
+	assert.Equal(t, "paused", bench.Notes)
+	assert.Equal(t, "kg", bench.WeightUnit)
+	require.Len(t, bench.Sets, 3)
+	assert.True(t, bench.Sets[0].IsWarmup)
+	assert.Equal(t, 1, bench.Sets[0].SetNumber)
+	assert.Equal(t, 100.0, *bench.Sets[1].Weight)
+	assert.Equal(t, 8.0, *bench.Sets[1].RPE)
+	assert.Equal(t, 180, *bench.Sets[1].RestSeconds)
+	assert.Equal(t, 3, bench.Sets[2].SetNumber)
+
+	plank := push.Entries[1]
+	assert.Nil(t, plank.Sets[0].Reps)
+	assert.Equal(t, 60, *plank.Sets[0].DurationSeconds)
+	assert.Nil(t, plank.Sets[0].Weight)
+	assert.Equal(t, 2, plank.OrderIndex)
+}
+
+func TestParseStrongSemicolons(t *testing.T) {
+	export := `Date;Workout Name;Exercise Name;Set Order;Weight;Weight Unit;Reps;RPE;Distance;Distance Unit;Seconds;Notes;Workout Notes;Workout Duration
+2019-05-20 06:00:00;Morning;Deadlift (Barbell);1;225;lbs;5;;;;;;;50m
+`
+
+	result, err := importer.Parse(strings.NewReader(export), importer.Options{Unit: units.Kilograms})
+	require.NoError(t, err)
+
+	require.Len(t, result.Workouts, 1)
+	entry := result.Workouts[0].Entries[0]
+	assert.Equal(t, "lb", entry.WeightUnit)
+	assert.InDelta(t, 102.06, *entry.Sets[0].Weight, 0.01)
+	assert.Equal(t, 50, result.Workouts[0].DurationMinutes)
+}
+
+func TestParseHevy(t *testing.T) {
+	export := `"title","start_time","end_time","description","exercise_title","superset_id","exercise_notes","set_index","set_type","weight_lbs","reps","distance_miles","duration_seconds","rpe"
+"Upper","4 Mar 2024, 07:30","4 Mar 2024, 08:40","","Pull Up","0","",0,"normal",,8,,,
+"Upper","4 Mar 2024, 07:30","4 Mar 2024, 08:40","","Dip","0","",0,"normal",,10,,,
+"Upper","4 Mar 2024, 07:30","4 Mar 2024, 08:40","","Pull Up","0","",1,"failure",,6,,,9.5
+"Upper","4 Mar 2024, 07:30","4 Mar 2024, 08:40","","Curl","","",0,"dropset",50,10,,,
+`
+
+	loc, err := time.LoadLocation("Europe/London")
+	require.NoError(t, err)
+
+	result, err := importer.Parse(strings.NewReader(export), importer.Options{Location: loc})
+	require.NoError(t, err)
+
+	assert.Equal(t, importer.Hevy, result.Format)
+	require.Len(t, result.Workouts, 1)
+
+	workout := result.Workouts[0]
+	assert.Equal(t, "Europe/London", workout.TimeZone)
+	require.NotNil(t, workout.EndedAt)
+	assert.Equal(t, 70*time.Minute, workout.EndedAt.Sub(workout.StartedAt))
+
+	// pull ups come back after the dips so they're a new entry, all three share the superset
+	require.Len(t, workout.Entries, 4)
+	require.Len(t, workout.Groups, 1)
+	assert.Equal(t, "superset", workout.Groups[0].Type)
+	for _, entry := range workout.Entries[:3] {
+		require.NotNil(t, entry.GroupIndex)
+		assert.Equal(t, 0, *entry.GroupIndex)
+	}
+	assert.True(t, workout.Entries[2].Sets[0].IsFailure)
+	assert.Equal(t, 9.5, *workout.Entries[2].Sets[0].RPE)
+
+	curl := workout.Entries[3]
+	assert.Nil(t, curl.GroupIndex)
+	assert.True(t, curl.Sets[0].IsDropSet)
+	assert.Equal(t, "lb", curl.WeightUnit)
+	assert.InDelta(t, 22.68, *curl.Sets[0].Weight, 0.01)
+}
+
+func TestParseFitNotes(t *testing.T) {
+	export := `Date,Exercise,Category,Weight (kgs),Reps,Distance,Distance Unit,Time,Comment
+2024-03-04,Flat Barbell Bench Press,Chest,80.0,8,,,,
+2024-03-04,Flat Barbell Bench Press,Chest,"82,5",6,,,,last set
+2024-03-04,Rope Pushdown,Triceps,25.0,12,,,,
+2024-03-04,Plank,Abs,,,,,0:01:30,
+2024-03-05,Squat,Legs,120.0,5,,,,
+`
+
+	result, err := importer.Parse(strings.NewReader(export), importer.Options{})
+	require.NoError(t, err)
+
+	assert.Equal(t, importer.FitNotes, result.Format)
+	require.Len(t, result.Workouts, 2)
+
+	workout := result.Workouts[0]
+	assert.Equal(t, "Chest, Triceps, Abs", workout.Title)
+	assert.Equal(t, 4, workout.DurationMinutes) // a minute a set with nothing else to go on
+	require.Len(t, workout.Entries, 3)
+	assert.Equal(t, 82.5, *workout.Entries[0].Sets[1].Weight)
+	assert.Equal(t, "last set", workout.Entries[0].Notes)
+	assert.Equal(t, 90, *workout.Entries[2].Sets[0].DurationSeconds)
+}
+
+func TestParseUnknownFormat(t *testing.T) {
+	_, err := importer.Parse(strings.NewReader("a,b,c\n1,2,3\n"), importer.Options{})
+	assert.ErrorIs(t, err, importer.ErrUnknownFormat)
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := importer.ParseFormat("Hevy")
+	require.NoError(t, err)
+	assert.Equal(t, importer.Hevy, format)
+
+	format, err = importer.ParseFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, importer.Format(""), format)
+
+	_, err = importer.ParseFormat("myfitnesspal")
+	assert.ErrorIs(t, err, importer.ErrInvalidFormat)
+}
@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lesi97/internal/store"
+	"github.com/lesi97/internal/units"
+)
+
+// parseStrong reads Strong's export, one row per set with the workout repeated on each. Newer versions are comma
+// separated with no weight unit (it's whatever the app was set to), older ones use semicolons and have a Weight Unit column
+func parseStrong(t *table, b *builder) error {
+	hasUnit := t.has("weight unit")
+
+	for _, r := range t.rows {
+		date := r.get("date")
+		startedAt, err := parseTime(date, b.opts.Location, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02")
+		if err != nil {
+			b.skip(r.line, err.Error())
+			continue
+		}
+
+		title := r.get("workout name")
+		workout := b.workout(date+"|"+title, func() store.Workout {
+			return store.Workout{
+				Title:           title,
+				Description:     r.get("workout notes"),
+				StartedAt:       startedAt,
+				DurationMinutes: strongDuration(r.get("duration", "workout duration")),
+			}
+		})
+
+		setOrder := strings.ToUpper(r.get("set order"))
+
+		// rest timer rows carry the rest taken after the set before them
+		if setOrder == "REST TIMER" {
+			strongRest(workout, positiveInt(r.get("seconds")))
+			continue
+		}
+
+		unit := b.opts.Unit
+		if hasUnit {
+			unit = appUnit(r.get("weight unit"), unit)
+		}
+
+		set := store.WorkoutSet{
+			Weight:    weightKg(r.get("weight"), unit),
+			RPE:       rpe(r.get("rpe")),
+			IsWarmup:  setOrder == "W",
+			IsDropSet: setOrder == "D",
+			IsFailure: setOrder == "F",
+		}
+		set.Reps = positiveInt(r.get("reps"))
+		if set.Reps == nil {
+			set.DurationSeconds = positiveInt(r.get("seconds"))
+		}
+
+		b.addSet(r.line, workout, r.get("exercise name"), r.get("notes"), unit, set)
+	}
+
+	return nil
+}
+
+// strongDuration reads Strong's "1h 5m" style durations into minutes, a bare number is taken as minutes
+func strongDuration(value string) int {
+	if minutes := parseNumber(value); minutes != nil {
+		return int(math.Ceil(*minutes))
+	}
+
+	var total time.Duration
+	for _, part := range strings.Fields(value) {
+		if len(part) < 2 {
+			continue
+		}
+
+		amount, err := strconv.Atoi(part[:len(part)-1])
+		if err != nil {
+			continue
+		}
+
+		switch part[len(part)-1] {
+		case 'h':
+			total += time.Duration(amount) * time.Hour
+		case 'm':
+			total += time.Duration(amount) * time.Minute
+		case 's':
+			total += time.Duration(amount) * time.Second
+		}
+	}
+
+	return int(math.Ceil(total.Minutes()))
+}
+
+func strongRest(workout *store.Workout, seconds *int) {
+	if seconds == nil || len(workout.Entries) == 0 {
+		return
+	}
+
+	entry := &workout.Entries[len(workout.Entries)-1]
+	entry.Sets[len(entry.Sets)-1].RestSeconds = seconds
+}
+
+// appUnit reads the unit names the apps use, anything unrecognised falls back
+func appUnit(value string, fallback units.Unit) units.Unit {
+	switch strings.ToLower(value) {
+	case "kg", "kgs":
+		return units.Kilograms
+	case "lb", "lbs":
+		return units.Pounds
+	}
+	return fallback
+}
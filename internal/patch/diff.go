@@ -0,0 +1,159 @@
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Change is one value that differs between two JSON documents, ops are named the same as JSON Patch operations
+type Change struct {
+	Op   string      `json:"op"`   // add, remove or replace
+	Path string      `json:"path"` // JSON pointer, into the new document for add and replace and into the old one for remove
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// Diff compares two JSON documents field by field. Arrays of objects that all carry an "id" are matched up by id
+// so removing the first entry of a workout shows up as one removal rather than every entry after it changing
+func Diff(from []byte, to []byte) ([]Change, error) {
+	var fromDoc, toDoc interface{}
+
+	err := json.Unmarshal(from, &fromDoc)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(to, &toDoc)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	diffValue("", fromDoc, toDoc, &changes)
+	return changes, nil
+}
+
+func diffValue(path string, from interface{}, to interface{}, changes *[]Change) {
+	fromObject, fromIsObject := from.(map[string]interface{})
+	toObject, toIsObject := to.(map[string]interface{})
+	if fromIsObject && toIsObject {
+		diffObject(path, fromObject, toObject, changes)
+		return
+	}
+
+	fromArray, fromIsArray := from.([]interface{})
+	toArray, toIsArray := to.([]interface{})
+	if fromIsArray && toIsArray {
+		diffArray(path, fromArray, toArray, changes)
+		return
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, Change{Op: "replace", Path: path, From: from, To: to})
+	}
+}
+
+func diffObject(path string, from map[string]interface{}, to map[string]interface{}, changes *[]Change) {
+	keys := []string{}
+	for key := range from {
+		keys = append(keys, key)
+	}
+	for key := range to {
+		if _, ok := from[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := path + "/" + escapePointer(key)
+		fromValue, inFrom := from[key]
+		toValue, inTo := to[key]
+
+		switch {
+		case !inTo:
+			*changes = append(*changes, Change{Op: "remove", Path: keyPath, From: fromValue})
+		case !inFrom:
+			*changes = append(*changes, Change{Op: "add", Path: keyPath, To: toValue})
+		default:
+			diffValue(keyPath, fromValue, toValue, changes)
+		}
+	}
+}
+
+func diffArray(path string, from []interface{}, to []interface{}, changes *[]Change) {
+	fromIDs, fromKeyed := arrayIDs(from)
+	toIDs, toKeyed := arrayIDs(to)
+
+	if !fromKeyed || !toKeyed {
+		for i := 0; i < len(from) || i < len(to); i++ {
+			indexPath := path + "/" + strconv.Itoa(i)
+			switch {
+			case i >= len(to):
+				*changes = append(*changes, Change{Op: "remove", Path: indexPath, From: from[i]})
+			case i >= len(from):
+				*changes = append(*changes, Change{Op: "add", Path: indexPath, To: to[i]})
+			default:
+				diffValue(indexPath, from[i], to[i], changes)
+			}
+		}
+		return
+	}
+
+	fromByID := map[string]int{}
+	for i, id := range fromIDs {
+		fromByID[id] = i
+	}
+	toByID := map[string]bool{}
+	for _, id := range toIDs {
+		toByID[id] = true
+	}
+
+	for i, id := range fromIDs {
+		if !toByID[id] {
+			*changes = append(*changes, Change{Op: "remove", Path: path + "/" + strconv.Itoa(i), From: from[i]})
+		}
+	}
+
+	for i, id := range toIDs {
+		indexPath := path + "/" + strconv.Itoa(i)
+		fromIndex, ok := fromByID[id]
+		if !ok {
+			*changes = append(*changes, Change{Op: "add", Path: indexPath, To: to[i]})
+			continue
+		}
+		diffValue(indexPath, from[fromIndex], to[i], changes)
+	}
+}
+
+// arrayIDs is the "id" of every element, false unless every element is an object with a unique id
+func arrayIDs(values []interface{}) ([]string, bool) {
+	ids := make([]string, 0, len(values))
+	seen := map[string]bool{}
+	for _, value := range values {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		id, ok := object["id"]
+		if !ok || id == nil {
+			return nil, false
+		}
+
+		key, err := json.Marshal(id)
+		if err != nil || seen[string(key)] {
+			return nil, false
+		}
+		seen[string(key)] = true
+		ids = append(ids, string(key))
+	}
+	return ids, true
+}
+
+func escapePointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
@@ -0,0 +1,81 @@
+package patch_test
+
+import (
+	"testing"
+
+	"github.com/lesi97/internal/patch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want []patch.Change
+	}{
+		{
+			name: "identical",
+			from: `{"title": "push day", "entries": [{"id": 1, "reps": 10}]}`,
+			to:   `{"title": "push day", "entries": [{"id": 1, "reps": 10}]}`,
+			want: []patch.Change{},
+		},
+		{
+			name: "changed field",
+			from: `{"title": "push day", "duration_minutes": 60}`,
+			to:   `{"title": "pull day", "duration_minutes": 60}`,
+			want: []patch.Change{{Op: "replace", Path: "/title", From: "push day", To: "pull day"}},
+		},
+		{
+			name: "added and removed fields",
+			from: `{"title": "push day", "notes": "old"}`,
+			to:   `{"title": "push day", "session_rpe": 8}`,
+			want: []patch.Change{
+				{Op: "remove", Path: "/notes", From: "old"},
+				{Op: "add", Path: "/session_rpe", To: float64(8)},
+			},
+		},
+		{
+			name: "null to a value",
+			from: `{"weight": null}`,
+			to:   `{"weight": 100}`,
+			want: []patch.Change{{Op: "replace", Path: "/weight", From: nil, To: float64(100)}},
+		},
+		{
+			name: "entries matched by id",
+			from: `{"entries": [{"id": 1, "reps": 10}, {"id": 2, "reps": 8}]}`,
+			to:   `{"entries": [{"id": 2, "reps": 6}, {"id": 3, "reps": 12}]}`,
+			want: []patch.Change{
+				{Op: "remove", Path: "/entries/0", From: map[string]interface{}{"id": float64(1), "reps": float64(10)}},
+				{Op: "replace", Path: "/entries/0/reps", From: float64(8), To: float64(6)},
+				{Op: "add", Path: "/entries/1", To: map[string]interface{}{"id": float64(3), "reps": float64(12)}},
+			},
+		},
+		{
+			name: "arrays without ids are compared by position",
+			from: `{"aliases": ["bench", "flat bench"]}`,
+			to:   `{"aliases": ["bench"]}`,
+			want: []patch.Change{{Op: "remove", Path: "/aliases/1", From: "flat bench"}},
+		},
+		{
+			name: "keys are escaped",
+			from: `{"a/b": 1}`,
+			to:   `{"a/b": 2}`,
+			want: []patch.Change{{Op: "replace", Path: "/a~1b", From: float64(1), To: float64(2)}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := patch.Diff([]byte(test.from), []byte(test.to))
+			require.NoError(t, err)
+			assert.Equal(t, test.want, changes)
+		})
+	}
+}
+
+func TestDiffInvalidJSON(t *testing.T) {
+	_, err := patch.Diff([]byte(`{`), []byte(`{}`))
+	assert.Error(t, err)
+}
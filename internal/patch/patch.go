@@ -0,0 +1,337 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid patch")
+	ErrTestFailed   = errors.New("patch test operation failed")
+)
+
+// MergePatch applies an RFC 7396 merge patch to original
+// objects are merged recursively, null removes a key and anything else (arrays included) replaces the value outright
+func MergePatch(original []byte, mergePatch []byte) ([]byte, error) {
+	var doc interface{}
+	err := json.Unmarshal(original, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var patchDoc interface{}
+	err = json.Unmarshal(mergePatch, &patchDoc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	return json.Marshal(mergeValue(doc, patchDoc))
+}
+
+func mergeValue(target interface{}, patchValue interface{}) interface{} {
+	patchObject, ok := patchValue.(map[string]interface{})
+	if !ok {
+		return patchValue
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+type operation struct {
+	Op    string           `json:"op"`
+	Path  *string          `json:"path"`
+	From  *string          `json:"from"`
+	Value *json.RawMessage `json:"value"` // pointer so we can tell a missing value apart from an explicit null
+}
+
+// ApplyJSONPatch applies an RFC 6902 JSON Patch document (an array of operations) to original
+// operations are applied in order and the whole patch fails if any one of them does
+func ApplyJSONPatch(original []byte, jsonPatch []byte) ([]byte, error) {
+	var doc interface{}
+	err := json.Unmarshal(original, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []operation
+	err = json.Unmarshal(jsonPatch, &ops)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	for i, op := range ops {
+		doc, err = applyOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i, op.Op, err)
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+func applyOperation(doc interface{}, op operation) (interface{}, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("%w: missing path", ErrInvalidPatch)
+	}
+
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+		}
+
+		var value interface{}
+		err = json.Unmarshal(*op.Value, &value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			return replace(doc, path, value)
+		default:
+			current, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, fmt.Errorf("%w: %s", ErrTestFailed, *op.Path)
+			}
+			return doc, nil
+		}
+
+	case "remove":
+		doc, _, err = remove(doc, path)
+		return doc, err
+
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("%w: missing from", ErrInvalidPatch)
+		}
+
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "move" {
+			if strings.HasPrefix(*op.Path, *op.From+"/") {
+				return nil, fmt.Errorf("%w: cannot move a value into one of its own children", ErrInvalidPatch)
+			}
+
+			doc, value, err := remove(doc, from)
+			if err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		}
+
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, deepCopy(value))
+
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped reference tokens, "" is the whole document
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: path %q must start with /", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~") // order matters, see RFC 6901 section 4
+	}
+
+	return tokens, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	node := doc
+	for _, token := range path {
+		switch container := node.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q does not exist", ErrInvalidPatch, token)
+			}
+			node = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = container[index]
+		default:
+			return nil, fmt.Errorf("%w: cannot index into %q", ErrInvalidPatch, token)
+		}
+	}
+
+	return node, nil
+}
+
+// update walks down to the parent of the last token and hands it to fn, then rebuilds the path back up
+// with whatever fn returned so that slices that grew or shrank get written back into their parents
+func update(node interface{}, path []string, fn func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+
+	child, err := get(node, path[:1])
+	if err != nil {
+		return nil, err
+	}
+
+	newChild, err := update(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := node.(type) {
+	case map[string]interface{}:
+		container[path[0]] = newChild
+	case []interface{}:
+		index, _ := arrayIndex(path[0], len(container)-1)
+		container[index] = newChild
+	}
+
+	return node, nil
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(doc, path, func(parent interface{}, key string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			container[key] = value
+			return container, nil
+		case []interface{}:
+			if key == "-" {
+				return append(container, value), nil
+			}
+
+			index, err := arrayIndex(key, len(container))
+			if err != nil {
+				return nil, err
+			}
+
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		default:
+			return nil, fmt.Errorf("%w: cannot add to %q", ErrInvalidPatch, key)
+		}
+	})
+}
+
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+
+	var removed interface{}
+	doc, err := update(doc, path, func(parent interface{}, key string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			value, ok := container[key]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q does not exist", ErrInvalidPatch, key)
+			}
+			removed = value
+			delete(container, key)
+			return container, nil
+		case []interface{}:
+			index, err := arrayIndex(key, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = container[index]
+			return append(container[:index], container[index+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%w: cannot remove %q", ErrInvalidPatch, key)
+		}
+	})
+
+	return doc, removed, err
+}
+
+func replace(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	doc, _, err := remove(doc, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return add(doc, path, value)
+}
+
+// arrayIndex parses an array reference token, max is the largest index allowed (len for add, len-1 everywhere else)
+func arrayIndex(token string, max int) (int, error) {
+	// RFC 6901 doesn't allow leading zeros or signs
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.ContainsAny(token, "+-") {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index > max {
+		return 0, fmt.Errorf("%w: array index %q out of range", ErrInvalidPatch, token)
+	}
+
+	return index, nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	js, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+
+	var copied interface{}
+	json.Unmarshal(js, &copied)
+	return copied
+}
@@ -0,0 +1,131 @@
+package patch_test
+
+import (
+	"testing"
+
+	"github.com/lesi97/internal/patch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		patch    string
+		want     string
+	}{
+		{
+			name:     "replace a field",
+			original: `{"title": "push day", "duration_minutes": 60}`,
+			patch:    `{"title": "pull day"}`,
+			want:     `{"title": "pull day", "duration_minutes": 60}`,
+		},
+		{
+			name:     "null removes a field",
+			original: `{"title": "push day", "description": "upper body"}`,
+			patch:    `{"description": null}`,
+			want:     `{"title": "push day"}`,
+		},
+		{
+			name:     "arrays are replaced not merged",
+			original: `{"entries": [{"id": 1}, {"id": 2}]}`,
+			patch:    `{"entries": [{"id": 2}]}`,
+			want:     `{"entries": [{"id": 2}]}`,
+		},
+		{
+			name:     "nested objects are merged",
+			original: `{"a": {"b": "c", "d": "e"}}`,
+			patch:    `{"a": {"b": "x", "d": null}}`,
+			want:     `{"a": {"b": "x"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := patch.MergePatch([]byte(test.original), []byte(test.patch))
+			require.NoError(t, err)
+			assert.JSONEq(t, test.want, string(got))
+		})
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	original := `{"title": "push day", "entries": [{"id": 1, "sets": 3}, {"id": 2, "sets": 4}]}`
+
+	tests := []struct {
+		name    string
+		patch   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "replace a field",
+			patch: `[{"op": "replace", "path": "/title", "value": "pull day"}]`,
+			want:  `{"title": "pull day", "entries": [{"id": 1, "sets": 3}, {"id": 2, "sets": 4}]}`,
+		},
+		{
+			name:  "remove an entry",
+			patch: `[{"op": "remove", "path": "/entries/0"}]`,
+			want:  `{"title": "push day", "entries": [{"id": 2, "sets": 4}]}`,
+		},
+		{
+			name:  "append an entry",
+			patch: `[{"op": "add", "path": "/entries/-", "value": {"id": 0, "sets": 5}}]`,
+			want:  `{"title": "push day", "entries": [{"id": 1, "sets": 3}, {"id": 2, "sets": 4}, {"id": 0, "sets": 5}]}`,
+		},
+		{
+			name:  "insert an entry",
+			patch: `[{"op": "add", "path": "/entries/1", "value": {"id": 0, "sets": 5}}]`,
+			want:  `{"title": "push day", "entries": [{"id": 1, "sets": 3}, {"id": 0, "sets": 5}, {"id": 2, "sets": 4}]}`,
+		},
+		{
+			name:  "move an entry",
+			patch: `[{"op": "move", "from": "/entries/1", "path": "/entries/0"}]`,
+			want:  `{"title": "push day", "entries": [{"id": 2, "sets": 4}, {"id": 1, "sets": 3}]}`,
+		},
+		{
+			name:  "copy a value",
+			patch: `[{"op": "copy", "from": "/entries/0/sets", "path": "/entries/1/sets"}]`,
+			want:  `{"title": "push day", "entries": [{"id": 1, "sets": 3}, {"id": 2, "sets": 3}]}`,
+		},
+		{
+			name:  "passing test then replace",
+			patch: `[{"op": "test", "path": "/entries/0/sets", "value": 3}, {"op": "replace", "path": "/entries/0/sets", "value": 5}]`,
+			want:  `{"title": "push day", "entries": [{"id": 1, "sets": 5}, {"id": 2, "sets": 4}]}`,
+		},
+		{
+			name:    "failing test",
+			patch:   `[{"op": "test", "path": "/title", "value": "leg day"}]`,
+			wantErr: patch.ErrTestFailed,
+		},
+		{
+			name:    "index out of range",
+			patch:   `[{"op": "remove", "path": "/entries/5"}]`,
+			wantErr: patch.ErrInvalidPatch,
+		},
+		{
+			name:    "unknown op",
+			patch:   `[{"op": "explode", "path": "/title"}]`,
+			wantErr: patch.ErrInvalidPatch,
+		},
+		{
+			name:    "replace missing field",
+			patch:   `[{"op": "replace", "path": "/nope", "value": 1}]`,
+			wantErr: patch.ErrInvalidPatch,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := patch.ApplyJSONPatch([]byte(original), []byte(test.patch))
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.JSONEq(t, test.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package records
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+var ErrUnknownFormula = errors.New("formula must be one of epley, brzycki or lombardi")
+
+// Formula is how a one rep max gets estimated from a set of more than one rep
+type Formula string
+
+const (
+	Epley    Formula = "epley"
+	Brzycki  Formula = "brzycki"
+	Lombardi Formula = "lombardi"
+)
+
+var Formulas = []Formula{Epley, Brzycki, Lombardi}
+
+type Kind string
+
+const (
+	HeaviestWeight     Kind = "heaviest_weight"
+	MostReps           Kind = "most_reps" // at a given weight, so 10 reps at 60kg and 5 at 100kg are both records
+	EstimatedOneRepMax Kind = "estimated_1rm"
+	MostVolume         Kind = "most_volume" // sets x reps x weight across the whole session
+)
+
+// Lift is one logged entry boiled down to what records care about
+type Lift struct {
+	ExerciseID int
+	EntryID    int
+	Sets       int
+	Reps       int
+	Weight     float64 // 0 for bodyweight
+}
+
+type Record struct {
+	Kind       Kind
+	Formula    Formula // only set for EstimatedOneRepMax
+	ExerciseID int
+	EntryID    int // 0 for MostVolume as it covers every entry of the exercise
+	Value      float64
+	Weight     float64
+	Reps       int
+}
+
+func ParseFormula(s string) (Formula, error) {
+	if s == "" {
+		return Epley, nil
+	}
+
+	for _, formula := range Formulas {
+		if string(formula) == s {
+			return formula, nil
+		}
+	}
+
+	return "", ErrUnknownFormula
+}
+
+// EstimateOneRepMax returns 0 where the formula doesn't give a sensible answer, Brzycki falls apart past 36 reps
+func EstimateOneRepMax(formula Formula, weight float64, reps int) float64 {
+	if weight <= 0 || reps <= 0 {
+		return 0
+	}
+
+	if reps == 1 {
+		return weight
+	}
+
+	switch formula {
+	case Epley:
+		return weight * (1 + float64(reps)/30)
+	case Brzycki:
+		if reps >= 37 {
+			return 0
+		}
+		return weight * 36 / float64(37-reps)
+	case Lombardi:
+		return weight * math.Pow(float64(reps), 0.1)
+	}
+
+	return 0
+}
+
+// Key identifies what a record is a record of, two records with the same key are competing for the same spot
+func (r Record) Key() string {
+	key := fmt.Sprintf("%d:%s", r.ExerciseID, r.Kind)
+	switch r.Kind {
+	case EstimatedOneRepMax:
+		key += ":" + string(r.Formula)
+	case MostReps:
+		key += ":" + strconv.FormatFloat(r.Weight, 'f', 2, 64)
+	}
+	return key
+}
+
+// Best picks the best value for each key out of a single session's lifts
+func Best(lifts []Lift) []Record {
+	best := map[string]Record{}
+	volume := map[int]float64{}
+
+	consider := func(record Record) {
+		current, ok := best[record.Key()]
+		if !ok || record.Value > current.Value {
+			best[record.Key()] = record
+		}
+	}
+
+	for _, lift := range lifts {
+		if lift.ExerciseID == 0 || lift.Reps <= 0 || lift.Sets <= 0 || lift.Weight < 0 {
+			continue
+		}
+
+		consider(Record{Kind: MostReps, ExerciseID: lift.ExerciseID, EntryID: lift.EntryID, Value: float64(lift.Reps), Weight: lift.Weight, Reps: lift.Reps})
+
+		if lift.Weight == 0 {
+			continue // nothing else means anything without a load
+		}
+
+		consider(Record{Kind: HeaviestWeight, ExerciseID: lift.ExerciseID, EntryID: lift.EntryID, Value: lift.Weight, Weight: lift.Weight, Reps: lift.Reps})
+
+		for _, formula := range Formulas {
+			e1rm := EstimateOneRepMax(formula, lift.Weight, lift.Reps)
+			if e1rm > 0 {
+				consider(Record{Kind: EstimatedOneRepMax, Formula: formula, ExerciseID: lift.ExerciseID, EntryID: lift.EntryID, Value: round(e1rm), Weight: lift.Weight, Reps: lift.Reps})
+			}
+		}
+
+		volume[lift.ExerciseID] += float64(lift.Sets*lift.Reps) * lift.Weight
+	}
+
+	for exerciseID, total := range volume {
+		consider(Record{Kind: MostVolume, ExerciseID: exerciseID, Value: round(total)})
+	}
+
+	records := make([]Record, 0, len(best))
+	for _, record := range best {
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Key() < records[j].Key()
+	})
+
+	return records
+}
+
+// New returns the candidates that beat the previous best for their key, anything without a previous best is a record by default
+func New(candidates []Record, previous map[string]float64) []Record {
+	records := []Record{}
+	for _, candidate := range candidates {
+		best, ok := previous[candidate.Key()]
+		if !ok || candidate.Value > best {
+			records = append(records, candidate)
+		}
+	}
+	return records
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
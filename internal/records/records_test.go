@@ -0,0 +1,89 @@
+package records_test
+
+import (
+	"testing"
+
+	"github.com/lesi97/internal/records"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateOneRepMax(t *testing.T) {
+	tests := []struct {
+		name    string
+		formula records.Formula
+		weight  float64
+		reps    int
+		want    float64
+	}{
+		{name: "epley", formula: records.Epley, weight: 100, reps: 10, want: 133.33},
+		{name: "brzycki", formula: records.Brzycki, weight: 100, reps: 10, want: 133.33},
+		{name: "lombardi", formula: records.Lombardi, weight: 100, reps: 10, want: 125.89},
+		{name: "single rep is the weight", formula: records.Brzycki, weight: 140, reps: 1, want: 140},
+		{name: "brzycki past 36 reps", formula: records.Brzycki, weight: 20, reps: 40, want: 0},
+		{name: "no weight", formula: records.Epley, weight: 0, reps: 10, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.InDelta(t, test.want, records.EstimateOneRepMax(test.formula, test.weight, test.reps), 0.01)
+		})
+	}
+}
+
+func TestParseFormula(t *testing.T) {
+	formula, err := records.ParseFormula("")
+	require.NoError(t, err)
+	assert.Equal(t, records.Epley, formula)
+
+	_, err = records.ParseFormula("wathan")
+	assert.ErrorIs(t, err, records.ErrUnknownFormula)
+}
+
+func TestBestAndNew(t *testing.T) {
+	lifts := []records.Lift{
+		{ExerciseID: 1, EntryID: 10, Sets: 3, Reps: 5, Weight: 100},
+		{ExerciseID: 1, EntryID: 11, Sets: 2, Reps: 8, Weight: 80},
+		{ExerciseID: 2, EntryID: 12, Sets: 3, Reps: 12, Weight: 0}, // pull ups
+		{ExerciseID: 0, EntryID: 13, Sets: 3, Reps: 5, Weight: 50}, // not in the catalog
+	}
+
+	best := records.Best(lifts)
+
+	byKey := map[string]records.Record{}
+	for _, record := range best {
+		byKey[record.Key()] = record
+	}
+
+	assert.Equal(t, 100.0, byKey["1:heaviest_weight"].Value)
+	assert.Equal(t, 10, byKey["1:heaviest_weight"].EntryID)
+	assert.Equal(t, 5.0, byKey["1:most_reps:100.00"].Value)
+	assert.Equal(t, 8.0, byKey["1:most_reps:80.00"].Value)
+	assert.Equal(t, 3*5*100.0+2*8*80.0, byKey["1:most_volume"].Value)
+	assert.Equal(t, 116.67, byKey["1:estimated_1rm:epley"].Value)
+	assert.Equal(t, 10, byKey["1:estimated_1rm:epley"].EntryID)
+	assert.Equal(t, 12.0, byKey["2:most_reps:0.00"].Value)
+	assert.NotContains(t, byKey, "2:heaviest_weight")
+	assert.NotContains(t, byKey, "0:heaviest_weight")
+
+	previous := map[string]float64{
+		"1:heaviest_weight":     120,
+		"1:most_reps:100.00":    5, // equalling a record isn't a new one
+		"1:most_volume":         1000,
+		"1:estimated_1rm:epley": 130,
+	}
+
+	newRecords := records.New(best, previous)
+
+	newKeys := []string{}
+	for _, record := range newRecords {
+		newKeys = append(newKeys, record.Key())
+	}
+
+	assert.Contains(t, newKeys, "1:most_reps:80.00")
+	assert.Contains(t, newKeys, "1:most_volume")
+	assert.Contains(t, newKeys, "2:most_reps:0.00")
+	assert.NotContains(t, newKeys, "1:heaviest_weight")
+	assert.NotContains(t, newKeys, "1:most_reps:100.00")
+	assert.NotContains(t, newKeys, "1:estimated_1rm:epley")
+}
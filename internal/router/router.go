@@ -11,10 +11,71 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 	routes.Group(func (r chi.Router) {
 		r.Use(app.Middleware.Authenticate)
 
+		r.Get("/workouts", app.Middleware.RequireUser(app.WorkoutHandler.HandleListWorkouts))
+		r.Get("/workouts/search", app.Middleware.RequireUser(app.WorkoutHandler.HandleSearchWorkouts))
+		r.Get("/workouts/export", app.Middleware.RequireUser(app.WorkoutHandler.HandleExportWorkouts))
 		r.Get("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetWorkoutById)) // {id} is chi specific handle for slugs
 		r.Post("/workouts", app.Middleware.RequireUser(app.WorkoutHandler.HandleCreateWorkout))
+		r.Post("/workouts/bulk", app.Middleware.RequireUser(app.WorkoutHandler.HandleBulkCreateWorkouts))
+		r.Post("/workouts/tracks", app.Middleware.RequireUser(app.WorkoutHandler.HandleUploadTrack))
 		r.Put("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleUpdateWorkout))
+		r.Patch("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandlePatchWorkout))
 		r.Delete("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleDeleteWorkout))
+		r.Post("/workouts/{id}/restore", app.Middleware.RequireUser(app.WorkoutHandler.HandleRestoreWorkout))
+		r.Get("/workouts/{id}/revisions", app.Middleware.RequireUser(app.WorkoutHandler.HandleListWorkoutRevisions))
+		r.Get("/workouts/{id}/revisions/diff", app.Middleware.RequireUser(app.WorkoutHandler.HandleDiffWorkoutRevisions))
+		r.Get("/workouts/{id}/revisions/{rev}", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetWorkoutRevision))
+		r.Post("/workouts/{id}/revisions/{rev}/revert", app.Middleware.RequireUser(app.WorkoutHandler.HandleRevertWorkout))
+		r.Get("/workouts/{id}/track", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetWorkoutTrack))
+		r.Post("/workouts/{id}/track/reprocess", app.Middleware.RequireUser(app.WorkoutHandler.HandleReprocessWorkoutTrack))
+		r.Get("/workouts/{id}/heart-rate", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetHeartRate))
+		r.Post("/workouts/{id}/heart-rate", app.Middleware.RequireUser(app.WorkoutHandler.HandleUploadHeartRate))
+		r.Get("/trash", app.Middleware.RequireUser(app.WorkoutHandler.HandleListTrash))
+
+		r.Get("/workouts/{id}/entries", app.Middleware.RequireUser(app.WorkoutHandler.HandleListWorkoutEntries))
+		r.Post("/workouts/{id}/entries", app.Middleware.RequireUser(app.WorkoutHandler.HandleCreateWorkoutEntry))
+		r.Post("/workouts/{id}/entries:reorder", app.Middleware.RequireUser(app.WorkoutHandler.HandleReorderWorkoutEntries))
+		r.Get("/workouts/{id}/entries/{entryId}", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetWorkoutEntry))
+		r.Patch("/workouts/{id}/entries/{entryId}", app.Middleware.RequireUser(app.WorkoutHandler.HandlePatchWorkoutEntry))
+		r.Delete("/workouts/{id}/entries/{entryId}", app.Middleware.RequireUser(app.WorkoutHandler.HandleDeleteWorkoutEntry))
+		r.Post("/workouts/{id}/save-as-template", app.Middleware.RequireUser(app.TemplateHandler.HandleSaveWorkoutAsTemplate))
+
+		r.Get("/templates", app.Middleware.RequireUser(app.TemplateHandler.HandleListTemplates))
+		r.Post("/templates", app.Middleware.RequireUser(app.TemplateHandler.HandleCreateTemplate))
+		r.Get("/templates/{id}", app.Middleware.RequireUser(app.TemplateHandler.HandleGetTemplateById))
+		r.Put("/templates/{id}", app.Middleware.RequireUser(app.TemplateHandler.HandleUpdateTemplate))
+		r.Delete("/templates/{id}", app.Middleware.RequireUser(app.TemplateHandler.HandleDeleteTemplate))
+		r.Post("/templates/{id}/start", app.Middleware.RequireUser(app.TemplateHandler.HandleStartTemplate))
+
+		r.Get("/exercises", app.Middleware.RequireUser(app.ExerciseHandler.HandleListExercises))
+		r.Get("/exercises/match", app.Middleware.RequireUser(app.ExerciseHandler.HandleMatchExercise))
+		r.Post("/exercises", app.Middleware.RequireUser(app.ExerciseHandler.HandleCreateExercise))
+		r.Get("/exercises/{id}", app.Middleware.RequireUser(app.ExerciseHandler.HandleGetExerciseById))
+		r.Put("/exercises/{id}", app.Middleware.RequireUser(app.ExerciseHandler.HandleUpdateExercise))
+		r.Delete("/exercises/{id}", app.Middleware.RequireUser(app.ExerciseHandler.HandleDeleteExercise))
+
+		r.Get("/imports", app.Middleware.RequireUser(app.ImportHandler.HandleListImports))
+		r.Post("/imports", app.Middleware.RequireUser(app.ImportHandler.HandleCreateImport))
+		r.Get("/imports/{id}", app.Middleware.RequireUser(app.ImportHandler.HandleGetImport))
+
+		r.Get("/analytics", app.Middleware.RequireUser(app.AnalyticsHandler.HandleGetAnalytics))
+		r.Get("/analytics/load", app.Middleware.RequireUser(app.AnalyticsHandler.HandleGetLoad))
+
+		r.Get("/planned-workouts", app.Middleware.RequireUser(app.PlannedWorkoutHandler.HandleListPlannedWorkouts))
+		r.Post("/planned-workouts", app.Middleware.RequireUser(app.PlannedWorkoutHandler.HandleCreatePlannedWorkout))
+		r.Get("/planned-workouts/{id}", app.Middleware.RequireUser(app.PlannedWorkoutHandler.HandleGetPlannedWorkoutById))
+		r.Put("/planned-workouts/{id}", app.Middleware.RequireUser(app.PlannedWorkoutHandler.HandleUpdatePlannedWorkout))
+		r.Delete("/planned-workouts/{id}", app.Middleware.RequireUser(app.PlannedWorkoutHandler.HandleDeletePlannedWorkout))
+		r.Post("/planned-workouts/{id}/occurrences", app.Middleware.RequireUser(app.PlannedWorkoutHandler.HandleRecordOccurrence))
+		r.Delete("/planned-workouts/{id}/occurrences", app.Middleware.RequireUser(app.PlannedWorkoutHandler.HandleDeleteOccurrence))
+		r.Get("/calendar", app.Middleware.RequireUser(app.PlannedWorkoutHandler.HandleGetCalendar))
+		r.Put("/users/me/preferences", app.Middleware.RequireUser(app.UserHandler.HandleUpdatePreferences))
+		r.Get("/users/me/records", app.Middleware.RequireUser(app.PersonalRecordHandler.HandleListPersonalRecords))
+		r.Get("/users/me/body-weights", app.Middleware.RequireUser(app.BodyWeightHandler.HandleListBodyWeights))
+		r.Post("/users/me/body-weights", app.Middleware.RequireUser(app.BodyWeightHandler.HandleCreateBodyWeight))
+		r.Delete("/users/me/body-weights/{id}", app.Middleware.RequireUser(app.BodyWeightHandler.HandleDeleteBodyWeight))
+		r.Post("/users/me/calendar-feed", app.Middleware.RequireUser(app.CalendarFeedHandler.HandleRotateFeedToken))
+		r.Delete("/users/me/calendar-feed", app.Middleware.RequireUser(app.CalendarFeedHandler.HandleRevokeFeedToken))
 	})
 
 
@@ -22,6 +83,7 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 	
 	routes.Post("/users", app.UserHandler.HandleRegisterUser)
 	routes.Post("/tokens/authentication", app.TokenHandler.HandleCreateToken)
+	routes.Get("/calendar/feed/{token}.ics", app.CalendarFeedHandler.HandleGetFeed) // the token in the URL is the auth, calendar apps can't send headers
 
 	return routes
 }
\ No newline at end of file
@@ -0,0 +1,524 @@
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supports the bits of RFC 5545 RRULEs people actually use for training plans:
+// FREQ (DAILY/WEEKLY/MONTHLY/YEARLY), INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY, BYMONTH and WKST
+// anything finer grained than a day (BYHOUR etc) or BYSETPOS is rejected rather than silently ignored
+
+var ErrInvalidRule = errors.New("invalid rrule")
+
+type Frequency int
+
+const (
+	Daily Frequency = iota
+	Weekly
+	Monthly
+	Yearly
+)
+
+var frequencyNames = map[string]Frequency{
+	"DAILY":   Daily,
+	"WEEKLY":  Weekly,
+	"MONTHLY": Monthly,
+	"YEARLY":  Yearly,
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// maxPeriods stops a rule with no end (or a silly one like BYMONTHDAY=31;BYMONTH=2) spinning forever
+const maxPeriods = 50000
+
+// WeekdayNum is a BYDAY value, N is the optional ordinal (1MO = first monday, -1FR = last friday, 0 = every)
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+	WeekStart  time.Weekday
+
+	untilFloating bool // UNTIL had no Z so it's wall clock time in whatever zone the rule is expanded in
+}
+
+// Parse reads an RRULE value such as FREQ=WEEKLY;BYDAY=MO,WE,FR;UNTIL=20251231T235959Z, the RRULE: prefix is optional
+func Parse(value string) (*Rule, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	if value == "" {
+		return nil, fmt.Errorf("%w: empty rule", ErrInvalidRule)
+	}
+
+	rule := &Rule{Interval: 1, WeekStart: time.Monday}
+	seenFreq := false
+
+	for _, part := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok || val == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRule, part)
+		}
+
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			freq, ok := frequencyNames[strings.ToUpper(val)]
+			if !ok {
+				return nil, fmt.Errorf("%w: unsupported FREQ %q", ErrInvalidRule, val)
+			}
+			rule.Freq = freq
+			seenFreq = true
+		case "INTERVAL":
+			rule.Interval, err = positiveInt(val)
+		case "COUNT":
+			rule.Count, err = positiveInt(val)
+		case "UNTIL":
+			rule.Until, rule.untilFloating, err = parseUntil(val)
+		case "BYDAY":
+			rule.ByDay, err = parseByDay(val)
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseIntList(val, -31, 31)
+		case "BYMONTH":
+			var months []int
+			months, err = parseIntList(val, 1, 12)
+			for _, month := range months {
+				rule.ByMonth = append(rule.ByMonth, time.Month(month))
+			}
+		case "WKST":
+			day, ok := weekdayNames[strings.ToUpper(val)]
+			if !ok {
+				err = fmt.Errorf("%w: invalid WKST %q", ErrInvalidRule, val)
+			}
+			rule.WeekStart = day
+		default:
+			return nil, fmt.Errorf("%w: %s is not supported", ErrInvalidRule, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !seenFreq {
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	}
+
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, fmt.Errorf("%w: COUNT and UNTIL cannot both be set", ErrInvalidRule)
+	}
+
+	// ordinals only mean something when the period is bigger than a week
+	if rule.Freq == Daily || rule.Freq == Weekly {
+		for _, day := range rule.ByDay {
+			if day.N != 0 {
+				return nil, fmt.Errorf("%w: BYDAY ordinals need FREQ=MONTHLY or FREQ=YEARLY", ErrInvalidRule)
+			}
+		}
+	}
+
+	if rule.Freq == Weekly && len(rule.ByMonthDay) > 0 {
+		return nil, fmt.Errorf("%w: BYMONTHDAY cannot be used with FREQ=WEEKLY", ErrInvalidRule)
+	}
+
+	return rule, nil
+}
+
+// String writes the rule back out in canonical form, handy for iCalendar output
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + [...]string{"DAILY", "WEEKLY", "MONTHLY", "YEARLY"}[r.Freq]}
+
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+
+	if !r.Until.IsZero() {
+		if r.untilFloating {
+			parts = append(parts, "UNTIL="+r.Until.Format("20060102T150405"))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+		}
+	}
+
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for _, day := range r.ByDay {
+			prefix := ""
+			if day.N != 0 {
+				prefix = strconv.Itoa(day.N)
+			}
+			days = append(days, prefix+strings.ToUpper(day.Day.String()[:2]))
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, 0, len(r.ByMonthDay))
+		for _, day := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(day))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+
+	if len(r.ByMonth) > 0 {
+		months := make([]string, 0, len(r.ByMonth))
+		for _, month := range r.ByMonth {
+			months = append(months, strconv.Itoa(int(month)))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+strings.ToUpper(r.WeekStart.String()[:2]))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Between returns every occurrence in [from, to) for a series starting at dtstart
+// occurrences keep dtstart's wall clock time in dtstart's location, so 7am stays 7am either side of a DST change
+func (r *Rule) Between(dtstart time.Time, from time.Time, to time.Time) []time.Time {
+	until := r.Until
+	if r.untilFloating && !until.IsZero() {
+		until = time.Date(until.Year(), until.Month(), until.Day(), until.Hour(), until.Minute(), until.Second(), 0, dtstart.Location())
+	}
+
+	occurrences := []time.Time{}
+	count := 0
+
+	for period := 0; period < maxPeriods; period++ {
+		periodStart, candidates := r.period(dtstart, period)
+		if !periodStart.Before(to) {
+			break
+		}
+
+		for _, candidate := range candidates {
+			if candidate.Before(dtstart) {
+				continue
+			}
+
+			if !until.IsZero() && candidate.After(until) {
+				return occurrences
+			}
+
+			// COUNT counts from dtstart, not from the window, so we have to walk the whole series
+			if r.Count > 0 && count >= r.Count {
+				return occurrences
+			}
+			count++
+
+			if !candidate.Before(to) {
+				return occurrences
+			}
+
+			if !candidate.Before(from) {
+				occurrences = append(occurrences, candidate)
+			}
+		}
+	}
+
+	return occurrences
+}
+
+// Includes reports whether t is exactly one of the rule's occurrences
+func (r *Rule) Includes(dtstart time.Time, t time.Time) bool {
+	for _, occurrence := range r.Between(dtstart, t, t.Add(time.Second)) {
+		if occurrence.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// period works out the nth period (day, week, month or year) after dtstart's and the candidate occurrences inside it
+func (r *Rule) period(dtstart time.Time, n int) (time.Time, []time.Time) {
+	loc := dtstart.Location()
+	hour, minute, second := dtstart.Clock()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hour, minute, second, 0, loc)
+	}
+
+	step := n * r.Interval
+	candidates := []time.Time{}
+
+	switch r.Freq {
+	case Daily:
+		day := at(dtstart.Year(), dtstart.Month(), dtstart.Day()+step)
+		if r.matchesMonth(day.Month()) && r.matchesMonthDay(day) && r.matchesWeekday(day.Weekday()) {
+			candidates = append(candidates, day)
+		}
+		return startOfDay(day), candidates
+
+	case Weekly:
+		offset := (int(dtstart.Weekday()) - int(r.WeekStart) + 7) % 7
+		weekStart := at(dtstart.Year(), dtstart.Month(), dtstart.Day()-offset+step*7)
+
+		for i := 0; i < 7; i++ {
+			day := at(weekStart.Year(), weekStart.Month(), weekStart.Day()+i)
+
+			matchesDay := day.Weekday() == dtstart.Weekday()
+			if len(r.ByDay) > 0 {
+				matchesDay = r.matchesWeekday(day.Weekday())
+			}
+
+			if matchesDay && r.matchesMonth(day.Month()) {
+				candidates = append(candidates, day)
+			}
+		}
+		return startOfDay(weekStart), candidates
+
+	case Monthly:
+		monthStart := time.Date(dtstart.Year(), dtstart.Month()+time.Month(step), 1, 0, 0, 0, 0, loc)
+		if r.matchesMonth(monthStart.Month()) {
+			for _, day := range r.daysInMonth(monthStart.Year(), monthStart.Month(), dtstart.Day()) {
+				candidates = append(candidates, at(monthStart.Year(), monthStart.Month(), day))
+			}
+		}
+		return monthStart, candidates
+
+	default:
+		year := dtstart.Year() + step
+		yearStart := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+
+		switch {
+		case len(r.ByMonth) == 0 && len(r.ByMonthDay) == 0 && len(r.ByDay) > 0:
+			// BYDAY on its own in a yearly rule is relative to the whole year (20MO = 20th monday of the year)
+			for _, dayOfYear := range r.daysInYear(year) {
+				candidates = append(candidates, at(year, time.January, dayOfYear))
+			}
+
+		default:
+			months := r.ByMonth
+			if len(months) == 0 {
+				if len(r.ByMonthDay) > 0 {
+					months = []time.Month{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+				} else {
+					months = []time.Month{dtstart.Month()}
+				}
+			}
+
+			sorted := append([]time.Month{}, months...)
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+			for _, month := range sorted {
+				for _, day := range r.daysInMonth(year, month, dtstart.Day()) {
+					candidates = append(candidates, at(year, month, day))
+				}
+			}
+		}
+		return yearStart, candidates
+	}
+}
+
+// daysInMonth applies BYMONTHDAY and BYDAY to a month, falling back to dtstart's day of the month
+// months that don't have that day (the 31st in april) are skipped, as RFC 5545 says they should be
+func (r *Rule) daysInMonth(year int, month time.Month, defaultDay int) []int {
+	length := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+
+	if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+		if defaultDay > length {
+			return nil
+		}
+		return []int{defaultDay}
+	}
+
+	var monthDays map[int]bool
+	if len(r.ByMonthDay) > 0 {
+		monthDays = map[int]bool{}
+		for _, day := range r.ByMonthDay {
+			if day < 0 {
+				day = length + 1 + day
+			}
+			if day >= 1 && day <= length {
+				monthDays[day] = true
+			}
+		}
+	}
+
+	var weekDays map[int]bool
+	if len(r.ByDay) > 0 {
+		firstWeekday := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC).Weekday()
+		weekDays = pickWeekdays(r.ByDay, length, firstWeekday)
+	}
+
+	days := []int{}
+	for day := 1; day <= length; day++ {
+		if monthDays != nil && !monthDays[day] {
+			continue
+		}
+		if weekDays != nil && !weekDays[day] {
+			continue
+		}
+		days = append(days, day)
+	}
+
+	return days
+}
+
+func (r *Rule) daysInYear(year int) []int {
+	length := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+	firstWeekday := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC).Weekday()
+	picked := pickWeekdays(r.ByDay, length, firstWeekday)
+
+	days := []int{}
+	for day := 1; day <= length; day++ {
+		if picked[day] {
+			days = append(days, day)
+		}
+	}
+
+	return days
+}
+
+// pickWeekdays marks which days (1 based) of a period of the given length match the BYDAY list
+func pickWeekdays(byDay []WeekdayNum, length int, firstWeekday time.Weekday) map[int]bool {
+	picked := map[int]bool{}
+
+	for _, weekday := range byDay {
+		matches := []int{}
+		for day := 1; day <= length; day++ {
+			if time.Weekday((int(firstWeekday)+day-1)%7) == weekday.Day {
+				matches = append(matches, day)
+			}
+		}
+
+		switch {
+		case weekday.N == 0:
+			for _, day := range matches {
+				picked[day] = true
+			}
+		case weekday.N > 0 && weekday.N <= len(matches):
+			picked[matches[weekday.N-1]] = true
+		case weekday.N < 0 && -weekday.N <= len(matches):
+			picked[matches[len(matches)+weekday.N]] = true
+		}
+	}
+
+	return picked
+}
+
+func (r *Rule) matchesMonth(month time.Month) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, m := range r.ByMonth {
+		if m == month {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesMonthDay(t time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	length := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, day := range r.ByMonthDay {
+		if day == t.Day() || (day < 0 && length+1+day == t.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesWeekday(weekday time.Weekday) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, day := range r.ByDay {
+		if day.Day == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func positiveInt(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%w: %q must be a positive number", ErrInvalidRule, value)
+	}
+	return n, nil
+}
+
+func parseIntList(value string, min int, max int) ([]int, error) {
+	values := []int{}
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n == 0 || n < min || n > max {
+			return nil, fmt.Errorf("%w: %q out of range", ErrInvalidRule, part)
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
+
+func parseByDay(value string) ([]WeekdayNum, error) {
+	days := []WeekdayNum{}
+	for _, part := range strings.Split(strings.ToUpper(value), ",") {
+		if len(part) < 2 {
+			return nil, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, part)
+		}
+
+		day, ok := weekdayNames[part[len(part)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, part)
+		}
+
+		n := 0
+		if ordinal := part[:len(part)-2]; ordinal != "" {
+			var err error
+			n, err = strconv.Atoi(ordinal)
+			if err != nil || n == 0 || n < -53 || n > 53 {
+				return nil, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, part)
+			}
+		}
+
+		days = append(days, WeekdayNum{N: n, Day: day})
+	}
+	return days, nil
+}
+
+func parseUntil(value string) (time.Time, bool, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, false, nil
+	}
+
+	if t, err := time.Parse("20060102T150405", value); err == nil {
+		return t, true, nil
+	}
+
+	// a bare date includes the whole of that day
+	if t, err := time.Parse("20060102", value); err == nil {
+		return t.Add(24*time.Hour - time.Second), true, nil
+	}
+
+	return time.Time{}, false, fmt.Errorf("%w: invalid UNTIL %q", ErrInvalidRule, value)
+}
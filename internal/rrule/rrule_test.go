@@ -0,0 +1,143 @@
+package rrule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lesi97/internal/rrule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBetween(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	require.NoError(t, err)
+
+	// monday 6th jan 2025, 7am
+	dtstart := time.Date(2025, time.January, 6, 7, 0, 0, 0, london)
+
+	tests := []struct {
+		name string
+		rule string
+		from time.Time
+		to   time.Time
+		want []string
+	}{
+		{
+			name: "mon wed fri",
+			rule: "FREQ=WEEKLY;BYDAY=MO,WE,FR",
+			from: dtstart,
+			to:   dtstart.AddDate(0, 0, 7),
+			want: []string{"2025-01-06", "2025-01-08", "2025-01-10"},
+		},
+		{
+			name: "count is from dtstart not the window",
+			rule: "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=4",
+			from: dtstart.AddDate(0, 0, 7),
+			to:   dtstart.AddDate(0, 0, 21),
+			want: []string{"2025-01-13"},
+		},
+		{
+			name: "until is inclusive",
+			rule: "FREQ=DAILY;UNTIL=20250108",
+			from: dtstart,
+			to:   dtstart.AddDate(0, 1, 0),
+			want: []string{"2025-01-06", "2025-01-07", "2025-01-08"},
+		},
+		{
+			name: "every other week",
+			rule: "FREQ=WEEKLY;INTERVAL=2",
+			from: dtstart,
+			to:   dtstart.AddDate(0, 0, 35),
+			want: []string{"2025-01-06", "2025-01-20", "2025-02-03"},
+		},
+		{
+			name: "last friday of the month",
+			rule: "FREQ=MONTHLY;BYDAY=-1FR",
+			from: dtstart,
+			to:   time.Date(2025, time.April, 1, 0, 0, 0, 0, london),
+			want: []string{"2025-01-31", "2025-02-28", "2025-03-28"},
+		},
+		{
+			name: "months without the day are skipped",
+			rule: "FREQ=MONTHLY;BYMONTHDAY=31",
+			from: dtstart,
+			to:   time.Date(2025, time.May, 1, 0, 0, 0, 0, london),
+			want: []string{"2025-01-31", "2025-03-31"},
+		},
+		{
+			name: "yearly",
+			rule: "FREQ=YEARLY;COUNT=2",
+			from: dtstart,
+			to:   dtstart.AddDate(5, 0, 0),
+			want: []string{"2025-01-06", "2026-01-06"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule, err := rrule.Parse(test.rule)
+			require.NoError(t, err)
+
+			got := []string{}
+			for _, occurrence := range rule.Between(dtstart, test.from, test.to) {
+				got = append(got, occurrence.Format("2006-01-02"))
+				assert.Equal(t, 7, occurrence.Hour())
+			}
+
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestBetweenKeepsWallClockOverDST(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	require.NoError(t, err)
+
+	// clocks go forward on 30th march 2025
+	dtstart := time.Date(2025, time.March, 28, 7, 0, 0, 0, london)
+	rule, err := rrule.Parse("FREQ=DAILY;COUNT=4")
+	require.NoError(t, err)
+
+	occurrences := rule.Between(dtstart, dtstart, dtstart.AddDate(0, 0, 10))
+	require.Len(t, occurrences, 4)
+
+	for _, occurrence := range occurrences {
+		assert.Equal(t, 7, occurrence.Hour())
+	}
+	assert.Equal(t, 23*time.Hour, occurrences[2].Sub(occurrences[1]))
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rule    string
+		wantErr bool
+	}{
+		{rule: "RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR;UNTIL=20251231T235959Z"},
+		{rule: "FREQ=MONTHLY;BYDAY=2TU"},
+		{rule: "", wantErr: true},
+		{rule: "BYDAY=MO", wantErr: true},
+		{rule: "FREQ=HOURLY", wantErr: true},
+		{rule: "FREQ=WEEKLY;BYDAY=1MO", wantErr: true},
+		{rule: "FREQ=DAILY;COUNT=3;UNTIL=20251231", wantErr: true},
+		{rule: "FREQ=DAILY;BYHOUR=7", wantErr: true},
+		{rule: "FREQ=DAILY;INTERVAL=0", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			_, err := rrule.Parse(test.rule)
+			if test.wantErr {
+				assert.ErrorIs(t, err, rrule.ErrInvalidRule)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	rule, err := rrule.Parse("freq=weekly;byday=mo,we,fr;until=20251231T235959Z;interval=1")
+	require.NoError(t, err)
+	assert.Equal(t, "FREQ=WEEKLY;UNTIL=20251231T235959Z;BYDAY=MO,WE,FR", rule.String())
+}
@@ -0,0 +1,247 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+type AnalyticsStore interface {
+	SessionSeries(filter AnalyticsFilter) ([]SessionBucket, error)
+	MuscleGroupSeries(filter AnalyticsFilter) ([]MuscleGroupBucket, error)
+	DailyLoads(userID int, from time.Time, to time.Time, timeZone string) ([]DailyLoad, error)
+}
+
+type PostgresAnalyticsStore struct {
+	db *sql.DB
+}
+
+type AnalyticsFilter struct {
+	UserID      int
+	From        time.Time
+	To          time.Time
+	Interval    string // day, week or month, passed to date_trunc
+	TimeZone    string // IANA zone the buckets are cut in
+	ExerciseIDs []int64
+}
+
+// SessionBucket is a bucket's session level numbers, PeriodStart is the local date the bucket starts on
+type SessionBucket struct {
+	PeriodStart            time.Time
+	Sessions               int
+	TotalVolume            float64
+	TotalSets              int
+	AverageDurationMinutes float64
+	AverageCalories        float64
+	TotalDistanceMeters    float64
+	TotalCardioSeconds     int
+}
+
+type MuscleGroupBucket struct {
+	PeriodStart time.Time
+	MuscleGroup string
+	Sets        int
+}
+
+// DailyLoad is the summed session load for one local day, Date is midnight UTC on that date
+type DailyLoad struct {
+	Date     time.Time
+	Load     float64
+	Sessions int
+	FromRPE  int // how many of the sessions had an RPE, the rest fell back to volume
+}
+
+// entryVolume is an entry's (aliased as e) volume, added up set by set from its working sets when they were logged
+const entryVolume = `
+	COALESCE(
+		(SELECT SUM(COALESCE(ws.reps, 0) * COALESCE(ws.weight, 0)) FROM workout_sets ws WHERE ws.entry_id = e.id AND NOT ws.is_warmup),
+		e.sets * COALESCE(e.reps, 0) * COALESCE(e.weight, 0)
+	)`
+
+// entryIsCardio matches WorkoutEntry.IsCardio for an entry aliased as e
+const entryIsCardio = `
+	(e.distance_meters IS NOT NULL OR e.avg_heart_rate IS NOT NULL OR e.max_heart_rate IS NOT NULL
+		OR e.cadence IS NOT NULL OR e.power IS NOT NULL OR e.elevation_gain_meters IS NOT NULL)`
+
+// entryCardioSeconds is how long a cardio entry (aliased as e) went on for, every set's time when they were logged
+const entryCardioSeconds = `
+	CASE WHEN ` + entryIsCardio + ` THEN
+		COALESCE(
+			(SELECT SUM(ws.duration_seconds) FROM workout_sets ws WHERE ws.entry_id = e.id),
+			e.sets * COALESCE(e.duration_seconds, 0)
+		)
+	ELSE 0 END`
+
+func NewPostgresAnalyticsStore(db *sql.DB) *PostgresAnalyticsStore {
+	return &PostgresAnalyticsStore{db: db}
+}
+
+// SessionSeries aggregates in SQL so we're only ever sending one row per bucket back.
+// With exercise filters only sessions containing one of the exercises count, and only those exercises add to volume,
+// sets, distance and cardio time
+func (pg *PostgresAnalyticsStore) SessionSeries(filter AnalyticsFilter) ([]SessionBucket, error) {
+	query := `
+		WITH sessions AS (
+			SELECT
+				w.id,
+				date_trunc($2, w.started_at AT TIME ZONE $3) AS period_start,
+				w.duration_minutes,
+				w.calories_burned
+			FROM workouts w
+			WHERE w.user_id = $1
+			AND w.deleted_at IS NULL
+			AND w.started_at >= $4
+			AND w.started_at < $5
+			AND (
+				cardinality($6::bigint[]) = 0
+				OR EXISTS (SELECT 1 FROM workout_entries fe WHERE fe.workout_id = w.id AND fe.exercise_id = ANY($6))
+			)
+		),
+		work AS (
+			SELECT
+				s.period_start,
+				SUM(` + entryVolume + `) AS total_volume,
+				SUM(e.sets) AS total_sets,
+				SUM(e.sets * COALESCE(e.distance_meters, 0)) AS total_distance,
+				SUM(` + entryCardioSeconds + `) AS total_cardio_seconds
+			FROM sessions s
+			JOIN workout_entries e ON e.workout_id = s.id
+			WHERE cardinality($6::bigint[]) = 0 OR e.exercise_id = ANY($6)
+			GROUP BY s.period_start
+		)
+		SELECT
+			s.period_start,
+			COUNT(*),
+			COALESCE(wk.total_volume, 0),
+			COALESCE(wk.total_sets, 0),
+			COALESCE(AVG(s.duration_minutes), 0),
+			COALESCE(AVG(s.calories_burned), 0),
+			COALESCE(wk.total_distance, 0),
+			COALESCE(wk.total_cardio_seconds, 0)
+		FROM sessions s
+		LEFT JOIN work wk ON wk.period_start = s.period_start
+		GROUP BY s.period_start, wk.total_volume, wk.total_sets, wk.total_distance, wk.total_cardio_seconds
+		ORDER BY s.period_start;
+	`
+
+	rows, err := pg.db.Query(query, filter.UserID, filter.Interval, filter.TimeZone, filter.From, filter.To, exerciseIDsArg(filter.ExerciseIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []SessionBucket{}
+	for rows.Next() {
+		var bucket SessionBucket
+		err = rows.Scan(
+			&bucket.PeriodStart,
+			&bucket.Sessions,
+			&bucket.TotalVolume,
+			&bucket.TotalSets,
+			&bucket.AverageDurationMinutes,
+			&bucket.AverageCalories,
+			&bucket.TotalDistanceMeters,
+			&bucket.TotalCardioSeconds,
+		)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, rows.Err()
+}
+
+// MuscleGroupSeries counts sets against each primary muscle of the entry's catalog exercise, entries with no catalog exercise aren't counted
+func (pg *PostgresAnalyticsStore) MuscleGroupSeries(filter AnalyticsFilter) ([]MuscleGroupBucket, error) {
+	query := `
+		SELECT
+			date_trunc($2, w.started_at AT TIME ZONE $3) AS period_start,
+			m.muscle_group,
+			SUM(e.sets)
+		FROM workouts w
+		JOIN workout_entries e ON e.workout_id = w.id
+		JOIN exercises x ON x.id = e.exercise_id
+		CROSS JOIN LATERAL unnest(x.primary_muscles) AS m(muscle_group)
+		WHERE w.user_id = $1
+		AND w.deleted_at IS NULL
+		AND w.started_at >= $4
+		AND w.started_at < $5
+		AND (cardinality($6::bigint[]) = 0 OR e.exercise_id = ANY($6))
+		GROUP BY 1, 2
+		ORDER BY 1, 2;
+	`
+
+	rows, err := pg.db.Query(query, filter.UserID, filter.Interval, filter.TimeZone, filter.From, filter.To, exerciseIDsArg(filter.ExerciseIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []MuscleGroupBucket{}
+	for rows.Next() {
+		var bucket MuscleGroupBucket
+		err = rows.Scan(&bucket.PeriodStart, &bucket.MuscleGroup, &bucket.Sets)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, rows.Err()
+}
+
+// exerciseIDsArg makes sure a nil filter still goes over the wire as an empty array rather than NULL
+func exerciseIDsArg(ids []int64) []int64 {
+	if ids == nil {
+		return []int64{}
+	}
+	return ids
+}
+
+// DailyLoads sums each day's session loads, duration x session RPE where there is one and volume (sets x reps x weight) where there isn't
+func (pg *PostgresAnalyticsStore) DailyLoads(userID int, from time.Time, to time.Time, timeZone string) ([]DailyLoad, error) {
+	query := `
+		WITH sessions AS (
+			SELECT
+				(w.started_at AT TIME ZONE $2)::date AS day,
+				w.duration_minutes,
+				w.session_rpe,
+				(
+					SELECT COALESCE(SUM(` + entryVolume + `), 0)
+					FROM workout_entries e
+					WHERE e.workout_id = w.id
+				) AS volume
+			FROM workouts w
+			WHERE w.user_id = $1
+			AND w.deleted_at IS NULL
+			AND w.started_at >= $3
+			AND w.started_at < $4
+		)
+		SELECT
+			day,
+			SUM(CASE WHEN session_rpe IS NOT NULL THEN duration_minutes * session_rpe ELSE volume END),
+			COUNT(*),
+			COUNT(session_rpe)
+		FROM sessions
+		GROUP BY day
+		ORDER BY day;
+	`
+
+	rows, err := pg.db.Query(query, userID, timeZone, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loads := []DailyLoad{}
+	for rows.Next() {
+		var load DailyLoad
+		err = rows.Scan(&load.Date, &load.Load, &load.Sessions, &load.FromRPE)
+		if err != nil {
+			return nil, err
+		}
+		loads = append(loads, load)
+	}
+
+	return loads, rows.Err()
+}
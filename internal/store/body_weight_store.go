@@ -0,0 +1,108 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+type BodyWeightStore interface {
+	CreateBodyWeight(*BodyWeight) error
+	ListBodyWeights(userID int, limit int) ([]*BodyWeight, error)
+	GetLatestBodyWeight(userID int) (*BodyWeight, error)
+	DeleteBodyWeight(userID int, id int64) error
+}
+
+type PostgresBodyWeightStore struct {
+	db *sql.DB
+}
+
+// BodyWeight is a single weigh-in, used for calorie estimates
+type BodyWeight struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Weight     float64   `json:"weight"`      // kg in the store, the api converts on the way in and out
+	WeightUnit string    `json:"weight_unit"` // kg or lb, what the weight was entered in
+	MeasuredAt time.Time `json:"measured_at"`
+}
+
+func NewPostgresBodyWeightStore(db *sql.DB) *PostgresBodyWeightStore {
+	return &PostgresBodyWeightStore{db: db}
+}
+
+// CreateBodyWeight stamps measured_at with now when it's left zero
+func (pg *PostgresBodyWeightStore) CreateBodyWeight(bodyWeight *BodyWeight) error {
+	query := `
+		INSERT INTO body_weights (user_id, weight, weight_unit, measured_at)
+		VALUES ($1, $2, COALESCE(NULLIF($3, ''), 'kg'), COALESCE($4, CURRENT_TIMESTAMP))
+		RETURNING id, weight_unit, measured_at;
+	`
+
+	return pg.db.QueryRow(
+		query,
+		bodyWeight.UserID,
+		bodyWeight.Weight,
+		bodyWeight.WeightUnit,
+		timeOrNil(bodyWeight.MeasuredAt),
+	).Scan(&bodyWeight.ID, &bodyWeight.WeightUnit, &bodyWeight.MeasuredAt)
+}
+
+// ListBodyWeights is newest first
+func (pg *PostgresBodyWeightStore) ListBodyWeights(userID int, limit int) ([]*BodyWeight, error) {
+	query := `
+		SELECT id, user_id, weight, weight_unit, measured_at
+		FROM body_weights
+		WHERE user_id = $1
+		ORDER BY measured_at DESC, id DESC
+		LIMIT $2;
+	`
+
+	rows, err := pg.db.Query(query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bodyWeights := []*BodyWeight{}
+	for rows.Next() {
+		bodyWeight := &BodyWeight{}
+		err = rows.Scan(&bodyWeight.ID, &bodyWeight.UserID, &bodyWeight.Weight, &bodyWeight.WeightUnit, &bodyWeight.MeasuredAt)
+		if err != nil {
+			return nil, err
+		}
+		bodyWeights = append(bodyWeights, bodyWeight)
+	}
+
+	return bodyWeights, rows.Err()
+}
+
+// GetLatestBodyWeight returns nil when the user has never logged one
+func (pg *PostgresBodyWeightStore) GetLatestBodyWeight(userID int) (*BodyWeight, error) {
+	bodyWeights, err := pg.ListBodyWeights(userID, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bodyWeights) == 0 {
+		return nil, nil
+	}
+
+	return bodyWeights[0], nil
+}
+
+func (pg *PostgresBodyWeightStore) DeleteBodyWeight(userID int, id int64) error {
+	result, err := pg.db.Exec(`DELETE FROM body_weights WHERE id = $1 AND user_id = $2;`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
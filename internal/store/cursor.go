@@ -0,0 +1,40 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// pageCursor is what we hand back to the client as next_cursor, it gets base64'd so the client can't (easily) poke at it
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func encodeCursor(c pageCursor) string {
+	js, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(raw string) (*pageCursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c pageCursor
+	err = json.Unmarshal(js, &c)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
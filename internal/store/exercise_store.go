@@ -0,0 +1,385 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lesi97/internal/fuzzy"
+)
+
+// ExerciseMatchThreshold is how similar free text has to be to a catalog name or alias before an entry gets linked to it
+const ExerciseMatchThreshold = 0.6
+
+var (
+	ErrExerciseNotFound  = errors.New("exercise not found")
+	ErrDuplicateExercise = errors.New("an exercise with that name already exists")
+)
+
+// the values the API accepts, kept here so analytics can group on the same names
+var (
+	MuscleGroups     = []string{"chest", "back", "shoulders", "biceps", "triceps", "forearms", "core", "quads", "hamstrings", "glutes", "calves", "full_body"}
+	Equipment        = []string{"barbell", "dumbbell", "kettlebell", "machine", "cable", "bodyweight", "band", "cardio_machine", "none", "other"}
+	MovementPatterns = []string{"push", "pull", "squat", "hinge", "lunge", "carry", "core", "isolation", "cardio", "other"}
+)
+
+type ExerciseStore interface {
+	CreateExercise(*Exercise) error
+	GetExerciseById(id int64) (*Exercise, error)
+	ListExercises(userID int, filter ExerciseFilter) ([]*Exercise, error)
+	UpdateExercise(*Exercise) error
+	DeleteExercise(id int64) error
+	MatchExercise(userID int, name string) (*Exercise, float64, error)
+	ResolveEntries(userID int, entries []WorkoutEntry) error
+}
+
+type PostgresExerciseStore struct {
+	db *sql.DB
+}
+
+type Exercise struct {
+	ID               int      `json:"id"`
+	UserID           *int     `json:"user_id"` // nil for the shared catalog
+	Name             string   `json:"name"`
+	PrimaryMuscles   []string `json:"primary_muscles"`
+	SecondaryMuscles []string `json:"secondary_muscles"`
+	Equipment        string   `json:"equipment"`
+	MovementPattern  string   `json:"movement_pattern"`
+	Aliases          []string `json:"aliases"`
+	MET              *float64 `json:"met"` // nil falls back to the movement pattern's value when estimating calories
+}
+
+type ExerciseFilter struct {
+	Search    string // name or alias contains
+	Muscle    string // primary or secondary
+	Equipment string
+	Pattern   string
+	IDs       []int64 // only these exercises, nil for any
+}
+
+func NewPostgresExerciseStore(db *sql.DB) *PostgresExerciseStore {
+	return &PostgresExerciseStore{db: db}
+}
+
+// arrays come back as json so we don't need pgtype just for text[]
+const exerciseSelect = `
+	SELECT
+		x.id,
+		x.user_id,
+		x.name,
+		to_json(x.primary_muscles),
+		to_json(x.secondary_muscles),
+		x.equipment,
+		x.movement_pattern,
+		to_json(x.aliases),
+		x.met
+	FROM exercises x
+`
+
+func scanExercise(scanner interface {
+	Scan(dest ...interface{}) error
+}) (*Exercise, error) {
+	exercise := &Exercise{}
+	var userID sql.NullInt64
+	var primaryRaw, secondaryRaw, aliasesRaw []byte
+
+	err := scanner.Scan(
+		&exercise.ID,
+		&userID,
+		&exercise.Name,
+		&primaryRaw,
+		&secondaryRaw,
+		&exercise.Equipment,
+		&exercise.MovementPattern,
+		&aliasesRaw,
+		&exercise.MET,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if userID.Valid {
+		id := int(userID.Int64)
+		exercise.UserID = &id
+	}
+
+	err = json.Unmarshal(primaryRaw, &exercise.PrimaryMuscles)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(secondaryRaw, &exercise.SecondaryMuscles)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(aliasesRaw, &exercise.Aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	return exercise, nil
+}
+
+// normalizeAliases stores aliases the same way the backfill compares them, lowercase with punctuation stripped
+func normalizeAliases(aliases []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, alias := range aliases {
+		alias = strings.Join(strings.FieldsFunc(strings.ToLower(alias), func(r rune) bool {
+			return !('a' <= r && r <= 'z') && !('0' <= r && r <= '9')
+		}), " ")
+		if alias == "" || seen[alias] {
+			continue
+		}
+		seen[alias] = true
+		normalized = append(normalized, alias)
+	}
+	return normalized
+}
+
+func emptyIfNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func (pg *PostgresExerciseStore) CreateExercise(exercise *Exercise) error {
+	exercise.Aliases = normalizeAliases(exercise.Aliases)
+	exercise.PrimaryMuscles = emptyIfNil(exercise.PrimaryMuscles)
+	exercise.SecondaryMuscles = emptyIfNil(exercise.SecondaryMuscles)
+
+	query := `
+		INSERT INTO exercises (user_id, name, primary_muscles, secondary_muscles, equipment, movement_pattern, aliases, met)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT DO NOTHING
+		RETURNING id;
+	`
+
+	err := pg.db.QueryRow(
+		query,
+		exercise.UserID,
+		exercise.Name,
+		exercise.PrimaryMuscles,
+		exercise.SecondaryMuscles,
+		exercise.Equipment,
+		exercise.MovementPattern,
+		exercise.Aliases,
+		exercise.MET,
+	).Scan(&exercise.ID)
+	if err == sql.ErrNoRows {
+		return ErrDuplicateExercise // nothing comes back when the unique name index stops the insert
+	}
+
+	return err
+}
+
+func (pg *PostgresExerciseStore) GetExerciseById(id int64) (*Exercise, error) {
+	exercise, err := scanExercise(pg.db.QueryRow(exerciseSelect+` WHERE x.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return exercise, nil
+}
+
+// ListExercises returns the shared catalog plus the user's own custom exercises
+func (pg *PostgresExerciseStore) ListExercises(userID int, filter ExerciseFilter) ([]*Exercise, error) {
+	args := queryArgs{}
+	conditions := []string{`(x.user_id IS NULL OR x.user_id = ` + args.add(userID) + `)`}
+
+	if filter.Search != "" {
+		search := args.add("%" + escapeLike(filter.Search) + "%")
+		conditions = append(conditions, `(x.name ILIKE `+search+` OR EXISTS (SELECT 1 FROM unnest(x.aliases) a WHERE a ILIKE `+search+`))`)
+	}
+	if filter.Muscle != "" {
+		muscle := args.add(filter.Muscle)
+		conditions = append(conditions, `(`+muscle+` = ANY(x.primary_muscles) OR `+muscle+` = ANY(x.secondary_muscles))`)
+	}
+	if filter.Equipment != "" {
+		conditions = append(conditions, `x.equipment = `+args.add(filter.Equipment))
+	}
+	if filter.Pattern != "" {
+		conditions = append(conditions, `x.movement_pattern = `+args.add(filter.Pattern))
+	}
+	if filter.IDs != nil {
+		conditions = append(conditions, `x.id = ANY(`+args.add(filter.IDs)+`)`)
+	}
+
+	query := exerciseSelect + ` WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY x.name, x.id`
+
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exercises := []*Exercise{}
+	for rows.Next() {
+		exercise, err := scanExercise(rows)
+		if err != nil {
+			return nil, err
+		}
+		exercises = append(exercises, exercise)
+	}
+
+	return exercises, rows.Err()
+}
+
+// UpdateExercise only touches custom exercises, the shared catalog is managed through migrations
+func (pg *PostgresExerciseStore) UpdateExercise(exercise *Exercise) error {
+	exercise.Aliases = normalizeAliases(exercise.Aliases)
+	exercise.PrimaryMuscles = emptyIfNil(exercise.PrimaryMuscles)
+	exercise.SecondaryMuscles = emptyIfNil(exercise.SecondaryMuscles)
+
+	var taken bool
+	err := pg.db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM exercises
+			WHERE COALESCE(user_id, 0) = COALESCE($1, 0)
+			AND lower(name) = lower($2)
+			AND id <> $3
+		)
+	`, exercise.UserID, exercise.Name, exercise.ID).Scan(&taken)
+	if err != nil {
+		return err
+	}
+
+	if taken {
+		return ErrDuplicateExercise
+	}
+
+	query := `
+		UPDATE exercises
+		SET
+			name = $1,
+			primary_muscles = $2,
+			secondary_muscles = $3,
+			equipment = $4,
+			movement_pattern = $5,
+			aliases = $6,
+			met = $7,
+			updated = CURRENT_TIMESTAMP
+		WHERE id = $8
+		AND user_id IS NOT NULL;
+	`
+
+	result, err := pg.db.Exec(
+		query,
+		exercise.Name,
+		exercise.PrimaryMuscles,
+		exercise.SecondaryMuscles,
+		exercise.Equipment,
+		exercise.MovementPattern,
+		exercise.Aliases,
+		exercise.MET,
+		exercise.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (pg *PostgresExerciseStore) DeleteExercise(id int64) error {
+	query := `DELETE FROM exercises WHERE id = $1 AND user_id IS NOT NULL;`
+
+	result, err := pg.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// MatchExercise finds the catalog exercise closest to free text, nil if nothing is close enough
+func (pg *PostgresExerciseStore) MatchExercise(userID int, name string) (*Exercise, float64, error) {
+	exercises, err := pg.ListExercises(userID, ExerciseFilter{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	match, score := matchExercise(exercises, name)
+	return match, score, nil
+}
+
+func matchExercise(exercises []*Exercise, name string) (*Exercise, float64) {
+	candidates := make([]fuzzy.Candidate, 0, len(exercises))
+	for i, exercise := range exercises {
+		candidates = append(candidates, fuzzy.Candidate{
+			ID:    i,
+			Names: append([]string{exercise.Name}, exercise.Aliases...),
+		})
+	}
+
+	index, score, ok := fuzzy.BestMatch(name, candidates, ExerciseMatchThreshold)
+	if !ok {
+		return nil, score
+	}
+
+	return exercises[index], score
+}
+
+// ResolveEntries links each entry to a catalog exercise. An explicit exercise_id must be visible to the user and fills in a blank
+// exercise_name, otherwise the name is fuzzy matched and left unlinked if nothing is close enough
+func (pg *PostgresExerciseStore) ResolveEntries(userID int, entries []WorkoutEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	exercises, err := pg.ListExercises(userID, ExerciseFilter{})
+	if err != nil {
+		return err
+	}
+
+	byID := map[int]*Exercise{}
+	for _, exercise := range exercises {
+		byID[exercise.ID] = exercise
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+
+		if entry.ExerciseID != nil {
+			exercise, ok := byID[*entry.ExerciseID]
+			if !ok {
+				return fmt.Errorf("%w: %d", ErrExerciseNotFound, *entry.ExerciseID)
+			}
+			if strings.TrimSpace(entry.ExerciseName) == "" {
+				entry.ExerciseName = exercise.Name
+			}
+			continue
+		}
+
+		if match, _ := matchExercise(exercises, entry.ExerciseName); match != nil {
+			entry.ExerciseID = &match.ID
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// where an import job is up to
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+type ImportJobStore interface {
+	CreateImportJob(*ImportJob) error
+	GetImportJob(userID int, id int64) (*ImportJob, error)
+	ListImportJobs(userID int, limit int) ([]*ImportJob, error)
+	UpdateImportJob(*ImportJob) error
+	FailInterruptedImportJobs() (int64, error)
+}
+
+type PostgresImportJobStore struct {
+	db *sql.DB
+}
+
+// ImportJob is a background import of another app's export, it's updated as the job goes so it doubles as the progress
+type ImportJob struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Format     string     `json:"format"`
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`     // workouts found in the file
+	Processed  int        `json:"processed"` // created, skipped or failed so far
+	Created    int        `json:"created"`
+	Skipped    int        `json:"skipped"` // already logged
+	Failed     int        `json:"failed"`
+	Warnings   []string   `json:"warnings"` // from reading the file
+	Errors     []string   `json:"errors"`   // from creating the workouts
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+func NewPostgresImportJobStore(db *sql.DB) *PostgresImportJobStore {
+	return &PostgresImportJobStore{db: db}
+}
+
+const importJobSelect = `
+	SELECT id, user_id, format, status, total, processed, created, skipped, failed, warnings, errors, created_at, started_at, finished_at
+	FROM import_jobs
+`
+
+func scanImportJob(row interface {
+	Scan(dest ...interface{}) error
+}) (*ImportJob, error) {
+	job := &ImportJob{}
+	var warnings, errs []byte
+
+	err := row.Scan(
+		&job.ID,
+		&job.UserID,
+		&job.Format,
+		&job.Status,
+		&job.Total,
+		&job.Processed,
+		&job.Created,
+		&job.Skipped,
+		&job.Failed,
+		&warnings,
+		&errs,
+		&job.CreatedAt,
+		&job.StartedAt,
+		&job.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(warnings, &job.Warnings)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(errs, &job.Errors)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// CreateImportJob starts the job off as pending whatever its status says
+func (pg *PostgresImportJobStore) CreateImportJob(job *ImportJob) error {
+	warnings, err := json.Marshal(stringsOrEmpty(job.Warnings))
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO import_jobs (user_id, format, status, total, warnings)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at;
+	`
+
+	job.Errors = stringsOrEmpty(job.Errors)
+	return pg.db.QueryRow(query, job.UserID, job.Format, ImportPending, job.Total, warnings).Scan(&job.ID, &job.Status, &job.CreatedAt)
+}
+
+// GetImportJob returns nil when the job doesn't exist or belongs to someone else
+func (pg *PostgresImportJobStore) GetImportJob(userID int, id int64) (*ImportJob, error) {
+	job, err := scanImportJob(pg.db.QueryRow(importJobSelect+` WHERE id = $1 AND user_id = $2;`, id, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// ListImportJobs is newest first
+func (pg *PostgresImportJobStore) ListImportJobs(userID int, limit int) ([]*ImportJob, error) {
+	rows, err := pg.db.Query(importJobSelect+`
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2;
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*ImportJob{}
+	for rows.Next() {
+		job, err := scanImportJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// UpdateImportJob writes the job's status, counts, errors and times. Warnings are fixed once the file's been read
+func (pg *PostgresImportJobStore) UpdateImportJob(job *ImportJob) error {
+	errs, err := json.Marshal(stringsOrEmpty(job.Errors))
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE import_jobs
+		SET status = $1, processed = $2, created = $3, skipped = $4, failed = $5, errors = $6, started_at = $7, finished_at = $8
+		WHERE id = $9;
+	`
+
+	result, err := pg.db.Exec(query, job.Status, job.Processed, job.Created, job.Skipped, job.Failed, errs, job.StartedAt, job.FinishedAt, job.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// FailInterruptedImportJobs marks jobs that were still going when the server last stopped as failed, jobs only live
+// in the process that started them so nothing is ever going to finish them. Call it on startup before taking requests
+func (pg *PostgresImportJobStore) FailInterruptedImportJobs() (int64, error) {
+	query := `
+		UPDATE import_jobs
+		SET status = $1, finished_at = CURRENT_TIMESTAMP, errors = errors || '["the import was interrupted by a server restart"]'::jsonb
+		WHERE status IN ($2, $3);
+	`
+
+	result, err := pg.db.Exec(query, ImportFailed, ImportPending, ImportRunning)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func stringsOrEmpty(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
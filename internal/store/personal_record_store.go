@@ -0,0 +1,271 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lesi97/internal/records"
+)
+
+type PersonalRecordStore interface {
+	ListPersonalRecords(userID int, formula records.Formula, exerciseID int) ([]*PersonalRecord, error)
+}
+
+type PostgresPersonalRecordStore struct {
+	db *sql.DB
+}
+
+type PersonalRecord struct {
+	ID           int             `json:"id"`
+	ExerciseID   int             `json:"exercise_id"`
+	ExerciseName string          `json:"exercise_name"` // catalog name rather than whatever was typed on the entry
+	WorkoutID    int             `json:"workout_id"`
+	EntryID      *int            `json:"entry_id"`
+	Kind         records.Kind    `json:"record_type"`
+	Formula      records.Formula `json:"formula,omitempty"`
+	Value        float64         `json:"value"`
+	Weight       *float64        `json:"weight"`
+	Reps         *int            `json:"reps"`
+	AchievedAt   time.Time       `json:"achieved_at"`
+}
+
+func NewPostgresPersonalRecordStore(db *sql.DB) *PostgresPersonalRecordStore {
+	return &PostgresPersonalRecordStore{db: db}
+}
+
+// liftsFromEntry is one lift per working set when the entry has its sets logged, otherwise the entry as a whole.
+// Timed sets and warm-ups never count towards a record
+func liftsFromEntry(entry WorkoutEntry) []records.Lift {
+	lifts := []records.Lift{}
+
+	if len(entry.Sets) == 0 {
+		if entry.Reps == nil {
+			return lifts
+		}
+
+		lift := records.Lift{ExerciseID: *entry.ExerciseID, EntryID: entry.ID, Sets: entry.SetCount, Reps: *entry.Reps}
+		if entry.Weight != nil {
+			lift.Weight = *entry.Weight
+		}
+		return append(lifts, lift)
+	}
+
+	for _, set := range entry.Sets {
+		if set.IsWarmup || set.Reps == nil {
+			continue
+		}
+
+		lift := records.Lift{ExerciseID: *entry.ExerciseID, EntryID: entry.ID, Sets: 1, Reps: *set.Reps}
+		if set.Weight != nil {
+			lift.Weight = *set.Weight
+		}
+		lifts = append(lifts, lift)
+	}
+
+	return lifts
+}
+
+// savePersonalRecords replaces the workout's best for every record key, whether or not it beats anything. The current
+// record is the best of these across the user's workouts that aren't in the trash, worked out when it's read, so
+// lowering or trashing the workout that held a record hands it straight to the next best. Called inside every
+// workout write so the two can't disagree. Returns the records the write set, the ones the workout holds now that it
+// didn't hold before or holds with a better value, so an edit that doesn't touch a record reports nothing
+func savePersonalRecords(tx *sql.Tx, workout *Workout) ([]*PersonalRecord, error) {
+	before, err := listWorkoutRecords(tx, workout.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM personal_records WHERE workout_id = $1`, workout.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	lifts := []records.Lift{}
+	for _, entry := range workout.Entries {
+		if entry.ExerciseID == nil {
+			continue // no catalog exercise to hang a record on
+		}
+		lifts = append(lifts, liftsFromEntry(entry)...)
+	}
+
+	query := `
+		INSERT INTO personal_records (user_id, exercise_id, workout_id, entry_id, record_type, formula, value, weight, reps, achieved_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
+	`
+
+	for _, best := range records.Best(lifts) {
+		var entryID *int
+		if best.EntryID != 0 {
+			entryID = &best.EntryID
+		}
+
+		var weight *float64
+		var reps *int
+		if best.Kind != records.MostVolume {
+			weight = &best.Weight
+			reps = &best.Reps
+		}
+
+		_, err = tx.Exec(
+			query,
+			workout.UserID,
+			best.ExerciseID,
+			workout.ID,
+			entryID,
+			string(best.Kind),
+			nullIfEmpty(string(best.Formula)),
+			best.Value,
+			weight,
+			reps,
+			workout.StartedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	after, err := listWorkoutRecords(tx, workout.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	held := map[recordKey]float64{}
+	for _, record := range before {
+		held[record.key()] = record.Value
+	}
+
+	newRecords := []*PersonalRecord{}
+	for _, record := range after {
+		value, ok := held[record.key()]
+		if !ok || record.Value > value {
+			newRecords = append(newRecords, record)
+		}
+	}
+
+	return newRecords, nil
+}
+
+// recordKey is what a record is a record for, most_reps is kept per weight
+type recordKey struct {
+	exerciseID int
+	kind       records.Kind
+	formula    records.Formula
+	weight     float64
+}
+
+func (r *PersonalRecord) key() recordKey {
+	key := recordKey{exerciseID: r.ExerciseID, kind: r.Kind, formula: r.Formula}
+	if r.Kind == records.MostReps && r.Weight != nil {
+		key.weight = *r.Weight
+	}
+	return key
+}
+
+// listWorkoutRecords returns the records the workout holds, the bests of its that no other workout outside the trash
+// has matched. A workout in the trash holds nothing
+func listWorkoutRecords(q queryer, workoutID int) ([]*PersonalRecord, error) {
+	query := `
+		SELECT
+			pr.id,
+			pr.exercise_id,
+			x.name,
+			pr.workout_id,
+			pr.entry_id,
+			pr.record_type,
+			COALESCE(pr.formula, ''),
+			pr.value,
+			pr.weight,
+			pr.reps,
+			pr.achieved_at
+		FROM personal_records pr
+		JOIN exercises x ON x.id = pr.exercise_id
+		JOIN workouts w ON w.id = pr.workout_id AND w.deleted_at IS NULL
+		WHERE pr.workout_id = $1
+		AND NOT EXISTS (
+			SELECT 1
+			FROM personal_records other
+			JOIN workouts ow ON ow.id = other.workout_id AND ow.deleted_at IS NULL
+			WHERE other.user_id = pr.user_id
+			AND other.exercise_id = pr.exercise_id
+			AND other.record_type = pr.record_type
+			AND other.formula IS NOT DISTINCT FROM pr.formula
+			AND (pr.record_type <> 'most_reps' OR other.weight = pr.weight)
+			AND other.workout_id <> pr.workout_id
+			AND other.value >= pr.value
+		)
+		ORDER BY x.name, pr.record_type, pr.weight;
+	`
+
+	rows, err := q.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPersonalRecords(rows)
+}
+
+// ListPersonalRecords returns the current record for each exercise and type, estimated 1RMs only for the given formula.
+// exerciseID of 0 means every exercise
+func (pg *PostgresPersonalRecordStore) ListPersonalRecords(userID int, formula records.Formula, exerciseID int) ([]*PersonalRecord, error) {
+	query := `
+		SELECT id, exercise_id, exercise_name, workout_id, entry_id, record_type, formula, value, weight, reps, achieved_at
+		FROM (
+			SELECT DISTINCT ON (pr.exercise_id, pr.record_type, CASE WHEN pr.record_type = 'most_reps' THEN pr.weight END)
+				pr.id,
+				pr.exercise_id,
+				x.name AS exercise_name,
+				pr.workout_id,
+				pr.entry_id,
+				pr.record_type,
+				COALESCE(pr.formula, '') AS formula,
+				pr.value,
+				pr.weight,
+				pr.reps,
+				pr.achieved_at
+			FROM personal_records pr
+			JOIN exercises x ON x.id = pr.exercise_id
+			JOIN workouts w ON w.id = pr.workout_id AND w.deleted_at IS NULL
+			WHERE pr.user_id = $1
+			AND (pr.record_type <> 'estimated_1rm' OR pr.formula = $2)
+			AND ($3 = 0 OR pr.exercise_id = $3)
+			ORDER BY pr.exercise_id, pr.record_type, CASE WHEN pr.record_type = 'most_reps' THEN pr.weight END, pr.value DESC, pr.achieved_at
+		) current
+		ORDER BY exercise_name, record_type, weight;
+	`
+
+	rows, err := pg.db.Query(query, userID, string(formula), exerciseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPersonalRecords(rows)
+}
+
+func scanPersonalRecords(rows *sql.Rows) ([]*PersonalRecord, error) {
+	personalRecords := []*PersonalRecord{}
+	for rows.Next() {
+		record := &PersonalRecord{}
+		err := rows.Scan(
+			&record.ID,
+			&record.ExerciseID,
+			&record.ExerciseName,
+			&record.WorkoutID,
+			&record.EntryID,
+			&record.Kind,
+			&record.Formula,
+			&record.Value,
+			&record.Weight,
+			&record.Reps,
+			&record.AchievedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		personalRecords = append(personalRecords, record)
+	}
+
+	return personalRecords, rows.Err()
+}
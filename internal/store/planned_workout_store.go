@@ -0,0 +1,344 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type PlannedWorkoutStore interface {
+	CreatePlannedWorkout(*PlannedWorkout) (*PlannedWorkout, error)
+	GetPlannedWorkoutById(id int64) (*PlannedWorkout, error)
+	ListPlannedWorkouts(userID int) ([]*PlannedWorkout, error)
+	UpdatePlannedWorkout(plan *PlannedWorkout, id int64) error
+	DeletePlannedWorkout(id int64) error
+	GetPlannedWorkoutOwner(id int64) (int, error)
+	ListOccurrenceRecords(userID int, from time.Time, to time.Time) ([]*OccurrenceRecord, error)
+	RecordOccurrence(*OccurrenceRecord) error
+	DeleteOccurrenceRecord(plannedWorkoutID int64, occursAt time.Time) error
+}
+
+type PostgresPlannedWorkoutStore struct {
+	db *sql.DB
+}
+
+type OccurrenceStatus string
+
+const (
+	OccurrencePlanned   OccurrenceStatus = "planned"
+	OccurrenceCompleted OccurrenceStatus = "completed"
+	OccurrenceSkipped   OccurrenceStatus = "skipped"
+	OccurrenceMissed    OccurrenceStatus = "missed" // never stored, it's a planned occurrence that's been and gone
+)
+
+type PlannedWorkout struct {
+	ID              int       `json:"id"`
+	UserID          int       `json:"user_id"`
+	TemplateID      *int      `json:"template_id"`
+	Title           string    `json:"title"`
+	Notes           string    `json:"notes"`
+	StartsAt        time.Time `json:"starts_at"` // in TimeZone
+	TimeZone        string    `json:"time_zone"`
+	DurationMinutes int       `json:"duration_minutes"`
+	RRule           string    `json:"rrule"` // empty for a one off
+}
+
+// OccurrenceRecord is what happened to a single occurrence of a plan, completed with a workout or skipped
+type OccurrenceRecord struct {
+	ID               int              `json:"id"`
+	PlannedWorkoutID int              `json:"planned_workout_id"`
+	OccursAt         time.Time        `json:"occurs_at"`
+	Status           OccurrenceStatus `json:"status"`
+	WorkoutID        *int             `json:"workout_id"`
+	Note             string           `json:"note"`
+}
+
+func NewPostgresPlannedWorkoutStore(db *sql.DB) *PostgresPlannedWorkoutStore {
+	return &PostgresPlannedWorkoutStore{db: db}
+}
+
+const plannedWorkoutSelect = `
+	SELECT
+		id,
+		user_id,
+		template_id,
+		title,
+		COALESCE(notes, ''),
+		starts_at,
+		time_zone,
+		duration_minutes,
+		COALESCE(rrule, '')
+	FROM planned_workouts
+`
+
+func scanPlannedWorkout(scanner interface{ Scan(dest ...interface{}) error }) (*PlannedWorkout, error) {
+	plan := &PlannedWorkout{}
+
+	err := scanner.Scan(
+		&plan.ID,
+		&plan.UserID,
+		&plan.TemplateID,
+		&plan.Title,
+		&plan.Notes,
+		&plan.StartsAt,
+		&plan.TimeZone,
+		&plan.DurationMinutes,
+		&plan.RRule,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// postgres hands timestamps back in the connection's zone, put it back in the plan's own so the wall clock time is right
+	loc, err := time.LoadLocation(plan.TimeZone)
+	if err == nil {
+		plan.StartsAt = plan.StartsAt.In(loc)
+	}
+
+	return plan, nil
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func (pg *PostgresPlannedWorkoutStore) CreatePlannedWorkout(plan *PlannedWorkout) (*PlannedWorkout, error) {
+	query := `
+		INSERT INTO planned_workouts
+			(
+			user_id,
+			template_id,
+			title,
+			notes,
+			starts_at,
+			time_zone,
+			duration_minutes,
+			rrule
+			)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id;
+	`
+
+	err := pg.db.QueryRow(
+		query,
+		plan.UserID,
+		plan.TemplateID,
+		plan.Title,
+		plan.Notes,
+		plan.StartsAt,
+		plan.TimeZone,
+		plan.DurationMinutes,
+		nullIfEmpty(plan.RRule),
+	).Scan(&plan.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+func (pg *PostgresPlannedWorkoutStore) GetPlannedWorkoutById(id int64) (*PlannedWorkout, error) {
+	plan, err := scanPlannedWorkout(pg.db.QueryRow(plannedWorkoutSelect+` WHERE id = $1;`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no data for planned workout: %w", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+func (pg *PostgresPlannedWorkoutStore) ListPlannedWorkouts(userID int) ([]*PlannedWorkout, error) {
+	rows, err := pg.db.Query(plannedWorkoutSelect+` WHERE user_id = $1 ORDER BY starts_at, id;`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := []*PlannedWorkout{}
+	for rows.Next() {
+		plan, err := scanPlannedWorkout(rows)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return plans, nil
+}
+
+func (pg *PostgresPlannedWorkoutStore) UpdatePlannedWorkout(plan *PlannedWorkout, id int64) error {
+	query := `
+		UPDATE planned_workouts
+		SET
+			template_id = $1,
+			title = $2,
+			notes = $3,
+			starts_at = $4,
+			time_zone = $5,
+			duration_minutes = $6,
+			rrule = $7,
+			updated = CURRENT_TIMESTAMP
+		WHERE id = $8;
+	`
+
+	result, err := pg.db.Exec(
+		query,
+		plan.TemplateID,
+		plan.Title,
+		plan.Notes,
+		plan.StartsAt,
+		plan.TimeZone,
+		plan.DurationMinutes,
+		nullIfEmpty(plan.RRule),
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (pg *PostgresPlannedWorkoutStore) DeletePlannedWorkout(id int64) error {
+	result, err := pg.db.Exec(`DELETE FROM planned_workouts WHERE id = $1;`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (pg *PostgresPlannedWorkoutStore) GetPlannedWorkoutOwner(id int64) (int, error) {
+	var userID int
+
+	err := pg.db.QueryRow(`SELECT user_id FROM planned_workouts WHERE id = $1;`, id).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func (pg *PostgresPlannedWorkoutStore) ListOccurrenceRecords(userID int, from time.Time, to time.Time) ([]*OccurrenceRecord, error) {
+	query := `
+		SELECT
+			o.id,
+			o.planned_workout_id,
+			o.occurs_at,
+			o.status,
+			o.workout_id,
+			COALESCE(o.note, '')
+		FROM planned_workout_occurrences o
+		JOIN planned_workouts p on p.id = o.planned_workout_id
+		WHERE p.user_id = $1
+		AND o.occurs_at >= $2
+		AND o.occurs_at < $3
+		ORDER BY o.occurs_at;
+	`
+
+	rows, err := pg.db.Query(query, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []*OccurrenceRecord{}
+	for rows.Next() {
+		record := &OccurrenceRecord{}
+		err = rows.Scan(
+			&record.ID,
+			&record.PlannedWorkoutID,
+			&record.OccursAt,
+			&record.Status,
+			&record.WorkoutID,
+			&record.Note,
+		)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// RecordOccurrence upserts on (planned_workout_id, occurs_at) so a skipped session can later be marked as completed
+func (pg *PostgresPlannedWorkoutStore) RecordOccurrence(record *OccurrenceRecord) error {
+	query := `
+		INSERT INTO planned_workout_occurrences
+			(
+			planned_workout_id,
+			occurs_at,
+			status,
+			workout_id,
+			note
+			)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (planned_workout_id, occurs_at) DO UPDATE SET
+			status = excluded.status,
+			workout_id = excluded.workout_id,
+			note = excluded.note,
+			updated = CURRENT_TIMESTAMP
+		RETURNING id;
+	`
+
+	return pg.db.QueryRow(
+		query,
+		record.PlannedWorkoutID,
+		record.OccursAt,
+		string(record.Status),
+		record.WorkoutID,
+		record.Note,
+	).Scan(&record.ID)
+}
+
+func (pg *PostgresPlannedWorkoutStore) DeleteOccurrenceRecord(plannedWorkoutID int64, occursAt time.Time) error {
+	result, err := pg.db.Exec(`DELETE FROM planned_workout_occurrences WHERE planned_workout_id = $1 AND occurs_at = $2;`, plannedWorkoutID, occursAt)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,361 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+type TemplateStore interface {
+	CreateTemplate(*WorkoutTemplate) (*WorkoutTemplate, error)
+	GetTemplateById(id int64) (*WorkoutTemplate, error)
+	ListTemplates(userID int) ([]*WorkoutTemplate, error)
+	UpdateTemplate(template *WorkoutTemplate, id int64) error
+	DeleteTemplate(id int64) error
+	GetTemplateOwner(id int64) (int, error)
+}
+
+type PostgresTemplateStore struct {
+	db *sql.DB
+}
+
+type TemplateEntry struct {
+	ID              int      `json:"id"`
+	ExerciseID      *int     `json:"exercise_id"`
+	ExerciseName    string   `json:"exercise_name"`
+	SetCount        int      `json:"set_count"`
+	Reps            *int     `json:"reps"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	Weight          *float64 `json:"weight"`
+	WeightUnit      string   `json:"weight_unit"`
+	Notes           string   `json:"notes"`
+	OrderIndex      int      `json:"order_index"`
+}
+
+type WorkoutTemplate struct {
+	ID              int             `json:"id"`
+	UserID          int             `json:"user_id"`
+	Name            string          `json:"name"`
+	Description     string          `json:"description"`
+	DurationMinutes int             `json:"duration_minutes"` // rough guide, becomes the workout's duration unless overridden
+	Entries         []TemplateEntry `json:"entries"`
+}
+
+func NewPostgresTemplateStore(db *sql.DB) *PostgresTemplateStore {
+	return &PostgresTemplateStore{db: db}
+}
+
+// ToWorkout builds an unsaved workout from the template, entry IDs are left at 0 so they get inserted as new rows
+func (t *WorkoutTemplate) ToWorkout() *Workout {
+	workout := &Workout{
+		Title:           t.Name,
+		Description:     t.Description,
+		DurationMinutes: t.DurationMinutes,
+		Entries:         make([]WorkoutEntry, 0, len(t.Entries)),
+	}
+
+	for _, entry := range t.Entries {
+		workout.Entries = append(workout.Entries, WorkoutEntry{
+			ExerciseID:      entry.ExerciseID,
+			ExerciseName:    entry.ExerciseName,
+			SetCount:        entry.SetCount,
+			Reps:            entry.Reps,
+			DurationSeconds: entry.DurationSeconds,
+			Weight:          entry.Weight,
+			WeightUnit:      entry.WeightUnit,
+			Notes:           entry.Notes,
+			OrderIndex:      entry.OrderIndex,
+		})
+	}
+
+	return workout
+}
+
+func NewTemplateFromWorkout(workout *Workout) *WorkoutTemplate {
+	template := &WorkoutTemplate{
+		UserID:          workout.UserID,
+		Name:            workout.Title,
+		Description:     workout.Description,
+		DurationMinutes: workout.DurationMinutes,
+		Entries:         make([]TemplateEntry, 0, len(workout.Entries)),
+	}
+
+	for _, entry := range workout.Entries {
+		template.Entries = append(template.Entries, TemplateEntry{
+			ExerciseID:      entry.ExerciseID,
+			ExerciseName:    entry.ExerciseName,
+			SetCount:        entry.SetCount,
+			Reps:            entry.Reps,
+			DurationSeconds: entry.DurationSeconds,
+			Weight:          entry.Weight,
+			WeightUnit:      entry.WeightUnit,
+			Notes:           entry.Notes,
+			OrderIndex:      entry.OrderIndex,
+		})
+	}
+
+	return template
+}
+
+const templateEntryJSON = `
+	json_build_object(
+		'id', te.id,
+		'exercise_id', te.exercise_id,
+		'exercise_name', te.exercise_name,
+		'set_count', te.sets,
+		'reps', te.reps,
+		'duration_seconds', te.duration_seconds,
+		'weight', te.weight,
+		'weight_unit', te.weight_unit,
+		'notes', te.notes,
+		'order_index', te.order_index
+	)`
+
+const templateSelect = `
+	SELECT
+		t.id,
+		t.user_id,
+		t.name,
+		COALESCE(t.description, ''),
+		COALESCE(t.duration_minutes, 0),
+		COALESCE(
+			json_agg(` + templateEntryJSON + ` order by te.order_index) FILTER (WHERE te.id IS NOT NULL),
+			'[]'
+		) as entries
+	FROM workout_templates t
+	LEFT JOIN workout_template_entries te on te.template_id = t.id
+`
+
+func scanTemplate(scanner interface{ Scan(dest ...interface{}) error }) (*WorkoutTemplate, error) {
+	template := &WorkoutTemplate{}
+	var entriesRaw []byte
+
+	err := scanner.Scan(
+		&template.ID,
+		&template.UserID,
+		&template.Name,
+		&template.Description,
+		&template.DurationMinutes,
+		&entriesRaw,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(entriesRaw, &template.Entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (pg *PostgresTemplateStore) CreateTemplate(template *WorkoutTemplate) (*WorkoutTemplate, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO workout_templates
+			(
+			user_id,
+			name,
+			description,
+			duration_minutes
+			)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id;
+	`
+
+	err = tx.QueryRow(
+		query,
+		template.UserID,
+		template.Name,
+		template.Description,
+		template.DurationMinutes,
+	).Scan(&template.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertTemplateEntries(tx, int64(template.ID), template.Entries)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (pg *PostgresTemplateStore) GetTemplateById(id int64) (*WorkoutTemplate, error) {
+	query := templateSelect + `
+		WHERE t.id = $1
+		GROUP BY t.id;
+	`
+
+	template, err := scanTemplate(pg.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no data for template: %w", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (pg *PostgresTemplateStore) ListTemplates(userID int) ([]*WorkoutTemplate, error) {
+	query := templateSelect + `
+		WHERE t.user_id = $1
+		GROUP BY t.id
+		ORDER BY t.name, t.id;
+	`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []*WorkoutTemplate{}
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// UpdateTemplate replaces the template and all of its entries, nothing points at template entries so they're just recreated
+func (pg *PostgresTemplateStore) UpdateTemplate(template *WorkoutTemplate, id int64) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE workout_templates
+		SET
+			name = $1,
+			description = $2,
+			duration_minutes = $3,
+			updated = CURRENT_TIMESTAMP
+		WHERE id = $4;
+	`
+
+	result, err := tx.Exec(query, template.Name, template.Description, template.DurationMinutes, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.Exec(`DELETE FROM workout_template_entries WHERE template_id = $1;`, id)
+	if err != nil {
+		return err
+	}
+
+	err = insertTemplateEntries(tx, id, template.Entries)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertTemplateEntries(tx *sql.Tx, templateID int64, entries []TemplateEntry) error {
+	query := `
+		INSERT INTO workout_template_entries
+			(
+			template_id,
+			exercise_name,
+			sets,
+			reps,
+			duration_seconds,
+			weight,
+			notes,
+			order_index,
+			exercise_id,
+			weight_unit
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, COALESCE(NULLIF($10, ''), 'kg'))
+		RETURNING id;
+	`
+
+	for i := range entries {
+		entry := &entries[i]
+		err := tx.QueryRow(
+			query,
+			templateID,
+			entry.ExerciseName,
+			entry.SetCount,
+			entry.Reps,
+			entry.DurationSeconds,
+			entry.Weight,
+			entry.Notes,
+			entry.OrderIndex,
+			entry.ExerciseID,
+			entry.WeightUnit,
+		).Scan(&entry.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pg *PostgresTemplateStore) DeleteTemplate(id int64) error {
+	query := `DELETE FROM workout_templates WHERE id = $1;`
+
+	result, err := pg.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (pg *PostgresTemplateStore) GetTemplateOwner(id int64) (int, error) {
+	var userID int
+
+	query := `SELECT user_id FROM workout_templates WHERE id = $1;`
+
+	err := pg.db.QueryRow(query, id).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
@@ -14,6 +14,7 @@ type UserStore interface{
 	GetUserByUsername(username string) (*User, error)
 	UpdateUser(*User) error
 	GetUserToken(scope string, plainTextToken string) (*User, error) 
+	UpdatePreferences(user *User) error
 }
 
 type User struct {
@@ -22,6 +23,10 @@ type User struct {
 	Email        string 	`json:"email"`
 	PasswordHash password 	`json:"-"` // `json:"-"` means to ignore the value in the struct
 	Bio          string 	`json:"bio"`
+	PreferredUnit string 	`json:"preferred_unit"` // kg or lb, weights are shown in this unless the request asks for another
+	TimeZone     string 	`json:"time_zone"` // IANA zone new workouts default to and days are cut in
+	MaxHeartRate *int 	`json:"max_heart_rate"` // heart rate zones need both of these, nil until they're set
+	RestingHeartRate *int 	`json:"resting_heart_rate"`
 	CreatedAt    time.Time 	`json:"created_at"`
 	UpdatedAt    time.Time 	`json:"updated_at"`
 }
@@ -79,10 +84,12 @@ func (pg *PostgresUserStore) CreateUser(user *User) error {
 				username, 
 				email, 
 				password_hash, 
-				bio
+				bio,
+				preferred_unit,
+				time_zone
 			)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, updated;
+		VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'kg'), COALESCE(NULLIF($6, ''), 'UTC'))
+		RETURNING id, preferred_unit, time_zone, created_at, updated;
 	`
 
 	err := pg.db.QueryRow(
@@ -91,8 +98,12 @@ func (pg *PostgresUserStore) CreateUser(user *User) error {
 		user.Email,
 		user.PasswordHash.hash, 
 		user.Bio,
+		user.PreferredUnit,
+		user.TimeZone,
 	).Scan(
 		&user.ID, 
+		&user.PreferredUnit,
+		&user.TimeZone,
 		&user.CreatedAt, 
 		&user.UpdatedAt,
 	)
@@ -115,6 +126,10 @@ func (pg *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 		email,
 		password_hash,
 		bio,
+		preferred_unit,
+		time_zone,
+		max_heart_rate,
+		resting_heart_rate,
 		created_at,
 		updated
 	FROM users 
@@ -128,6 +143,10 @@ func (pg *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.PreferredUnit,
+		&user.TimeZone,
+		&user.MaxHeartRate,
+		&user.RestingHeartRate,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -183,6 +202,10 @@ func (pg *PostgresUserStore) GetUserToken(scope string, plainTextToken string) (
 			u.email,
 			u.password_hash,
 			u.bio,
+			u.preferred_unit,
+			u.time_zone,
+			u.max_heart_rate,
+			u.resting_heart_rate,
 			u.created_at,
 			u.updated
 		FROM users u
@@ -202,6 +225,10 @@ func (pg *PostgresUserStore) GetUserToken(scope string, plainTextToken string) (
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.PreferredUnit,
+		&user.TimeZone,
+		&user.MaxHeartRate,
+		&user.RestingHeartRate,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -213,4 +240,34 @@ func (pg *PostgresUserStore) GetUserToken(scope string, plainTextToken string) (
 	}
 
 	return user, nil
+}
+
+// UpdatePreferences saves the user's preferred unit, time zone and heart rates as they are on user
+func (pg *PostgresUserStore) UpdatePreferences(user *User) error {
+	query := `
+		UPDATE users
+		SET
+			preferred_unit = $1,
+			time_zone = $2,
+			max_heart_rate = $3,
+			resting_heart_rate = $4,
+			updated = CURRENT_TIMESTAMP
+		WHERE id = $5;
+	`
+
+	result, err := pg.db.Exec(query, user.PreferredUnit, user.TimeZone, user.MaxHeartRate, user.RestingHeartRate, user.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,538 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// CreateWorkouts inserts every workout in one transaction, all or nothing. Each table is written with a single
+// INSERT ... SELECT FROM unnest over arrays rather than a statement per row, IDs are taken from the sequences up front
+// so groups, entries and sets can point at their parents without anything being read back in between.
+// The workouts are read back at the end so they come back the same as from CreateWorkout
+func (pg *PostgresWorkoutStore) CreateWorkouts(workouts []*Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertWorkoutRows(tx, workouts)
+	if err != nil {
+		return err
+	}
+
+	groupIDs, err := insertEntryGroupRows(tx, workouts)
+	if err != nil {
+		return err
+	}
+
+	err = insertWorkoutEntryRows(tx, workouts, groupIDs)
+	if err != nil {
+		return err
+	}
+
+	err = insertWorkoutSetRows(tx, workouts)
+	if err != nil {
+		return err
+	}
+
+	workoutIDs := make([]int64, len(workouts))
+	for i, workout := range workouts {
+		workoutIDs[i] = int64(workout.ID)
+	}
+
+	created, err := listWorkoutsByID(tx, workoutIDs)
+	if err != nil {
+		return err
+	}
+
+	err = insertCreateRevisions(tx, created)
+	if err != nil {
+		return err
+	}
+
+	for _, workout := range created {
+		_, err = savePersonalRecords(tx, workout)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	for i, workout := range workouts {
+		*workouts[i] = *created[workout.ID]
+	}
+
+	return nil
+}
+
+// nextIDs takes n values from the table's id sequence
+func nextIDs(tx *sql.Tx, table string, n int) ([]int64, error) {
+	rows, err := tx.Query(`SELECT nextval(pg_get_serial_sequence($1, 'id')) FROM generate_series(1, $2);`, table, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0, n)
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func insertWorkoutRows(tx *sql.Tx, workouts []*Workout) error {
+	ids, err := nextIDs(tx, "workouts", len(workouts))
+	if err != nil {
+		return err
+	}
+
+	userIDs := make([]int64, len(workouts))
+	titles := make([]string, len(workouts))
+	descriptions := make([]string, len(workouts))
+	durations := make([]int, len(workouts))
+	calories := make([]int, len(workouts))
+	caloriesSources := make([]string, len(workouts))
+	sessionRPEs := make([]*int, len(workouts))
+	startedAts := make([]*time.Time, len(workouts))
+	endedAts := make([]*time.Time, len(workouts))
+	timeZones := make([]string, len(workouts))
+
+	for i, workout := range workouts {
+		workout.ID = int(ids[i])
+		userIDs[i] = int64(workout.UserID)
+		titles[i] = workout.Title
+		descriptions[i] = workout.Description
+		durations[i] = workout.DurationMinutes
+		calories[i] = workout.CaloriesBurned
+		caloriesSources[i] = workout.CaloriesSource
+		sessionRPEs[i] = workout.SessionRPE
+		startedAts[i] = timeOrNil(workout.StartedAt)
+		endedAts[i] = workout.EndedAt
+		timeZones[i] = workout.TimeZone
+	}
+
+	query := `
+		INSERT INTO workouts
+			(
+			id,
+			user_id,
+			title,
+			description,
+			duration_minutes,
+			calories_burned,
+			calories_source,
+			session_rpe,
+			started_at,
+			ended_at,
+			time_zone
+			)
+		SELECT
+			id,
+			user_id,
+			title,
+			description,
+			duration_minutes,
+			calories_burned,
+			COALESCE(NULLIF(calories_source, ''), 'measured'),
+			session_rpe,
+			COALESCE(started_at, CURRENT_TIMESTAMP),
+			ended_at,
+			COALESCE(NULLIF(time_zone, ''), 'UTC')
+		FROM unnest(
+			$1::bigint[], $2::bigint[], $3::text[], $4::text[], $5::int[], $6::int[],
+			$7::text[], $8::int[], $9::timestamptz[], $10::timestamptz[], $11::text[]
+		) AS w(id, user_id, title, description, duration_minutes, calories_burned, calories_source, session_rpe, started_at, ended_at, time_zone);
+	`
+
+	_, err = tx.Exec(
+		query,
+		ids,
+		userIDs,
+		titles,
+		descriptions,
+		durations,
+		calories,
+		caloriesSources,
+		sessionRPEs,
+		startedAts,
+		endedAts,
+		timeZones,
+	)
+	return err
+}
+
+// insertEntryGroupRows returns the new group IDs per workout, by position, for the entries to point at
+func insertEntryGroupRows(tx *sql.Tx, workouts []*Workout) ([][]int64, error) {
+	total := 0
+	for _, workout := range workouts {
+		total += len(workout.Groups)
+	}
+
+	groupIDs := make([][]int64, len(workouts))
+	if total == 0 {
+		return groupIDs, nil
+	}
+
+	ids, err := nextIDs(tx, "workout_entry_groups", total)
+	if err != nil {
+		return nil, err
+	}
+
+	workoutIDs := make([]int64, 0, total)
+	positions := make([]int, 0, total)
+	types := make([]string, 0, total)
+	rounds := make([]int, 0, total)
+	restSeconds := make([]*int, 0, total)
+	timeCaps := make([]*int, 0, total)
+	notes := make([]string, 0, total)
+
+	next := 0
+	for i, workout := range workouts {
+		for position := range workout.Groups {
+			group := &workout.Groups[position]
+			group.ID = int(ids[next])
+			groupIDs[i] = append(groupIDs[i], ids[next])
+			next++
+
+			workoutIDs = append(workoutIDs, int64(workout.ID))
+			positions = append(positions, position)
+			types = append(types, group.Type)
+			rounds = append(rounds, group.Rounds)
+			restSeconds = append(restSeconds, group.RestSeconds)
+			timeCaps = append(timeCaps, group.TimeCapSeconds)
+			notes = append(notes, group.Notes)
+		}
+	}
+
+	query := `
+		INSERT INTO workout_entry_groups
+			(
+			id,
+			workout_id,
+			position,
+			group_type,
+			rounds,
+			rest_seconds,
+			time_cap_seconds,
+			notes
+		)
+		SELECT *
+		FROM unnest($1::bigint[], $2::bigint[], $3::int[], $4::text[], $5::int[], $6::int[], $7::int[], $8::text[]);
+	`
+
+	_, err = tx.Exec(query, ids, workoutIDs, positions, types, rounds, restSeconds, timeCaps, notes)
+	if err != nil {
+		return nil, err
+	}
+
+	return groupIDs, nil
+}
+
+func insertWorkoutEntryRows(tx *sql.Tx, workouts []*Workout, groupIDs [][]int64) error {
+	total := 0
+	for _, workout := range workouts {
+		total += len(workout.Entries)
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	ids, err := nextIDs(tx, "workout_entries", total)
+	if err != nil {
+		return err
+	}
+
+	workoutIDs := make([]int64, 0, total)
+	exerciseNames := make([]string, 0, total)
+	setCounts := make([]int, 0, total)
+	reps := make([]*int, 0, total)
+	durations := make([]*int, 0, total)
+	weights := make([]*float64, 0, total)
+	notes := make([]string, 0, total)
+	orderIndexes := make([]int, 0, total)
+	exerciseIDs := make([]*int, 0, total)
+	weightUnits := make([]string, 0, total)
+	entryGroupIDs := make([]*int64, 0, total)
+	distances := make([]*float64, 0, total)
+	distanceUnits := make([]string, 0, total)
+	paces := make([]*float64, 0, total)
+	avgHeartRates := make([]*int, 0, total)
+	maxHeartRates := make([]*int, 0, total)
+	cadences := make([]*int, 0, total)
+	powers := make([]*int, 0, total)
+	elevationGains := make([]*float64, 0, total)
+
+	next := 0
+	for i, workout := range workouts {
+		for j := range workout.Entries {
+			entry := &workout.Entries[j]
+			entry.summariseSets()
+			entry.summariseCardio()
+			entry.ID = int(ids[next])
+			next++
+
+			// a group_index with no group behind it is stored as no group, same as insertWorkoutEntry's subquery
+			var groupID *int64
+			if entry.GroupIndex != nil && *entry.GroupIndex >= 0 && *entry.GroupIndex < len(groupIDs[i]) {
+				groupID = &groupIDs[i][*entry.GroupIndex]
+			}
+
+			workoutIDs = append(workoutIDs, int64(workout.ID))
+			exerciseNames = append(exerciseNames, entry.ExerciseName)
+			setCounts = append(setCounts, entry.SetCount)
+			reps = append(reps, entry.Reps)
+			durations = append(durations, entry.DurationSeconds)
+			weights = append(weights, entry.Weight)
+			notes = append(notes, entry.Notes)
+			orderIndexes = append(orderIndexes, entry.OrderIndex)
+			exerciseIDs = append(exerciseIDs, entry.ExerciseID)
+			weightUnits = append(weightUnits, entry.WeightUnit)
+			entryGroupIDs = append(entryGroupIDs, groupID)
+			distances = append(distances, entry.Distance)
+			distanceUnits = append(distanceUnits, entry.DistanceUnit)
+			paces = append(paces, entry.PaceSecondsPerKm)
+			avgHeartRates = append(avgHeartRates, entry.AvgHeartRate)
+			maxHeartRates = append(maxHeartRates, entry.MaxHeartRate)
+			cadences = append(cadences, entry.Cadence)
+			powers = append(powers, entry.Power)
+			elevationGains = append(elevationGains, entry.ElevationGainMeters)
+		}
+	}
+
+	query := `
+		INSERT INTO workout_entries
+			(
+			id,
+			workout_id,
+			exercise_name,
+			sets,
+			reps,
+			duration_seconds,
+			weight,
+			notes,
+			order_index,
+			exercise_id,
+			weight_unit,
+			group_id,
+			distance_meters,
+			distance_unit,
+			pace_seconds_per_km,
+			avg_heart_rate,
+			max_heart_rate,
+			cadence,
+			power,
+			elevation_gain_meters
+		)
+		SELECT
+			id,
+			workout_id,
+			exercise_name,
+			sets,
+			reps,
+			duration_seconds,
+			weight,
+			notes,
+			order_index,
+			exercise_id,
+			COALESCE(NULLIF(weight_unit, ''), 'kg'),
+			group_id,
+			distance_meters,
+			COALESCE(NULLIF(distance_unit, ''), 'km'),
+			pace_seconds_per_km,
+			avg_heart_rate,
+			max_heart_rate,
+			cadence,
+			power,
+			elevation_gain_meters
+		FROM unnest(
+			$1::bigint[], $2::bigint[], $3::text[], $4::int[], $5::int[], $6::int[],
+			$7::float8[], $8::text[], $9::int[], $10::bigint[], $11::text[], $12::bigint[],
+			$13::float8[], $14::text[], $15::float8[], $16::int[], $17::int[], $18::int[], $19::int[], $20::float8[]
+		) AS e(
+			id, workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index, exercise_id, weight_unit, group_id,
+			distance_meters, distance_unit, pace_seconds_per_km, avg_heart_rate, max_heart_rate, cadence, power, elevation_gain_meters
+		);
+	`
+
+	_, err = tx.Exec(
+		query,
+		ids,
+		workoutIDs,
+		exerciseNames,
+		setCounts,
+		reps,
+		durations,
+		weights,
+		notes,
+		orderIndexes,
+		exerciseIDs,
+		weightUnits,
+		entryGroupIDs,
+		distances,
+		distanceUnits,
+		paces,
+		avgHeartRates,
+		maxHeartRates,
+		cadences,
+		powers,
+		elevationGains,
+	)
+	return err
+}
+
+func insertWorkoutSetRows(tx *sql.Tx, workouts []*Workout) error {
+	entryIDs := []int64{}
+	setNumbers := []int{}
+	reps := []*int{}
+	durations := []*int{}
+	weights := []*float64{}
+	rpes := []*float64{}
+	rirs := []*int{}
+	restSeconds := []*int{}
+	warmups := []bool{}
+	dropSets := []bool{}
+	failures := []bool{}
+
+	for _, workout := range workouts {
+		for _, entry := range workout.Entries {
+			for _, set := range entry.Sets {
+				entryIDs = append(entryIDs, int64(entry.ID))
+				setNumbers = append(setNumbers, set.SetNumber)
+				reps = append(reps, set.Reps)
+				durations = append(durations, set.DurationSeconds)
+				weights = append(weights, set.Weight)
+				rpes = append(rpes, set.RPE)
+				rirs = append(rirs, set.RIR)
+				restSeconds = append(restSeconds, set.RestSeconds)
+				warmups = append(warmups, set.IsWarmup)
+				dropSets = append(dropSets, set.IsDropSet)
+				failures = append(failures, set.IsFailure)
+			}
+		}
+	}
+
+	if len(entryIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO workout_sets
+			(
+			entry_id,
+			set_number,
+			reps,
+			duration_seconds,
+			weight,
+			rpe,
+			rir,
+			rest_seconds,
+			is_warmup,
+			is_drop_set,
+			is_failure
+		)
+		SELECT *
+		FROM unnest(
+			$1::bigint[], $2::int[], $3::int[], $4::int[], $5::float8[], $6::float8[],
+			$7::int[], $8::int[], $9::bool[], $10::bool[], $11::bool[]
+		);
+	`
+
+	_, err := tx.Exec(query, entryIDs, setNumbers, reps, durations, weights, rpes, rirs, restSeconds, warmups, dropSets, failures)
+	return err
+}
+
+// listWorkoutsByID reads trashed workouts too, it's only used on workouts that were just written
+func listWorkoutsByID(q queryer, ids []int64) (map[int]*Workout, error) {
+	query := workoutSelect + `
+		WHERE w.id = ANY($1)
+		GROUP BY w.id;
+	`
+
+	rows, err := q.Query(query, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workouts := map[int]*Workout{}
+	for rows.Next() {
+		workout, err := scanWorkout(rows)
+		if err != nil {
+			return nil, err
+		}
+		workouts[workout.ID] = workout
+	}
+
+	return workouts, rows.Err()
+}
+
+// insertCreateRevisions is recordRevision for a batch of brand new workouts, they're all at revision 1
+func insertCreateRevisions(tx *sql.Tx, workouts map[int]*Workout) error {
+	workoutIDs := make([]int64, 0, len(workouts))
+	snapshots := make([]string, 0, len(workouts))
+
+	for id, workout := range workouts {
+		snapshot, err := json.Marshal(workout)
+		if err != nil {
+			return err
+		}
+
+		workoutIDs = append(workoutIDs, int64(id))
+		snapshots = append(snapshots, string(snapshot))
+	}
+
+	query := `
+		INSERT INTO workout_revisions (workout_id, revision, action, snapshot)
+		SELECT workout_id, 1, $3, snapshot::jsonb
+		FROM unnest($1::bigint[], $2::text[]) AS r(workout_id, snapshot);
+	`
+
+	_, err := tx.Exec(query, workoutIDs, snapshots, RevisionCreate)
+	return err
+}
+
+// ListWorkoutStartTimes returns when each of the user's workouts between from and to (inclusive) started, trashed ones
+// included, so an import can tell which workouts it's already brought in
+func (pg *PostgresWorkoutStore) ListWorkoutStartTimes(userID int, from time.Time, to time.Time) ([]time.Time, error) {
+	query := `
+		SELECT started_at
+		FROM workouts
+		WHERE user_id = $1
+		AND started_at BETWEEN $2 AND $3;
+	`
+
+	rows, err := pg.db.Query(query, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	times := []time.Time{}
+	for rows.Next() {
+		var startedAt time.Time
+		err = rows.Scan(&startedAt)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, startedAt)
+	}
+
+	return times, rows.Err()
+}
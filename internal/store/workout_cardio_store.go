@@ -0,0 +1,39 @@
+package store
+
+import "math"
+
+// maxPaceSecondsPerKm is a day per kilometre, a pace slower than that comes from a distance too short to mean
+// anything and it would soon outgrow pace_seconds_per_km's NUMERIC(8,2)
+const maxPaceSecondsPerKm = 24 * 60 * 60
+
+// IsCardio is true when the entry has any of the cardio fields, a run or a row rather than a lift
+func (e *WorkoutEntry) IsCardio() bool {
+	return e.Distance != nil ||
+		e.AvgHeartRate != nil ||
+		e.MaxHeartRate != nil ||
+		e.Cadence != nil ||
+		e.Power != nil ||
+		e.ElevationGainMeters != nil
+}
+
+// summariseCardio fills in what a cardio entry leaves out: one set when set_count wasn't sent, as a 5 km run is one
+// of them, and the pace whenever there's a distance and a duration to work it out from. A pace that was sent is
+// replaced so it can never disagree with the distance and time, and left out when it's slower than maxPaceSecondsPerKm
+func (e *WorkoutEntry) summariseCardio() {
+	if !e.IsCardio() {
+		e.PaceSecondsPerKm = nil
+		return
+	}
+
+	if e.SetCount == 0 {
+		e.SetCount = 1
+	}
+
+	e.PaceSecondsPerKm = nil
+	if e.Distance != nil && *e.Distance > 0 && e.DurationSeconds != nil {
+		pace := math.Round(float64(*e.DurationSeconds)/(*e.Distance/1000)*100) / 100
+		if pace <= maxPaceSecondsPerKm {
+			e.PaceSecondsPerKm = &pace
+		}
+	}
+}
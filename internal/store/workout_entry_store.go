@@ -0,0 +1,312 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+var (
+	ErrOrderIndexTaken = errors.New("order_index is already used by another entry in this workout")
+	ErrInvalidReorder  = errors.New("reorder must list every entry in the workout exactly once")
+)
+
+func (pg *PostgresWorkoutStore) ListWorkoutEntries(workoutID int64) ([]WorkoutEntry, error) {
+	return listWorkoutEntries(pg.db, workoutID)
+}
+
+func listWorkoutEntries(q queryer, workoutID int64) ([]WorkoutEntry, error) {
+	var entriesRaw []byte
+
+	query := `
+		SELECT COALESCE(json_agg(` + workoutEntryJSON + ` order by e.order_index), '[]')
+		FROM workout_entries e
+		WHERE e.workout_id = $1;
+	`
+
+	err := q.QueryRow(query, workoutID).Scan(&entriesRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []WorkoutEntry{}
+	err = json.Unmarshal(entriesRaw, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (pg *PostgresWorkoutStore) GetWorkoutEntry(workoutID int64, entryID int64) (*WorkoutEntry, error) {
+	return getWorkoutEntry(pg.db, workoutID, entryID)
+}
+
+func getWorkoutEntry(q queryer, workoutID int64, entryID int64) (*WorkoutEntry, error) {
+	var entryRaw []byte
+
+	query := `
+		SELECT ` + workoutEntryJSON + `
+		FROM workout_entries e
+		WHERE e.workout_id = $1
+		AND e.id = $2;
+	`
+
+	err := q.QueryRow(query, workoutID, entryID).Scan(&entryRaw)
+	if err != nil {
+		return nil, err // sql.ErrNoRows when it doesn't exist or isn't part of this workout
+	}
+
+	entry := &WorkoutEntry{}
+	err = json.Unmarshal(entryRaw, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// CreateWorkoutEntry adds entry to the end of the workout unless it already has an order_index, returns the records it set
+func (pg *PostgresWorkoutStore) CreateWorkoutEntry(workoutID int64, entry *WorkoutEntry) ([]*PersonalRecord, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = lockWorkout(tx, workoutID)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.OrderIndex == 0 {
+		err = tx.QueryRow(`SELECT COALESCE(MAX(order_index), 0) + 1 FROM workout_entries WHERE workout_id = $1;`, workoutID).Scan(&entry.OrderIndex)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err = checkOrderIndexFree(tx, workoutID, 0, entry.OrderIndex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = checkGroupIndex(tx, workoutID, entry.GroupIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertWorkoutEntry(tx, workoutID, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	_, newRecords, err := recordRevision(tx, workoutID, RevisionUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return newRecords, nil
+}
+
+func (pg *PostgresWorkoutStore) PatchWorkoutEntry(workoutID int64, entryID int64, apply func(*WorkoutEntry) error) (*WorkoutEntry, []*PersonalRecord, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	err = lockWorkout(tx, workoutID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry, err := getWorkoutEntry(tx, workoutID, entryID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	groupBefore := entry.GroupIndex
+
+	err = apply(entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry.ID = int(entryID)
+
+	err = checkOrderIndexFree(tx, workoutID, entryID, entry.OrderIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = checkGroupIndex(tx, workoutID, entry.GroupIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = updateWorkoutEntry(tx, workoutID, entry)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if groupBefore != nil && (entry.GroupIndex == nil || *entry.GroupIndex != *groupBefore) {
+		err = checkGroupSize(tx, workoutID, groupBefore)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	_, newRecords, err := recordRevision(tx, workoutID, RevisionUpdate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entry, newRecords, nil
+}
+
+func (pg *PostgresWorkoutStore) DeleteWorkoutEntry(workoutID int64, entryID int64) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockWorkout(tx, workoutID)
+	if err != nil {
+		return err
+	}
+
+	entry, err := getWorkoutEntry(tx, workoutID, entryID)
+	if err != nil {
+		return err // sql.ErrNoRows when it doesn't exist or isn't part of this workout
+	}
+
+	_, err = tx.Exec(`DELETE FROM workout_entries WHERE workout_id = $1 AND id = $2;`, workoutID, entryID)
+	if err != nil {
+		return err
+	}
+
+	err = checkGroupSize(tx, workoutID, entry.GroupIndex)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = recordRevision(tx, workoutID, RevisionUpdate)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReorderWorkoutEntries sets order_index to each entry's position in entryIDs (starting at 1)
+// the unique constraint on order_index is deferred so entries can swap places mid transaction
+func (pg *PostgresWorkoutStore) ReorderWorkoutEntries(workoutID int64, entryIDs []int64) ([]WorkoutEntry, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = lockWorkout(tx, workoutID)
+	if err != nil {
+		return nil, err
+	}
+
+	// every existing entry has to be in the list exactly once, otherwise we'd end up with gaps or clashes
+	var matched, total int
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE id = ANY($2)),
+			COUNT(*)
+		FROM workout_entries
+		WHERE workout_id = $1;
+	`
+	err = tx.QueryRow(query, workoutID, entryIDs).Scan(&matched, &total)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[int64]bool{}
+	for _, id := range entryIDs {
+		if seen[id] {
+			return nil, ErrInvalidReorder
+		}
+		seen[id] = true
+	}
+
+	if matched != total || len(entryIDs) != total {
+		return nil, ErrInvalidReorder
+	}
+
+	query = `
+		UPDATE workout_entries e
+		SET
+			order_index = v.position,
+			updated = CURRENT_TIMESTAMP
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS v(id, position)
+		WHERE e.id = v.id
+		AND e.workout_id = $1;
+	`
+	_, err = tx.Exec(query, workoutID, entryIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := listWorkoutEntries(tx, workoutID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, err = recordRevision(tx, workoutID, RevisionUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// lockWorkout serialises changes to a workout's entries so order_index checks can't race each other
+func lockWorkout(tx *sql.Tx, workoutID int64) error {
+	var lockedID int64
+	return tx.QueryRow(`SELECT id FROM workouts WHERE id = $1 AND deleted_at IS NULL FOR UPDATE;`, workoutID).Scan(&lockedID)
+}
+
+// checkOrderIndexFree gives a friendlier error than the unique constraint, entryID is ignored so an entry can keep its own index
+func checkOrderIndexFree(tx *sql.Tx, workoutID int64, entryID int64, orderIndex int) error {
+	var taken bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM workout_entries
+			WHERE workout_id = $1
+			AND order_index = $2
+			AND id <> $3
+		);
+	`
+
+	err := tx.QueryRow(query, workoutID, orderIndex, entryID).Scan(&taken)
+	if err != nil {
+		return err
+	}
+
+	if taken {
+		return ErrOrderIndexTaken
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"time"
+)
+
+// ExportRow is one line of an export: an entry, or one of its sets when it has them. The entry fields are all nil
+// for a workout with no entries so it still gets a line
+type ExportRow struct {
+	WorkoutID       int
+	Title           string
+	StartedAt       time.Time
+	EndedAt         *time.Time
+	TimeZone        string
+	DurationMinutes int
+	CaloriesBurned  int
+	CaloriesSource  string
+	SessionRPE      *int
+	ExerciseName    *string
+	OrderIndex      *int
+	GroupType       *string
+	SetCount        *int // the entry's, repeated on each of its set rows
+	SetNumber       *int // nil unless the row is a single set
+	Reps            *int
+	DurationSeconds *int
+	Weight          *float64 // kg
+	RPE             *float64
+	RIR             *int
+	RestSeconds     *int
+	IsWarmup        *bool
+	IsDropSet       *bool
+	IsFailure       *bool
+	Notes           *string
+	// the cardio figures are the entry's, repeated on each of its set rows like SetCount
+	Distance            *float64 // metres
+	DistanceUnit        *string
+	PaceSecondsPerKm    *float64
+	AvgHeartRate        *int
+	MaxHeartRate        *int
+	Cadence             *int
+	Power               *int
+	ElevationGainMeters *float64
+}
+
+// ExportWorkouts calls row for each line of the user's history, oldest first, as it's read off the connection
+// so a big history is never held in memory. Only the UserID, From and To of filter are used.
+// An error from row stops the export and is returned as is
+func (pg *PostgresWorkoutStore) ExportWorkouts(filter WorkoutFilter, row func(*ExportRow) error) error {
+	args := queryArgs{}
+	where := "w.user_id = " + args.add(filter.UserID) + " AND w.deleted_at IS NULL"
+	if filter.From != nil {
+		where += " AND w.started_at >= " + args.add(*filter.From)
+	}
+	if filter.To != nil {
+		where += " AND w.started_at < " + args.add(*filter.To)
+	}
+
+	// set rows take their figures from the set, entry rows from the entry
+	query := `
+		SELECT
+			w.id,
+			w.title,
+			w.started_at,
+			w.ended_at,
+			w.time_zone,
+			w.duration_minutes,
+			COALESCE(w.calories_burned, 0),
+			w.calories_source,
+			w.session_rpe,
+			e.exercise_name,
+			e.order_index,
+			g.group_type,
+			e.sets,
+			ws.set_number,
+			CASE WHEN ws.id IS NULL THEN e.reps ELSE ws.reps END,
+			CASE WHEN ws.id IS NULL THEN e.duration_seconds ELSE ws.duration_seconds END,
+			CASE WHEN ws.id IS NULL THEN e.weight ELSE ws.weight END,
+			ws.rpe,
+			ws.rir,
+			ws.rest_seconds,
+			ws.is_warmup,
+			ws.is_drop_set,
+			ws.is_failure,
+			e.notes,
+			e.distance_meters,
+			e.distance_unit,
+			e.pace_seconds_per_km,
+			e.avg_heart_rate,
+			e.max_heart_rate,
+			e.cadence,
+			e.power,
+			e.elevation_gain_meters
+		FROM workouts w
+		LEFT JOIN workout_entries e ON e.workout_id = w.id
+		LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+		LEFT JOIN workout_sets ws ON ws.entry_id = e.id
+		WHERE ` + where + `
+		ORDER BY w.started_at, w.id, e.order_index, ws.set_number;
+	`
+
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		exportRow := &ExportRow{}
+		err = rows.Scan(
+			&exportRow.WorkoutID,
+			&exportRow.Title,
+			&exportRow.StartedAt,
+			&exportRow.EndedAt,
+			&exportRow.TimeZone,
+			&exportRow.DurationMinutes,
+			&exportRow.CaloriesBurned,
+			&exportRow.CaloriesSource,
+			&exportRow.SessionRPE,
+			&exportRow.ExerciseName,
+			&exportRow.OrderIndex,
+			&exportRow.GroupType,
+			&exportRow.SetCount,
+			&exportRow.SetNumber,
+			&exportRow.Reps,
+			&exportRow.DurationSeconds,
+			&exportRow.Weight,
+			&exportRow.RPE,
+			&exportRow.RIR,
+			&exportRow.RestSeconds,
+			&exportRow.IsWarmup,
+			&exportRow.IsDropSet,
+			&exportRow.IsFailure,
+			&exportRow.Notes,
+			&exportRow.Distance,
+			&exportRow.DistanceUnit,
+			&exportRow.PaceSecondsPerKm,
+			&exportRow.AvgHeartRate,
+			&exportRow.MaxHeartRate,
+			&exportRow.Cadence,
+			&exportRow.Power,
+			&exportRow.ElevationGainMeters,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = row(exportRow)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
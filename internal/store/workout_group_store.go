@@ -0,0 +1,148 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrGroupNotFound = errors.New("group_index does not match a group in this workout")
+	ErrGroupTooSmall = errors.New("group would be left with too few entries, change or remove the group first")
+)
+
+var EntryGroupTypes = []string{"superset", "giant_set", "circuit", "emom", "amrap"}
+
+// MinGroupEntries is how many entries each type of group needs before it's really that kind of group
+var MinGroupEntries = map[string]int{
+	"superset":  2,
+	"giant_set": 3,
+	"circuit":   2,
+	"emom":      1,
+	"amrap":     1,
+}
+
+// EntryGroup ties entries together that are done back to back, entries join one with their group_index
+type EntryGroup struct {
+	ID             int    `json:"id"`
+	Type           string `json:"type"`
+	Rounds         int    `json:"rounds"`           // rounds completed for an amrap
+	RestSeconds    *int   `json:"rest_seconds"`     // rest after each round
+	TimeCapSeconds *int   `json:"time_cap_seconds"` // amrap only
+	Notes          string `json:"notes"`
+	EntryIDs       []int  `json:"entry_ids"` // filled in on the way out, in order, ignored on the way in
+}
+
+// entryGroupJSON builds a single group (aliased as g) in the same shape as EntryGroup
+const entryGroupJSON = `
+	json_build_object(
+		'id', g.id,
+		'type', g.group_type,
+		'rounds', g.rounds,
+		'rest_seconds', g.rest_seconds,
+		'time_cap_seconds', g.time_cap_seconds,
+		'notes', COALESCE(g.notes, ''),
+		'entry_ids', COALESCE(
+			(SELECT json_agg(ge.id order by ge.order_index) FROM workout_entries ge WHERE ge.group_id = g.id),
+			'[]'
+		)
+	)`
+
+// syncEntryGroups makes the workout's groups match groups, matched up by position so a group keeps its ID for as long
+// as it keeps its place. Has to run before the entries are written so their group_index has something to point at
+func syncEntryGroups(tx *sql.Tx, workoutID int64, groups []EntryGroup) error {
+	_, err := tx.Exec(`DELETE FROM workout_entry_groups WHERE workout_id = $1 AND position >= $2;`, workoutID, len(groups))
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO workout_entry_groups
+			(
+			workout_id,
+			position,
+			group_type,
+			rounds,
+			rest_seconds,
+			time_cap_seconds,
+			notes
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (workout_id, position) DO UPDATE SET
+			group_type = EXCLUDED.group_type,
+			rounds = EXCLUDED.rounds,
+			rest_seconds = EXCLUDED.rest_seconds,
+			time_cap_seconds = EXCLUDED.time_cap_seconds,
+			notes = EXCLUDED.notes
+		RETURNING id;
+	`
+
+	for i := range groups {
+		group := &groups[i]
+		err = tx.QueryRow(
+			query,
+			workoutID,
+			i,
+			group.Type,
+			group.Rounds,
+			group.RestSeconds,
+			group.TimeCapSeconds,
+			group.Notes,
+		).Scan(&group.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkGroupIndex is for writes of a single entry, where the groups aren't being written alongside it
+func checkGroupIndex(tx *sql.Tx, workoutID int64, groupIndex *int) error {
+	if groupIndex == nil {
+		return nil
+	}
+
+	var exists bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM workout_entry_groups WHERE workout_id = $1 AND position = $2);`, workoutID, *groupIndex).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrGroupNotFound
+	}
+
+	return nil
+}
+
+// checkGroupSize is for writes of a single entry that take it out of its group, the group it was in still has to
+// have as many entries as its type needs
+func checkGroupSize(tx *sql.Tx, workoutID int64, groupIndex *int) error {
+	if groupIndex == nil {
+		return nil
+	}
+
+	var groupType string
+	var entries int
+	query := `
+		SELECT g.group_type, (SELECT COUNT(*) FROM workout_entries e WHERE e.group_id = g.id)
+		FROM workout_entry_groups g
+		WHERE g.workout_id = $1
+		AND g.position = $2;
+	`
+
+	err := tx.QueryRow(query, workoutID, *groupIndex).Scan(&groupType, &entries)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if entries < MinGroupEntries[groupType] {
+		return fmt.Errorf("%w: a %s needs at least %d entries", ErrGroupTooSmall, groupType, MinGroupEntries[groupType])
+	}
+
+	return nil
+}
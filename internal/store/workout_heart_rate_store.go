@@ -0,0 +1,67 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+// HeartRateSample is one heart rate reading during a workout
+type HeartRateSample struct {
+	OffsetSeconds int `json:"offset_seconds"` // from the workout's started_at
+	BPM           int `json:"bpm"`
+}
+
+// ReplaceHeartRateSamples swaps whatever samples the workout had for these, they're expected in offset order
+func (pg *PostgresWorkoutStore) ReplaceHeartRateSamples(workoutID int64, samples []HeartRateSample) error {
+	offsets := make([]int, len(samples))
+	bpm := make([]int, len(samples))
+	for i, sample := range samples {
+		offsets[i] = sample.OffsetSeconds
+		bpm[i] = sample.BPM
+	}
+
+	query := `
+		INSERT INTO workout_heart_rates (workout_id, offsets, bpm)
+		VALUES ($1, $2::int[], $3::smallint[])
+		ON CONFLICT (workout_id) DO UPDATE
+		SET offsets = EXCLUDED.offsets, bpm = EXCLUDED.bpm, uploaded_at = CURRENT_TIMESTAMP;
+	`
+
+	_, err := pg.db.Exec(query, workoutID, offsets, bpm)
+	return err
+}
+
+// GetHeartRateSamples returns nil when no samples have been uploaded for the workout
+func (pg *PostgresWorkoutStore) GetHeartRateSamples(workoutID int64) ([]HeartRateSample, error) {
+	query := `
+		SELECT array_to_json(offsets), array_to_json(bpm)
+		FROM workout_heart_rates
+		WHERE workout_id = $1;
+	`
+
+	var offsetsRaw, bpmRaw []byte
+	err := pg.db.QueryRow(query, workoutID).Scan(&offsetsRaw, &bpmRaw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var offsets, bpm []int
+	err = json.Unmarshal(offsetsRaw, &offsets)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(bpmRaw, &bpm)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]HeartRateSample, len(offsets))
+	for i := range offsets {
+		samples[i] = HeartRateSample{OffsetSeconds: offsets[i], BPM: bpm[i]}
+	}
+
+	return samples, nil
+}
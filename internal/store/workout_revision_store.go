@@ -0,0 +1,227 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// what caused a revision to be written
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionRevert  = "revert"
+)
+
+// WorkoutRevision is the workout as it was straight after a change
+type WorkoutRevision struct {
+	Revision  int       `json:"revision"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"created_at"`
+	Workout   *Workout  `json:"workout,omitempty"` // the snapshot, left off when listing revisions
+}
+
+// recordRevision snapshots the workout as it stands inside tx, so it has to be called after the change it's recording.
+// Trashed workouts are read too, that's the point of recording a delete. Every caller already holds the workout's row
+// lock so the next revision number can't be taken twice. Every change comes through here so it's also where the
+// workout's version gets bumped and its personal records are saved again, returns the version it's now at and the
+// records the change set
+func recordRevision(tx *sql.Tx, workoutID int64, action string) (int, []*PersonalRecord, error) {
+	if action != RevisionCreate {
+		_, err := tx.Exec(`UPDATE workouts SET version = version + 1 WHERE id = $1;`, workoutID)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	workout, err := scanWorkout(tx.QueryRow(workoutSelect+`
+		WHERE w.id = $1
+		GROUP BY w.id;
+	`, workoutID))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	newRecords, err := savePersonalRecords(tx, workout)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	snapshot, err := json.Marshal(workout)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	query := `
+		INSERT INTO workout_revisions (workout_id, revision, action, snapshot)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3
+		FROM workout_revisions
+		WHERE workout_id = $1;
+	`
+
+	_, err = tx.Exec(query, workoutID, action, snapshot)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return workout.Version, newRecords, nil
+}
+
+// ListWorkoutRevisions is newest first without the snapshots
+func (pg *PostgresWorkoutStore) ListWorkoutRevisions(workoutID int64) ([]*WorkoutRevision, error) {
+	query := `
+		SELECT revision, action, created_at
+		FROM workout_revisions
+		WHERE workout_id = $1
+		ORDER BY revision DESC;
+	`
+
+	rows, err := pg.db.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*WorkoutRevision{}
+	for rows.Next() {
+		revision := &WorkoutRevision{}
+		err = rows.Scan(&revision.Revision, &revision.Action, &revision.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+// GetWorkoutRevision returns ErrRevisionNotFound when the workout has no such revision, 0 means the latest one
+func (pg *PostgresWorkoutStore) GetWorkoutRevision(workoutID int64, revision int) (*WorkoutRevision, error) {
+	return getWorkoutRevision(pg.db, workoutID, revision)
+}
+
+func getWorkoutRevision(q queryer, workoutID int64, revision int) (*WorkoutRevision, error) {
+	query := `
+		SELECT revision, action, created_at, snapshot
+		FROM workout_revisions
+		WHERE workout_id = $1
+		AND ($2 = 0 OR revision = $2)
+		ORDER BY revision DESC
+		LIMIT 1;
+	`
+
+	workoutRevision := &WorkoutRevision{}
+	var snapshot []byte
+
+	err := q.QueryRow(query, workoutID, revision).Scan(&workoutRevision.Revision, &workoutRevision.Action, &workoutRevision.CreatedAt, &snapshot)
+	if err == sql.ErrNoRows {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(snapshot, &workoutRevision.Workout)
+	if err != nil {
+		return nil, err
+	}
+
+	return workoutRevision, nil
+}
+
+// RevertWorkout puts the workout back the way it was at revision, which is recorded as a new revision rather than
+// rewriting history. Entries that still exist keep their IDs (and the records that point at them), ones that have
+// been removed since come back as new rows
+func (pg *PostgresWorkoutStore) RevertWorkout(workoutID int64, revision int) (*Workout, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = lockWorkout(tx, workoutID)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := getWorkoutById(tx, workoutID)
+	if err != nil {
+		return nil, err
+	}
+
+	workoutRevision, err := getWorkoutRevision(tx, workoutID, revision)
+	if err != nil {
+		return nil, err
+	}
+	restored := workoutRevision.Workout
+
+	currentEntries := map[int]bool{}
+	for _, entry := range current.Entries {
+		currentEntries[entry.ID] = true
+	}
+
+	exerciseIDs := []int64{}
+	for i := range restored.Entries {
+		if !currentEntries[restored.Entries[i].ID] {
+			restored.Entries[i].ID = 0
+		}
+		if restored.Entries[i].ExerciseID != nil {
+			exerciseIDs = append(exerciseIDs, int64(*restored.Entries[i].ExerciseID))
+		}
+	}
+
+	// a custom exercise deleted since the snapshot would fail the foreign key, the entry keeps its name either way
+	rows, err := tx.Query(`SELECT id FROM exercises WHERE id = ANY($1);`, exerciseIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exercises := map[int]bool{}
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		exercises[id] = true
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range restored.Entries {
+		if restored.Entries[i].ExerciseID != nil && !exercises[*restored.Entries[i].ExerciseID] {
+			restored.Entries[i].ExerciseID = nil
+		}
+	}
+
+	err = updateWorkoutTx(tx, restored, workoutID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, newRecords, err := recordRevision(tx, workoutID, RevisionRevert)
+	if err != nil {
+		return nil, err
+	}
+
+	workout, err := getWorkoutById(tx, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	workout.NewRecords = newRecords
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var ErrEmptySearch = errors.New("search query is empty")
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+type EntrySearchMatch struct {
+	EntryID      int    `json:"entry_id"`
+	ExerciseName string `json:"exercise_name"` // highlighted, safe HTML
+	Notes        string `json:"notes"`         // highlighted, safe HTML
+}
+
+type WorkoutSearchResult struct {
+	WorkoutID    int                `json:"workout_id"`
+	Title        string             `json:"title"`       // highlighted, safe HTML
+	Description  string             `json:"description"` // highlighted, safe HTML
+	Rank         float64            `json:"rank"`
+	EntryMatches []EntrySearchMatch `json:"entry_matches"`
+}
+
+// ts_headline options, <mark> so the client can style it without having to parse anything
+// titles are short so they're highlighted whole rather than cut into fragments
+const (
+	searchHeadlineOptions      = `StartSel=<mark>, StopSel=</mark>, HighlightAll=false, MaxFragments=2`
+	searchTitleHeadlineOptions = `StartSel=<mark>, StopSel=</mark>, HighlightAll=true`
+)
+
+// escapeHTMLColumn wraps a column so ts_headline works on escaped text, that leaves the <mark> tags as the only
+// markup in what comes back so the client can render it as HTML
+func escapeHTMLColumn(column string) string {
+	return `replace(replace(replace(replace(replace(` + column + `, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`
+}
+
+// buildPrefixTSQuery turns free text like "bench pr" into "bench:* & pr:*" so partially typed words still match
+// anything that isn't a letter or number is dropped, which also stops users sending raw tsquery syntax
+func buildPrefixTSQuery(input string) string {
+	words := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, word+":*")
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+func (pg *PostgresWorkoutStore) SearchWorkouts(userID int, search string, limit int) ([]*WorkoutSearchResult, error) {
+	tsQuery := buildPrefixTSQuery(search)
+	if tsQuery == "" {
+		return nil, ErrEmptySearch
+	}
+
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	// a workout can match on itself and/or any number of its entries, the ranks are summed so a workout
+	// that mentions the term everywhere comes out above one that only mentions it once
+	query := `
+		WITH q AS (
+			SELECT to_tsquery('english', $2) AS query
+		),
+		matches AS (
+			SELECT w.id, ts_rank(w.search_vector, q.query) AS rank
+			FROM workouts w, q
+			WHERE w.user_id = $1
+			AND w.deleted_at IS NULL
+			AND w.search_vector @@ q.query
+
+			UNION ALL
+
+			SELECT e.workout_id, ts_rank(e.search_vector, q.query) AS rank
+			FROM workout_entries e
+			JOIN workouts w on w.id = e.workout_id, q
+			WHERE w.user_id = $1
+			AND w.deleted_at IS NULL
+			AND e.search_vector @@ q.query
+		),
+		ranked AS (
+			SELECT id, SUM(rank) AS rank
+			FROM matches
+			GROUP BY id
+			ORDER BY rank DESC, id DESC
+			LIMIT $3
+		)
+		SELECT
+			w.id,
+			ts_headline('english', ` + escapeHTMLColumn("w.title") + `, q.query, $5),
+			ts_headline('english', ` + escapeHTMLColumn("COALESCE(w.description, '')") + `, q.query, $4),
+			r.rank,
+			COALESCE((
+				SELECT json_agg(
+					json_build_object(
+						'entry_id', e.id,
+						'exercise_name', ts_headline('english', ` + escapeHTMLColumn("e.exercise_name") + `, q.query, $4),
+						'notes', ts_headline('english', ` + escapeHTMLColumn("COALESCE(e.notes, '')") + `, q.query, $4)
+					) order by e.order_index
+				)
+				FROM workout_entries e
+				WHERE e.workout_id = w.id
+				AND e.search_vector @@ q.query
+			), '[]')
+		FROM ranked r
+		JOIN workouts w on w.id = r.id, q
+		ORDER BY r.rank DESC, w.id DESC;
+	`
+
+	rows, err := pg.db.Query(query, userID, tsQuery, limit, searchHeadlineOptions, searchTitleHeadlineOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*WorkoutSearchResult{}
+	for rows.Next() {
+		result := &WorkoutSearchResult{}
+		var entriesRaw []byte
+
+		err = rows.Scan(
+			&result.WorkoutID,
+			&result.Title,
+			&result.Description,
+			&result.Rank,
+			&entriesRaw,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(entriesRaw, &result.EntryMatches)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"database/sql"
+)
+
+// WorkoutSet is one set of an entry, for when the sets weren't all the same (pyramids, drop sets, warm-ups)
+type WorkoutSet struct {
+	ID              int      `json:"id"`
+	SetNumber       int      `json:"set_number"` // 1 based, filled in from the position in the list when left at 0
+	Reps            *int     `json:"reps"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	Weight          *float64 `json:"weight"` // kg like the entry's weight
+	RPE             *float64 `json:"rpe"`    // 1-10, halves allowed
+	RIR             *int     `json:"rir"`    // reps in reserve
+	RestSeconds     *int     `json:"rest_seconds"`
+	IsWarmup        bool     `json:"is_warmup"`
+	IsDropSet       bool     `json:"is_drop_set"`
+	IsFailure       bool     `json:"is_failure"`
+}
+
+// workoutSetJSON builds a single set (aliased as ws) in the same shape as WorkoutSet, nested inside workoutEntryJSON
+const workoutSetJSON = `
+	json_build_object(
+		'id', ws.id,
+		'set_number', ws.set_number,
+		'reps', ws.reps,
+		'duration_seconds', ws.duration_seconds,
+		'weight', ws.weight,
+		'rpe', ws.rpe,
+		'rir', ws.rir,
+		'rest_seconds', ws.rest_seconds,
+		'is_warmup', ws.is_warmup,
+		'is_drop_set', ws.is_drop_set,
+		'is_failure', ws.is_failure
+	)`
+
+// WorkingSets is the entry's sets minus warm-ups, or all of them if every set was a warm-up
+func (e *WorkoutEntry) WorkingSets() []WorkoutSet {
+	working := []WorkoutSet{}
+	for _, set := range e.Sets {
+		if !set.IsWarmup {
+			working = append(working, set)
+		}
+	}
+
+	if len(working) == 0 {
+		return e.Sets
+	}
+	return working
+}
+
+// summariseSets fills in the entry's set_count, reps, duration and weight from its sets so everything that only
+// looks at the entry (filters, templates, older clients) still sees something sensible. The top set is the heaviest
+// working set, the one with the most reps (or longest) when they're all the same weight
+func (e *WorkoutEntry) summariseSets() {
+	if len(e.Sets) == 0 {
+		return
+	}
+
+	for i := range e.Sets {
+		if e.Sets[i].SetNumber == 0 {
+			e.Sets[i].SetNumber = i + 1
+		}
+	}
+
+	working := e.WorkingSets()
+	top := working[0]
+	for _, set := range working[1:] {
+		if setWeight(set) > setWeight(top) || (setWeight(set) == setWeight(top) && setAmount(set) > setAmount(top)) {
+			top = set
+		}
+	}
+
+	// copies rather than the set's own pointers, so converting the entry's weight can't convert the set's twice
+	e.SetCount = len(e.Sets)
+	e.Reps = nil
+	e.DurationSeconds = nil
+	e.Weight = nil
+
+	if top.Reps != nil {
+		reps := *top.Reps
+		e.Reps = &reps
+	}
+	if top.DurationSeconds != nil {
+		duration := *top.DurationSeconds
+		e.DurationSeconds = &duration
+	}
+	if top.Weight != nil {
+		weight := *top.Weight
+		e.Weight = &weight
+	}
+}
+
+func setWeight(set WorkoutSet) float64 {
+	if set.Weight == nil {
+		return 0
+	}
+	return *set.Weight
+}
+
+func setAmount(set WorkoutSet) int {
+	if set.Reps != nil {
+		return *set.Reps
+	}
+	if set.DurationSeconds != nil {
+		return *set.DurationSeconds
+	}
+	return 0
+}
+
+// syncWorkoutSets makes the entry's sets match sets, matched up by set_number so a set keeps its ID for as long as it
+// keeps its number and a revision only shows the sets that actually changed
+func syncWorkoutSets(tx *sql.Tx, entryID int, sets []WorkoutSet) error {
+	keepNumbers := []int64{}
+	for _, set := range sets {
+		keepNumbers = append(keepNumbers, int64(set.SetNumber))
+	}
+
+	_, err := tx.Exec(`DELETE FROM workout_sets WHERE entry_id = $1 AND NOT (set_number = ANY($2));`, entryID, keepNumbers)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO workout_sets
+			(
+			entry_id,
+			set_number,
+			reps,
+			duration_seconds,
+			weight,
+			rpe,
+			rir,
+			rest_seconds,
+			is_warmup,
+			is_drop_set,
+			is_failure
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (entry_id, set_number) DO UPDATE SET
+			reps = EXCLUDED.reps,
+			duration_seconds = EXCLUDED.duration_seconds,
+			weight = EXCLUDED.weight,
+			rpe = EXCLUDED.rpe,
+			rir = EXCLUDED.rir,
+			rest_seconds = EXCLUDED.rest_seconds,
+			is_warmup = EXCLUDED.is_warmup,
+			is_drop_set = EXCLUDED.is_drop_set,
+			is_failure = EXCLUDED.is_failure
+		RETURNING id;
+	`
+
+	for i := range sets {
+		set := &sets[i]
+		err = tx.QueryRow(
+			query,
+			entryID,
+			set.SetNumber,
+			set.Reps,
+			set.DurationSeconds,
+			set.Weight,
+			set.RPE,
+			set.RIR,
+			set.RestSeconds,
+			set.IsWarmup,
+			set.IsDropSet,
+			set.IsFailure,
+		).Scan(&set.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
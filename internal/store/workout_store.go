@@ -3,15 +3,42 @@ package store
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type WorkoutStore interface {
 	CreateWorkout(*Workout) (*Workout, error)
+	CreateWorkouts(workouts []*Workout) error
 	GetWorkoutById(int64) (*Workout, error)
-	UpdateWorkout(workout *Workout, id int64) error
-	DeleteWorkout(int64) error
+	UpdateWorkout(workout *Workout, id int64, versions []int) error
+	PatchWorkout(id int64, versions []int, apply func(*Workout) error) (*Workout, error)
+	ListWorkoutEntries(workoutID int64) ([]WorkoutEntry, error)
+	GetWorkoutEntry(workoutID int64, entryID int64) (*WorkoutEntry, error)
+	CreateWorkoutEntry(workoutID int64, entry *WorkoutEntry) ([]*PersonalRecord, error)
+	PatchWorkoutEntry(workoutID int64, entryID int64, apply func(*WorkoutEntry) error) (*WorkoutEntry, []*PersonalRecord, error)
+	DeleteWorkoutEntry(workoutID int64, entryID int64) error
+	ReorderWorkoutEntries(workoutID int64, entryIDs []int64) ([]WorkoutEntry, error)
+	DeleteWorkout(id int64, versions []int) error
+	ListTrashedWorkouts(userID int) ([]*Workout, error)
+	RestoreWorkout(userID int, id int64) error
+	PurgeDeletedWorkouts(before time.Time) (int64, error)
+	ListWorkoutRevisions(workoutID int64) ([]*WorkoutRevision, error)
+	GetWorkoutRevision(workoutID int64, revision int) (*WorkoutRevision, error)
+	RevertWorkout(workoutID int64, revision int) (*Workout, error)
 	GetWorkoutOwner(id int64) (int, error)
+	ListWorkouts(filter WorkoutFilter) (*WorkoutPage, error)
+	SearchWorkouts(userID int, search string, limit int) ([]*WorkoutSearchResult, error)
+	ExportWorkouts(filter WorkoutFilter, row func(*ExportRow) error) error
+	ListWorkoutStartTimes(userID int, from time.Time, to time.Time) ([]time.Time, error)
+	CreateWorkoutWithTrack(workout *Workout, track *WorkoutTrack) (*Workout, error)
+	GetWorkoutTrack(workoutID int64) (*WorkoutTrack, error)
+	ReprocessWorkoutTrack(workoutID int64, apply func(*WorkoutTrack, *Workout) error) (*WorkoutTrack, *Workout, error)
+	ReplaceHeartRateSamples(workoutID int64, samples []HeartRateSample) error
+	GetHeartRateSamples(workoutID int64) ([]HeartRateSample, error)
 }
 
 type PostgresWorkoutStore struct {
@@ -20,13 +47,25 @@ type PostgresWorkoutStore struct {
 
 type WorkoutEntry struct {
 	ID              int      `json:"id"`
+	ExerciseID      *int     `json:"exercise_id"` // catalog exercise, nil when the name didn't match anything
 	ExerciseName    string   `json:"exercise_name"`
-	Sets            int      `json:"sets"`
+	SetCount        int      `json:"set_count"`
 	Reps            *int     `json:"reps"` // Pointer because we want to check if nil as this field is optional
 	DurationSeconds *int     `json:"duration_seconds"`
-	Weight          *float64 `json:"weight"`
+	Weight          *float64 `json:"weight"`      // always kg in the store, the api converts on the way in and out
+	WeightUnit      string   `json:"weight_unit"` // kg or lb, what the weight was entered in
 	Notes           string   `json:"notes"`
 	OrderIndex      int      `json:"order_index"`
+	Sets            []WorkoutSet `json:"sets"` // optional, when there are any set_count, reps, duration and weight are worked out from them
+	GroupIndex      *int     `json:"group_index"` // position in the workout's groups, nil when the entry is on its own
+	Distance            *float64 `json:"distance"`      // per set, always metres in the store, the api converts on the way in and out
+	DistanceUnit        string   `json:"distance_unit"` // m, km or mi, what the distance was entered in
+	PaceSecondsPerKm    *float64 `json:"pace_seconds_per_km"` // worked out from distance and duration_seconds when there's both
+	AvgHeartRate        *int     `json:"avg_heart_rate"`
+	MaxHeartRate        *int     `json:"max_heart_rate"`
+	Cadence             *int     `json:"cadence"` // steps or strokes a minute, rpm on a bike
+	Power               *int     `json:"power"`   // average watts
+	ElevationGainMeters *float64 `json:"elevation_gain_meters"`
 }
 
 type Workout struct {
@@ -36,70 +75,204 @@ type Workout struct {
 	Description     string         `json:"description"`
 	DurationMinutes int            `json:"duration_minutes"`
 	CaloriesBurned  int            `json:"calories_burned"`
+	CaloriesSource  string         `json:"calories_source"` // measured when the client sent calories_burned, estimated when we worked it out
+	SessionRPE      *int           `json:"session_rpe"` // 1-10 for the whole session, feeds training load
+	StartedAt       time.Time      `json:"started_at"` // when the session happened, defaults to now but can be backdated
+	EndedAt         *time.Time     `json:"ended_at"`   // duration_minutes is worked out from started_at and ended_at when both are set
+	TimeZone        string         `json:"time_zone"`  // IANA zone the session was done in, the user's time zone unless it's sent
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       *time.Time     `json:"deleted_at,omitempty"` // only ever set on workouts read from the trash
+	Version         int            `json:"version"` // goes up by one with every change, sent back as the ETag
 	Entries         []WorkoutEntry `json:"entries"`
+	Groups          []EntryGroup   `json:"groups"`
+	NewRecords      []*PersonalRecord `json:"-"` // the records the write that returned the workout set, see savePersonalRecords
 }
 
-type UpdateWorkout struct {
-	ID              *int            `json:"id"`
-	Title           *string         `json:"title"`
-	Description     *string         `json:"description"`
-	DurationMinutes *int            `json:"duration_minutes"`
-	CaloriesBurned  *int            `json:"calories_burned"`
-	Entries         []WorkoutEntry  `json:"entries"`
+// workoutEntryJSON builds a single entry (aliased as e) in the same shape as WorkoutEntry so the json_agg result can be unmarshalled straight into Entries
+const workoutEntryJSON = `
+	json_build_object(
+		'id', e.id,
+		'exercise_id', e.exercise_id,
+		'exercise_name', e.exercise_name,
+		'set_count', e.sets,
+		'reps', e.reps,
+		'duration_seconds', e.duration_seconds,
+		'weight', e.weight,
+		'weight_unit', e.weight_unit,
+		'notes', e.notes,
+		'order_index', e.order_index,
+		'group_index', (SELECT g.position FROM workout_entry_groups g WHERE g.id = e.group_id),
+		'distance', e.distance_meters,
+		'distance_unit', e.distance_unit,
+		'pace_seconds_per_km', e.pace_seconds_per_km,
+		'avg_heart_rate', e.avg_heart_rate,
+		'max_heart_rate', e.max_heart_rate,
+		'cadence', e.cadence,
+		'power', e.power,
+		'elevation_gain_meters', e.elevation_gain_meters,
+		'sets', COALESCE(
+			(SELECT json_agg(` + workoutSetJSON + ` order by ws.set_number) FROM workout_sets ws WHERE ws.entry_id = e.id),
+			'[]'
+		)
+	)`
+
+type WorkoutFilter struct {
+	UserID       int
+	From         *time.Time
+	To           *time.Time
+	Title        string // substring match
+	ExerciseName string // matches workouts with at least one entry of this exercise
+	MinDuration  *int
+	MaxDuration  *int
+	MinCalories  *int
+	MaxCalories  *int
+	Sort         string // one of workoutSortColumns, prefix with - for descending
+	Cursor       string
+	Limit        int
+}
+
+type WorkoutPage struct {
+	Workouts   []*Workout `json:"workouts"`
+	NextCursor string     `json:"next_cursor,omitempty"` // empty when there are no more pages
+}
+
+const (
+	DefaultWorkoutSort      = "-started_at"
+	DefaultWorkoutPageLimit = 20
+	MaxWorkoutPageLimit     = 100
+)
+
+// where calories_burned came from
+const (
+	CaloriesMeasured  = "measured"
+	CaloriesEstimated = "estimated"
+)
+
+var (
+	ErrInvalidSort     = errors.New("invalid sort")
+	ErrEntryNotFound   = errors.New("entry does not belong to workout")
+	ErrVersionMismatch = errors.New("workout has been changed since it was read")
+)
+
+var workoutSortColumns = map[string]string{
+	"started_at":       "w.started_at",
+	"created_at":       "w.created_at",
+	"duration_minutes": "w.duration_minutes",
+	"calories_burned":  "COALESCE(w.calories_burned, 0)",
+	"title":            "w.title",
+}
+
+// queryArgs keeps track of positional args for queries where the WHERE clause is built up at runtime
+type queryArgs []interface{}
+
+func (a *queryArgs) add(v interface{}) string {
+	*a = append(*a, v)
+	return "$" + strconv.Itoa(len(*a))
 }
 
 func NewPostgresWorkoutStore(db *sql.DB) *PostgresWorkoutStore {
 	return &PostgresWorkoutStore{db: db}
 }
 
+// queryer is the bits of *sql.DB and *sql.Tx we use, so the same helpers work inside and outside a transaction
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
 
 func (pg *PostgresWorkoutStore) GetWorkoutById(id int64) (*Workout, error) {
+	return getWorkoutById(pg.db, id)
+}
+
+// workoutSelect is shared by every read of a whole workout so the columns and scanWorkout can't drift apart,
+// LEFT JOIN + FILTER so a workout whose entries have all been removed can still be read.
+// Every query built on it needs its own deleted_at condition, only the trash reads deleted workouts
+const workoutSelect = `
+	SELECT
+		w.id,
+		w.user_id,
+		w.title,
+		COALESCE(w.description, ''),
+		w.duration_minutes,
+		COALESCE(w.calories_burned, 0),
+		w.calories_source,
+		w.session_rpe,
+		w.started_at,
+		w.ended_at,
+		w.time_zone,
+		w.created_at,
+		COALESCE(w.updated, w.created_at),
+		w.deleted_at,
+		w.version,
+		COALESCE(
+			json_agg(` + workoutEntryJSON + ` order by e.order_index) FILTER (WHERE e.id IS NOT NULL),
+			'[]'
+		) as entries,
+		COALESCE(
+			(SELECT json_agg(` + entryGroupJSON + ` order by g.position) FROM workout_entry_groups g WHERE g.workout_id = w.id),
+			'[]'
+		) as groups
+	FROM workouts w
+	LEFT JOIN workout_entries e on e.workout_id = w.id
+`
+
+func scanWorkout(scanner interface {
+	Scan(dest ...interface{}) error
+}) (*Workout, error) {
 	workout := &Workout{}
 	var entriesRaw []byte
+	var groupsRaw []byte
 
-	query := `
-		SELECT 
-			w.id,
-			w.title,
-			w.description,
-			w.duration_minutes,
-			w.calories_burned, 
-			json_agg(
-				json_build_object(
-				'id', e.id,
-				'exercise_name', e.exercise_name,
-				'sets', e.sets,
-				'reps', e.reps,
-				'duration_seconds', e.duration_seconds,
-				'weight', e.weight,
-				'notes', e.notes,
-				'order_index', e.order_index
-				) order by e.order_index
-			) as entries 
-		FROM workouts w
-		JOIN workout_entries e on e.workout_id = w.id
-		WHERE w.id = $1
-		GROUP BY w.id;
-	`
-
-	err := pg.db.QueryRow(query, id).Scan( // pg.db.QueryRow expects at least 1 row returned
+	err := scanner.Scan(
 		&workout.ID,
+		&workout.UserID,
 		&workout.Title,
 		&workout.Description,
 		&workout.DurationMinutes,
 		&workout.CaloriesBurned,
+		&workout.CaloriesSource,
+		&workout.SessionRPE,
+		&workout.StartedAt,
+		&workout.EndedAt,
+		&workout.TimeZone,
+		&workout.CreatedAt,
+		&workout.UpdatedAt,
+		&workout.DeletedAt,
+		&workout.Version,
 		&entriesRaw,
+		&groupsRaw,
 	)
+	if err != nil {
+		return nil, err
+	}
 
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("no data for workout")
+	err = json.Unmarshal(entriesRaw, &workout.Entries)
+	if err != nil {
+		return nil, err
 	}
 
+	err = json.Unmarshal(groupsRaw, &workout.Groups)
 	if err != nil {
 		return nil, err
 	}
 
-	err = json.Unmarshal(entriesRaw, &workout.Entries)
+	return workout, nil
+}
+
+func getWorkoutById(q queryer, id int64) (*Workout, error) {
+	query := workoutSelect + `
+		WHERE w.id = $1
+		AND w.deleted_at IS NULL
+		GROUP BY w.id;
+	`
+
+	workout, err := scanWorkout(q.QueryRow(query, id)) // QueryRow expects at least 1 row returned
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no data for workout: %w", err)
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -115,6 +288,21 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 	}
 	defer tx.Rollback()
 
+	err = createWorkoutTx(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
+
+// createWorkoutTx is CreateWorkout inside a transaction the caller owns, for anything that has to go in alongside the workout
+func createWorkoutTx(tx *sql.Tx, workout *Workout) error {
 	query := `
 		INSERT INTO workouts 
 			(
@@ -122,136 +310,344 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 			title,
 			description, 
 			duration_minutes, 
-			calories_burned
+			calories_burned,
+			calories_source,
+			session_rpe,
+			started_at,
+			ended_at,
+			time_zone
 			)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id;
+		VALUES ($1, $2, $3, $4, $5, COALESCE(NULLIF($6, ''), 'measured'), $7, COALESCE($8, CURRENT_TIMESTAMP), $9, COALESCE(NULLIF($10, ''), 'UTC'))
+		RETURNING id, created_at, updated, calories_source, started_at, time_zone, version;
 	`
 
-	err = tx.QueryRow(
+	err := tx.QueryRow(
 		query, 
 		workout.UserID,
 		workout.Title, 
 		workout.Description, 
 		workout.DurationMinutes, 
 		workout.CaloriesBurned,
-	).Scan(&workout.ID)
+		workout.CaloriesSource,
+		workout.SessionRPE,
+		timeOrNil(workout.StartedAt),
+		workout.EndedAt,
+		workout.TimeZone,
+	).Scan(&workout.ID, &workout.CreatedAt, &workout.UpdatedAt, &workout.CaloriesSource, &workout.StartedAt, &workout.TimeZone, &workout.Version)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	for _, entry := range workout.Entries {
-		query := `
-			INSERT INTO workout_entries 
-				(
-				workout_id, 
-				exercise_name, 
-				sets, 
-				reps, 
-				duration_seconds, 
-				weight, 
-				notes, 
-				order_index
-			)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-			RETURNING id;
-		`
-		err = tx.QueryRow(
-			query, 
-			workout.ID, 
-			entry.ExerciseName, 
-			entry.Sets, 
-			entry.Reps, 
-			entry.DurationSeconds, 
-			entry.Weight, 
-			entry.Notes, 
-			entry.OrderIndex,
-		).Scan(&entry.ID)
+	err = syncEntryGroups(tx, int64(workout.ID), workout.Groups)
+	if err != nil {
+		return err
+	}
+
+	for i := range workout.Entries {
+		err = insertWorkoutEntry(tx, int64(workout.ID), &workout.Entries[i]) // index rather than range value so the new ID ends up on the returned workout
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	err = tx.Commit()
+	_, workout.NewRecords, err = recordRevision(tx, int64(workout.ID), RevisionCreate)
+	return err
+}
+
+// UpdateWorkout is a full replacement, entries missing from workout.Entries are deleted,
+// entries with an ID of 0 are inserted and the rest are updated in place.
+// ErrVersionMismatch unless the workout is at one of versions, nil skips the check
+func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout, id int64, versions []int) error {
+	tx, err := pg.db.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer tx.Rollback()
 
-	return workout, nil
+	err = lockWorkoutVersion(tx, id, versions)
+	if err != nil {
+		return err
+	}
+
+	err = updateWorkoutTx(tx, workout, id)
+	if err != nil {
+		return err
+	}
+
+	workout.Version, workout.NewRecords, err = recordRevision(tx, id, RevisionUpdate)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout, id int64) error {
+// PatchWorkout locks the workout, loads it and hands it to apply to modify before writing it back,
+// all in one transaction so nothing can sneak in between the read and the write. versions works as it does for UpdateWorkout
+func (pg *PostgresWorkoutStore) PatchWorkout(id int64, versions []int, apply func(*Workout) error) (*Workout, error) {
 	tx, err := pg.db.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback()
 
+	err = lockWorkoutVersion(tx, id, versions) // FOR UPDATE isn't allowed alongside the GROUP BY in getWorkoutById so lock separately
+	if err != nil {
+		return nil, err
+	}
+
+	workout, err := getWorkoutById(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = apply(workout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = updateWorkoutTx(tx, workout, id)
+	if err != nil {
+		return nil, err
+	}
+
+	workout.Version, workout.NewRecords, err = recordRevision(tx, id, RevisionUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
+
+func updateWorkoutTx(tx *sql.Tx, workout *Workout, id int64) error {
 	query := `
 		UPDATE workouts
 		SET 
 			title = $1,
 			description = $2,
 			duration_minutes = $3,
-			calories_burned = $4
-		WHERE id = $5;
+			calories_burned = $4,
+			calories_source = COALESCE(NULLIF($5, ''), 'measured'),
+			session_rpe = $6,
+			started_at = COALESCE($7, started_at),
+			ended_at = $8,
+			time_zone = COALESCE(NULLIF($9, ''), time_zone),
+			updated = CURRENT_TIMESTAMP
+		WHERE id = $10
+		AND deleted_at IS NULL
+		RETURNING created_at, updated, calories_source, started_at, time_zone;
+	`
+
+	err := tx.QueryRow(
+		query,
+		workout.Title,
+		workout.Description,
+		workout.DurationMinutes,
+		workout.CaloriesBurned,
+		workout.CaloriesSource,
+		workout.SessionRPE,
+		timeOrNil(workout.StartedAt),
+		workout.EndedAt,
+		workout.TimeZone,
+		id,
+	).Scan(&workout.CreatedAt, &workout.UpdatedAt, &workout.CaloriesSource, &workout.StartedAt, &workout.TimeZone)
+	if err != nil {
+		return err // sql.ErrNoRows if the workout has gone
+	}
+
+	err = syncEntryGroups(tx, id, workout.Groups)
+	if err != nil {
+		return err
+	}
+
+	return syncWorkoutEntries(tx, id, workout.Entries)
+}
+
+// syncWorkoutEntries makes the rows in workout_entries match entries exactly
+func syncWorkoutEntries(tx *sql.Tx, workoutID int64, entries []WorkoutEntry) error {
+	keepIDs := []int64{}
+	for _, entry := range entries {
+		if entry.ID != 0 {
+			keepIDs = append(keepIDs, int64(entry.ID))
+		}
+	}
+
+	_, err := tx.Exec(`DELETE FROM workout_entries WHERE workout_id = $1 AND NOT (id = ANY($2));`, workoutID, keepIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+
+		if entry.ID == 0 {
+			err = insertWorkoutEntry(tx, workoutID, entry)
+		} else {
+			err = updateWorkoutEntry(tx, workoutID, entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func updateWorkoutEntry(tx *sql.Tx, workoutID int64, entry *WorkoutEntry) error {
+	query := `
+		UPDATE workout_entries
+		SET
+			exercise_name = $1,
+			sets = $2,
+			reps = $3,
+			duration_seconds = $4,
+			weight = $5,
+			notes = $6,
+			order_index = $7,
+			exercise_id = $8,
+			weight_unit = COALESCE(NULLIF($9, ''), 'kg'),
+			group_id = (SELECT g.id FROM workout_entry_groups g WHERE g.workout_id = $11 AND g.position = $12),
+			distance_meters = $13,
+			distance_unit = COALESCE(NULLIF($14, ''), 'km'),
+			pace_seconds_per_km = $15,
+			avg_heart_rate = $16,
+			max_heart_rate = $17,
+			cadence = $18,
+			power = $19,
+			elevation_gain_meters = $20,
+			updated = CURRENT_TIMESTAMP
+		WHERE id = $10
+		AND workout_id = $11;
 	`
 
-	_, err = tx.Exec(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, id)
+	entry.summariseSets()
+	entry.summariseCardio()
+
+	result, err := tx.Exec(
+		query,
+		entry.ExerciseName,
+		entry.SetCount,
+		entry.Reps,
+		entry.DurationSeconds,
+		entry.Weight,
+		entry.Notes,
+		entry.OrderIndex,
+		entry.ExerciseID,
+		entry.WeightUnit,
+		entry.ID,
+		workoutID,
+		entry.GroupIndex,
+		entry.Distance,
+		entry.DistanceUnit,
+		entry.PaceSecondsPerKm,
+		entry.AvgHeartRate,
+		entry.MaxHeartRate,
+		entry.Cadence,
+		entry.Power,
+		entry.ElevationGainMeters,
+	)
 	if err != nil {
 		return err
 	}
 
-	entriesSql := `
-		INSERT INTO workout_entries (
-			exercise_name,
-			sets,
-			reps,
-			duration_seconds,
-			weight,
-			notes,
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: %d", ErrEntryNotFound, entry.ID) // ID was made up or belongs to another workout
+	}
+
+	return syncWorkoutSets(tx, entry.ID, entry.Sets)
+}
+
+func insertWorkoutEntry(tx *sql.Tx, workoutID int64, entry *WorkoutEntry) error {
+	query := `
+		INSERT INTO workout_entries 
+			(
+			workout_id, 
+			exercise_name, 
+			sets, 
+			reps, 
+			duration_seconds, 
+			weight, 
+			notes, 
 			order_index,
-			id,
-			workout_id
+			exercise_id,
+			weight_unit,
+			group_id,
+			distance_meters,
+			distance_unit,
+			pace_seconds_per_km,
+			avg_heart_rate,
+			max_heart_rate,
+			cadence,
+			power,
+			elevation_gain_meters
 		)
 		VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, COALESCE(NULLIF($10, ''), 'kg'),
+			(SELECT g.id FROM workout_entry_groups g WHERE g.workout_id = $1 AND g.position = $11),
+			$12, COALESCE(NULLIF($13, ''), 'km'), $14, $15, $16, $17, $18, $19
 		)
-		ON CONFLICT (id) DO UPDATE SET
-			exercise_name = excluded.exercise_name,
-			sets = excluded.sets,
-			reps = excluded.reps,
-			duration_seconds = excluded.duration_seconds,
-			weight = excluded.weight,
-			notes = excluded.notes,
-			order_index = excluded.order_index
+		RETURNING id;
 	`
 
-	for _, entries := range workout.Entries {
-		_, err := tx.Exec(
-			entriesSql,
-			entries.ExerciseName,
-			entries.Sets,
-			entries.Reps,
-			entries.DurationSeconds,
-			entries.Weight,
-			entries.Notes,
-			entries.OrderIndex,
-			entries.ID,
-			id,
-		)
-		if err != nil {
-			return err
-		}
+	entry.summariseSets()
+	entry.summariseCardio()
+
+	err := tx.QueryRow(
+		query, 
+		workoutID, 
+		entry.ExerciseName, 
+		entry.SetCount, 
+		entry.Reps, 
+		entry.DurationSeconds, 
+		entry.Weight, 
+		entry.Notes, 
+		entry.OrderIndex,
+		entry.ExerciseID,
+		entry.WeightUnit,
+		entry.GroupIndex,
+		entry.Distance,
+		entry.DistanceUnit,
+		entry.PaceSecondsPerKm,
+		entry.AvgHeartRate,
+		entry.MaxHeartRate,
+		entry.Cadence,
+		entry.Power,
+		entry.ElevationGainMeters,
+	).Scan(&entry.ID)
+	if err != nil {
+		return err
 	}
 
-	return tx.Commit()
+	return syncWorkoutSets(tx, entry.ID, entry.Sets)
 }
 
-func (pg *PostgresWorkoutStore) DeleteWorkout(id int64) error {
-	query := `DELETE FROM workouts WHERE id = $1;`
+// DeleteWorkout moves the workout to the trash, it's only gone for good once PurgeDeletedWorkouts gets to it.
+// versions works as it does for UpdateWorkout
+func (pg *PostgresWorkoutStore) DeleteWorkout(id int64, versions []int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockWorkoutVersion(tx, id, versions)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE workouts SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL;`
 
-	result, err := pg.db.Exec(query, id)
+	result, err := tx.Exec(query, id)
 	if err != nil {
 		return err
 	}
@@ -265,13 +661,40 @@ func (pg *PostgresWorkoutStore) DeleteWorkout(id int64) error {
 		return sql.ErrNoRows
 	}
 
-	return nil
+	_, _, err = recordRevision(tx, id, RevisionDelete)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockWorkoutVersion is lockWorkout for writes made against a version the client read earlier,
+// nil versions skips the check but an empty slice never matches
+func lockWorkoutVersion(tx *sql.Tx, workoutID int64, versions []int) error {
+	var version int
+	err := tx.QueryRow(`SELECT version FROM workouts WHERE id = $1 AND deleted_at IS NULL FOR UPDATE;`, workoutID).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	if versions == nil {
+		return nil
+	}
+
+	for _, v := range versions {
+		if v == version {
+			return nil
+		}
+	}
+
+	return ErrVersionMismatch
 }
 
 func (pg *PostgresWorkoutStore) GetWorkoutOwner(workoutID int64) (int, error) {
 	var userID int
 
-	query := `SELECT user_id FROM workouts WHERE id = $1;`
+	query := `SELECT user_id FROM workouts WHERE id = $1 AND deleted_at IS NULL;`
 
 	err := pg.db.QueryRow(query, workoutID).Scan(&userID)
 	if err != nil {
@@ -280,3 +703,243 @@ func (pg *PostgresWorkoutStore) GetWorkoutOwner(workoutID int64) (int, error) {
 
 	return userID, nil
 }
+
+// ListTrashedWorkouts is the user's trash, most recently deleted first
+func (pg *PostgresWorkoutStore) ListTrashedWorkouts(userID int) ([]*Workout, error) {
+	query := workoutSelect + `
+		WHERE w.user_id = $1
+		AND w.deleted_at IS NOT NULL
+		GROUP BY w.id
+		ORDER BY w.deleted_at DESC, w.id DESC;
+	`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workouts := []*Workout{}
+	for rows.Next() {
+		workout, err := scanWorkout(rows)
+		if err != nil {
+			return nil, err
+		}
+		workouts = append(workouts, workout)
+	}
+
+	return workouts, rows.Err()
+}
+
+// RestoreWorkout takes a workout back out of the user's trash, sql.ErrNoRows if it isn't in there
+func (pg *PostgresWorkoutStore) RestoreWorkout(userID int, id int64) error {
+	query := `
+		UPDATE workouts
+		SET
+			deleted_at = NULL,
+			updated = CURRENT_TIMESTAMP
+		WHERE id = $1
+		AND user_id = $2
+		AND deleted_at IS NOT NULL;
+	`
+
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, _, err = recordRevision(tx, id, RevisionRestore)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeDeletedWorkouts permanently removes workouts trashed before the cutoff, entries, sets and records go with them
+func (pg *PostgresWorkoutStore) PurgeDeletedWorkouts(before time.Time) (int64, error) {
+	result, err := pg.db.Exec(`DELETE FROM workouts WHERE deleted_at < $1;`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (pg *PostgresWorkoutStore) ListWorkouts(filter WorkoutFilter) (*WorkoutPage, error) {
+	sort := filter.Sort
+	if sort == "" {
+		sort = DefaultWorkoutSort
+	}
+
+	descending := strings.HasPrefix(sort, "-")
+	sortKey := strings.TrimPrefix(sort, "-")
+	sortColumn, ok := workoutSortColumns[sortKey]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultWorkoutPageLimit
+	}
+	if limit > MaxWorkoutPageLimit {
+		limit = MaxWorkoutPageLimit
+	}
+
+	args := queryArgs{}
+	where := []string{"w.user_id = " + args.add(filter.UserID), "w.deleted_at IS NULL"}
+
+	if filter.From != nil {
+		where = append(where, "w.started_at >= "+args.add(*filter.From))
+	}
+	if filter.To != nil {
+		where = append(where, "w.started_at < "+args.add(*filter.To))
+	}
+	if filter.Title != "" {
+		where = append(where, "w.title ILIKE "+args.add("%"+escapeLike(filter.Title)+"%"))
+	}
+	if filter.ExerciseName != "" {
+		where = append(where, `EXISTS (
+			SELECT 1 FROM workout_entries fe
+			WHERE fe.workout_id = w.id
+			AND fe.exercise_name ILIKE `+args.add(escapeLike(filter.ExerciseName))+`
+		)`)
+	}
+	if filter.MinDuration != nil {
+		where = append(where, "w.duration_minutes >= "+args.add(*filter.MinDuration))
+	}
+	if filter.MaxDuration != nil {
+		where = append(where, "w.duration_minutes <= "+args.add(*filter.MaxDuration))
+	}
+	if filter.MinCalories != nil {
+		where = append(where, "COALESCE(w.calories_burned, 0) >= "+args.add(*filter.MinCalories))
+	}
+	if filter.MaxCalories != nil {
+		where = append(where, "COALESCE(w.calories_burned, 0) <= "+args.add(*filter.MaxCalories))
+	}
+
+	// keyset pagination, (sort value, id) of the last row on the previous page tells us where to carry on from
+	if filter.Cursor != "" {
+		cursor, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != sort {
+			return nil, ErrInvalidCursor
+		}
+
+		cursorValue, err := parseWorkoutSortValue(sortKey, cursor.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+
+		comparison := ">"
+		if descending {
+			comparison = "<"
+		}
+		where = append(where, fmt.Sprintf("(%s, w.id) %s (%s, %s)", sortColumn, comparison, args.add(cursorValue), args.add(cursor.ID)))
+	}
+
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+
+	query := workoutSelect + `
+		WHERE ` + strings.Join(where, " AND ") + `
+		GROUP BY w.id
+		ORDER BY ` + sortColumn + ` ` + direction + `, w.id ` + direction + `
+		LIMIT ` + args.add(limit+1) + `;
+	`
+
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &WorkoutPage{Workouts: []*Workout{}}
+
+	for rows.Next() {
+		workout, err := scanWorkout(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(page.Workouts) == limit {
+			// we asked for one extra row, if it's there then there's another page
+			last := page.Workouts[len(page.Workouts)-1]
+			page.NextCursor = encodeCursor(pageCursor{
+				Sort:  sort,
+				Value: workoutSortValue(sortKey, last),
+				ID:    last.ID,
+			})
+			break
+		}
+
+		page.Workouts = append(page.Workouts, workout)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func workoutSortValue(sortKey string, workout *Workout) string {
+	switch sortKey {
+	case "duration_minutes":
+		return strconv.Itoa(workout.DurationMinutes)
+	case "calories_burned":
+		return strconv.Itoa(workout.CaloriesBurned)
+	case "title":
+		return workout.Title
+	case "created_at":
+		return workout.CreatedAt.Format(time.RFC3339Nano)
+	default:
+		return workout.StartedAt.Format(time.RFC3339Nano)
+	}
+}
+
+func parseWorkoutSortValue(sortKey string, value string) (interface{}, error) {
+	switch sortKey {
+	case "duration_minutes", "calories_burned":
+		return strconv.Atoi(value)
+	case "title":
+		return value, nil
+	default:
+		return time.Parse(time.RFC3339Nano, value)
+	}
+}
+
+// timeOrNil lets a zero time through as NULL so the column's default or existing value is kept
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// escapeLike stops user input like 50% being treated as a wildcard
+func escapeLike(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(s)
+}
@@ -3,8 +3,10 @@ package store_test
 import (
 	"database/sql"
 	"testing"
+	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/lesi97/internal/records"
 	"github.com/lesi97/internal/store"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -50,7 +52,7 @@ func TestCreateWorkout(t *testing.T) {
 				Entries: []store.WorkoutEntry{
 					{
 						ExerciseName: "Bench Press",
-						Sets: 3,
+						SetCount: 3,
 						Reps: intPtr(10),
 						Weight: floatPtr(135.5),
 						Notes: "Warm up properly",
@@ -60,6 +62,60 @@ func TestCreateWorkout(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "pyramid sets",
+			workout: &store.Workout{
+				Title: "heavy bench",
+				Description: "working up to a single",
+				DurationMinutes: 45,
+				CaloriesBurned: 250,
+				Entries: []store.WorkoutEntry{
+					{
+						ExerciseName: "Bench Press",
+						OrderIndex: 1,
+						Sets: []store.WorkoutSet{
+							{Reps: intPtr(10), Weight: floatPtr(60), IsWarmup: true},
+							{Reps: intPtr(5), Weight: floatPtr(100)},
+							{Reps: intPtr(3), Weight: floatPtr(110)},
+							{Reps: intPtr(1), Weight: floatPtr(120), IsFailure: true},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "superset",
+			workout: &store.Workout{
+				Title: "arms",
+				Description: "curls and pushdowns back to back",
+				DurationMinutes: 30,
+				CaloriesBurned: 150,
+				Groups: []store.EntryGroup{
+					{Type: "superset", Rounds: 3, RestSeconds: intPtr(90)},
+				},
+				Entries: []store.WorkoutEntry{
+					{ExerciseName: "Barbell Curl", SetCount: 3, Reps: intPtr(10), Weight: floatPtr(30), OrderIndex: 1, GroupIndex: intPtr(0)},
+					{ExerciseName: "Tricep Pushdown", SetCount: 3, Reps: intPtr(12), Weight: floatPtr(25), OrderIndex: 2, GroupIndex: intPtr(0)},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "backdated",
+			workout: &store.Workout{
+				Title: "easy run",
+				Description: "logged the day after",
+				DurationMinutes: 30,
+				CaloriesBurned: 300,
+				StartedAt: time.Date(2024, 3, 9, 7, 0, 0, 0, time.UTC),
+				TimeZone: "Europe/London",
+				Entries: []store.WorkoutEntry{
+					{ExerciseName: "Running", SetCount: 1, DurationSeconds: intPtr(1800), OrderIndex: 1},
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "workout with invalid entries",
 			workout: &store.Workout{
@@ -70,14 +126,14 @@ func TestCreateWorkout(t *testing.T) {
 				Entries: []store.WorkoutEntry{
 					{
 						ExerciseName: "Plank",
-						Sets: 3,
+						SetCount: 3,
 						Reps: intPtr(60),
 						Notes: "keep form",
 						OrderIndex: 1,
 					},
 					{
 						ExerciseName: "Squats",
-						Sets: 4,
+						SetCount: 4,
 						Reps: intPtr(12),
 						DurationSeconds: intPtr(60), // In the db we specified can't have both duration and reps so this should fail
 						Weight: floatPtr(185.0),
@@ -112,20 +168,667 @@ func TestCreateWorkout(t *testing.T) {
 			assert.Equal(t, createdWorkout.Description, retrieved.Description)
 			assert.Equal(t, createdWorkout.DurationMinutes, retrieved.DurationMinutes)
 			assert.Equal(t, createdWorkout.CaloriesBurned, retrieved.CaloriesBurned)
+			assert.Equal(t, store.CaloriesMeasured, retrieved.CaloriesSource)
+			assert.True(t, createdWorkout.StartedAt.Equal(retrieved.StartedAt))
+			assert.Equal(t, createdWorkout.TimeZone, retrieved.TimeZone)
+			if !test.workout.StartedAt.IsZero() {
+				assert.True(t, test.workout.StartedAt.Equal(retrieved.StartedAt))
+			}
 			assert.Equal(t, len(test.workout.Entries), len(retrieved.Entries))
+			assert.Equal(t, len(test.workout.Groups), len(retrieved.Groups))
 
 			for i, entry := range retrieved.Entries {
 				assert.Equal(t, test.workout.Entries[i].ExerciseName, entry.ExerciseName)
-				assert.Equal(t, test.workout.Entries[i].Sets, entry.Sets)
+				assert.Equal(t, test.workout.Entries[i].SetCount, entry.SetCount)
 				assert.Equal(t, test.workout.Entries[i].Reps, entry.Reps)
 				assert.Equal(t, test.workout.Entries[i].DurationSeconds, entry.DurationSeconds)
 				assert.Equal(t, test.workout.Entries[i].Weight, entry.Weight)
 				assert.Equal(t, test.workout.Entries[i].OrderIndex, entry.OrderIndex)
+				assert.Equal(t, len(test.workout.Entries[i].Sets), len(entry.Sets))
+				assert.Equal(t, test.workout.Entries[i].GroupIndex, entry.GroupIndex)
 			}
 		})
 	}
 }
 
+func createTestUser(t *testing.T, db *sql.DB) *store.User {
+	user := &store.User{
+		Username: "testuser",
+		Email: "test@example.com",
+	}
+	require.NoError(t, user.PasswordHash.Set("password"))
+
+	_, err := db.Exec(`DELETE FROM users WHERE username = $1`, user.Username)
+	require.NoError(t, err)
+
+	err = store.NewPostgresUserStore(db).CreateUser(user)
+	require.NoError(t, err)
+
+	return user
+}
+
+func TestUpdateWorkout(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db)
+	testStore := store.NewPostgresWorkoutStore(db)
+
+	workout, err := testStore.CreateWorkout(&store.Workout{
+		UserID: user.ID,
+		Title: "push day",
+		DurationMinutes: 60,
+		CaloriesBurned: 200,
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Bench Press", SetCount: 3, Reps: intPtr(10), OrderIndex: 1},
+			{ExerciseName: "Dips", SetCount: 3, Reps: intPtr(12), OrderIndex: 2},
+		},
+	})
+	require.NoError(t, err)
+	require.NotZero(t, workout.Entries[0].ID)
+	require.NotZero(t, workout.Entries[1].ID)
+
+	// drop dips, keep bench, add a new one
+	workout.Entries = []store.WorkoutEntry{
+		workout.Entries[0],
+		{ExerciseName: "Overhead Press", SetCount: 4, Reps: intPtr(8), OrderIndex: 2},
+	}
+	require.NoError(t, testStore.UpdateWorkout(workout, int64(workout.ID), nil))
+	assert.NotZero(t, workout.Entries[1].ID)
+	assert.Equal(t, 2, workout.Version)
+
+	retrieved, err := testStore.GetWorkoutById(int64(workout.ID))
+	require.NoError(t, err)
+	require.Len(t, retrieved.Entries, 2)
+	assert.Equal(t, "Bench Press", retrieved.Entries[0].ExerciseName)
+	assert.Equal(t, "Overhead Press", retrieved.Entries[1].ExerciseName)
+
+	// an entry ID from nowhere should fail rather than insert
+	workout.Entries = []store.WorkoutEntry{
+		{ID: 999999, ExerciseName: "Made Up", SetCount: 1, Reps: intPtr(1), OrderIndex: 1},
+	}
+	err = testStore.UpdateWorkout(workout, int64(workout.ID), nil)
+	assert.ErrorIs(t, err, store.ErrEntryNotFound)
+
+	// a write made against an old version is turned away
+	workout.Entries = []store.WorkoutEntry{}
+	err = testStore.UpdateWorkout(workout, int64(workout.ID), []int{1})
+	assert.ErrorIs(t, err, store.ErrVersionMismatch)
+
+	// clearing every entry should still leave a readable workout
+	require.NoError(t, testStore.UpdateWorkout(workout, int64(workout.ID), []int{2}))
+
+	retrieved, err = testStore.GetWorkoutById(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Empty(t, retrieved.Entries)
+}
+
+func TestCreateWorkouts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db)
+	testStore := store.NewPostgresWorkoutStore(db)
+
+	workouts := []*store.Workout{
+		{
+			UserID: user.ID,
+			Title: "push day",
+			DurationMinutes: 60,
+			Entries: []store.WorkoutEntry{
+				{
+					ExerciseName: "Bench Press",
+					OrderIndex: 1,
+					Sets: []store.WorkoutSet{
+						{Reps: intPtr(5), Weight: floatPtr(100)},
+						{Reps: intPtr(3), Weight: floatPtr(110)},
+					},
+				},
+			},
+		},
+		{
+			UserID: user.ID,
+			Title: "arms",
+			DurationMinutes: 30,
+			Groups: []store.EntryGroup{
+				{Type: "superset", Rounds: 3},
+			},
+			Entries: []store.WorkoutEntry{
+				{ExerciseName: "Barbell Curl", SetCount: 3, Reps: intPtr(10), OrderIndex: 1, GroupIndex: intPtr(0)},
+				{ExerciseName: "Tricep Pushdown", SetCount: 3, Reps: intPtr(12), OrderIndex: 2, GroupIndex: intPtr(0)},
+			},
+		},
+	}
+	require.NoError(t, testStore.CreateWorkouts(workouts))
+
+	for _, workout := range workouts {
+		assert.NotZero(t, workout.ID)
+		assert.Equal(t, 1, workout.Version)
+
+		retrieved, err := testStore.GetWorkoutById(int64(workout.ID))
+		require.NoError(t, err)
+		assert.Equal(t, workout.Title, retrieved.Title)
+		assert.Equal(t, workout.Entries, retrieved.Entries)
+
+		revisions, err := testStore.ListWorkoutRevisions(int64(workout.ID))
+		require.NoError(t, err)
+		require.Len(t, revisions, 1)
+		assert.Equal(t, store.RevisionCreate, revisions[0].Action)
+	}
+
+	assert.Len(t, workouts[0].Entries[0].Sets, 2)
+	assert.Equal(t, 2, workouts[0].Entries[0].SetCount)
+	require.Len(t, workouts[1].Groups, 1)
+	assert.Equal(t, []int{workouts[1].Entries[0].ID, workouts[1].Entries[1].ID}, workouts[1].Groups[0].EntryIDs)
+
+	// one bad workout and none of them go in
+	missingExercise := 999999
+	err := testStore.CreateWorkouts([]*store.Workout{
+		{UserID: user.ID, Title: "fine", DurationMinutes: 20},
+		{
+			UserID: user.ID,
+			Title: "broken",
+			DurationMinutes: 20,
+			Entries: []store.WorkoutEntry{
+				{ExerciseID: &missingExercise, ExerciseName: "Nothing", SetCount: 1, Reps: intPtr(1), OrderIndex: 1},
+			},
+		},
+	})
+	assert.Error(t, err)
+
+	page, err := testStore.ListWorkouts(store.WorkoutFilter{UserID: user.ID})
+	require.NoError(t, err)
+	assert.Len(t, page.Workouts, 2)
+}
+
+func TestDeleteWorkout(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db)
+	testStore := store.NewPostgresWorkoutStore(db)
+
+	workout, err := testStore.CreateWorkout(&store.Workout{
+		UserID: user.ID,
+		Title: "leg day",
+		DurationMinutes: 45,
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Squat", SetCount: 5, Reps: intPtr(5), OrderIndex: 1},
+		},
+	})
+	require.NoError(t, err)
+	id := int64(workout.ID)
+
+	// deleting only moves it to the trash
+	assert.ErrorIs(t, testStore.DeleteWorkout(id, []int{}), store.ErrVersionMismatch)
+	require.NoError(t, testStore.DeleteWorkout(id, []int{1}))
+	_, err = testStore.GetWorkoutById(id)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = testStore.GetWorkoutOwner(id)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.ErrorIs(t, testStore.DeleteWorkout(id, nil), sql.ErrNoRows)
+
+	page, err := testStore.ListWorkouts(store.WorkoutFilter{UserID: user.ID})
+	require.NoError(t, err)
+	assert.Empty(t, page.Workouts)
+
+	trash, err := testStore.ListTrashedWorkouts(user.ID)
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.NotNil(t, trash[0].DeletedAt)
+	assert.Len(t, trash[0].Entries, 1)
+
+	// only the owner can restore it
+	assert.ErrorIs(t, testStore.RestoreWorkout(user.ID+1, id), sql.ErrNoRows)
+	require.NoError(t, testStore.RestoreWorkout(user.ID, id))
+	restored, err := testStore.GetWorkoutById(id)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+
+	// the purge leaves anything trashed after the cutoff alone
+	require.NoError(t, testStore.DeleteWorkout(id, nil))
+	purged, err := testStore.PurgeDeletedWorkouts(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+
+	purged, err = testStore.PurgeDeletedWorkouts(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	assert.ErrorIs(t, testStore.RestoreWorkout(user.ID, id), sql.ErrNoRows)
+}
+
+func TestWorkoutRevisions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db)
+	testStore := store.NewPostgresWorkoutStore(db)
+
+	workout, err := testStore.CreateWorkout(&store.Workout{
+		UserID: user.ID,
+		Title: "push day",
+		DurationMinutes: 60,
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Bench Press", SetCount: 3, Reps: intPtr(10), Weight: floatPtr(60), OrderIndex: 1},
+		},
+	})
+	require.NoError(t, err)
+	id := int64(workout.ID)
+
+	workout.Title = "chest day"
+	workout.Entries = append(workout.Entries, store.WorkoutEntry{ExerciseName: "Dips", SetCount: 3, Reps: intPtr(12), OrderIndex: 2})
+	require.NoError(t, testStore.UpdateWorkout(workout, id, nil))
+
+	revisions, err := testStore.ListWorkoutRevisions(id)
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, 2, revisions[0].Revision)
+	assert.Equal(t, store.RevisionUpdate, revisions[0].Action)
+	assert.Equal(t, store.RevisionCreate, revisions[1].Action)
+
+	first, err := testStore.GetWorkoutRevision(id, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "push day", first.Workout.Title)
+	assert.Len(t, first.Workout.Entries, 1)
+
+	_, err = testStore.GetWorkoutRevision(id, 9)
+	assert.ErrorIs(t, err, store.ErrRevisionNotFound)
+
+	// reverting is a new revision, not a rewind
+	reverted, err := testStore.RevertWorkout(id, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "push day", reverted.Title)
+	assert.Len(t, reverted.Entries, 1)
+
+	latest, err := testStore.GetWorkoutRevision(id, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, latest.Revision)
+	assert.Equal(t, store.RevisionRevert, latest.Action)
+
+	// sets and groups keep their IDs across a write so a revision only shows what changed
+	reverted.Groups = []store.EntryGroup{{Type: "superset", Rounds: 3}}
+	reverted.Entries[0].GroupIndex = intPtr(0)
+	reverted.Entries[0].Sets = []store.WorkoutSet{
+		{Reps: intPtr(10), Weight: floatPtr(60)},
+		{Reps: intPtr(8), Weight: floatPtr(70)},
+	}
+	require.NoError(t, testStore.UpdateWorkout(reverted, id, nil))
+	setID, groupID := reverted.Entries[0].Sets[0].ID, reverted.Groups[0].ID
+
+	reverted.Groups[0].Rounds = 4
+	reverted.Entries[0].Sets[1].Reps = intPtr(6)
+	require.NoError(t, testStore.UpdateWorkout(reverted, id, nil))
+
+	updated, err := testStore.GetWorkoutById(id)
+	require.NoError(t, err)
+	assert.Equal(t, setID, updated.Entries[0].Sets[0].ID)
+	assert.Equal(t, groupID, updated.Groups[0].ID)
+	assert.Equal(t, 6, *updated.Entries[0].Sets[1].Reps)
+	assert.Equal(t, 4, updated.Groups[0].Rounds)
+}
+
+func TestPersonalRecordsFollowHistory(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db)
+	testStore := store.NewPostgresWorkoutStore(db)
+	recordStore := store.NewPostgresPersonalRecordStore(db)
+
+	var benchID int
+	err := db.QueryRow(`SELECT id FROM exercises WHERE name = 'Barbell Bench Press' AND user_id IS NULL`).Scan(&benchID)
+	require.NoError(t, err)
+
+	bench := func(title string, weight float64, startedAt time.Time) *store.Workout {
+		workout, err := testStore.CreateWorkout(&store.Workout{
+			UserID: user.ID,
+			Title: title,
+			DurationMinutes: 60,
+			StartedAt: startedAt,
+			Entries: []store.WorkoutEntry{
+				{ExerciseID: &benchID, ExerciseName: "Barbell Bench Press", SetCount: 1, Reps: intPtr(1), Weight: floatPtr(weight), OrderIndex: 1},
+			},
+		})
+		require.NoError(t, err)
+		return workout
+	}
+
+	heaviest := func() float64 {
+		current, err := recordStore.ListPersonalRecords(user.ID, records.Epley, benchID)
+		require.NoError(t, err)
+		for _, record := range current {
+			if record.Kind == records.HeaviestWeight {
+				return record.Value
+			}
+		}
+		return 0
+	}
+
+	a := bench("A", 100, time.Date(2024, time.January, 1, 9, 0, 0, 0, time.UTC))
+	b := bench("B", 95, time.Date(2024, time.January, 8, 9, 0, 0, 0, time.UTC))
+	assert.Equal(t, 100.0, heaviest())
+
+	assert.NotEmpty(t, a.NewRecords)
+	assert.Empty(t, b.NewRecords) // 95 at one rep beats nothing A didn't already
+
+	// lowering A hands the record to B
+	a.Entries[0].Weight = floatPtr(80)
+	require.NoError(t, testStore.UpdateWorkout(a, int64(a.ID), nil))
+	assert.Equal(t, 95.0, heaviest())
+
+	// and so does trashing it
+	a.Entries[0].Weight = floatPtr(100)
+	require.NoError(t, testStore.UpdateWorkout(a, int64(a.ID), nil))
+	require.NoError(t, testStore.DeleteWorkout(int64(a.ID), nil))
+	assert.Equal(t, 95.0, heaviest())
+}
+
+func TestEntryGroupMinimum(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db)
+	testStore := store.NewPostgresWorkoutStore(db)
+
+	workout, err := testStore.CreateWorkout(&store.Workout{
+		UserID: user.ID,
+		Title: "arms",
+		DurationMinutes: 45,
+		Groups: []store.EntryGroup{{Type: "superset", Rounds: 3}},
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Curl", SetCount: 3, Reps: intPtr(12), OrderIndex: 1, GroupIndex: intPtr(0)},
+			{ExerciseName: "Pushdown", SetCount: 3, Reps: intPtr(12), OrderIndex: 2, GroupIndex: intPtr(0)},
+		},
+	})
+	require.NoError(t, err)
+	id := int64(workout.ID)
+
+	// a superset of one isn't a superset
+	err = testStore.DeleteWorkoutEntry(id, int64(workout.Entries[0].ID))
+	assert.ErrorIs(t, err, store.ErrGroupTooSmall)
+
+	_, _, err = testStore.PatchWorkoutEntry(id, int64(workout.Entries[1].ID), func(entry *store.WorkoutEntry) error {
+		entry.GroupIndex = nil
+		return nil
+	})
+	assert.ErrorIs(t, err, store.ErrGroupTooSmall)
+
+	entries, err := testStore.ListWorkoutEntries(id)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.NotNil(t, entries[1].GroupIndex)
+}
+
+func TestImportJobs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db)
+	workoutStore := store.NewPostgresWorkoutStore(db)
+	jobStore := store.NewPostgresImportJobStore(db)
+
+	startedAt := time.Date(2024, time.March, 4, 7, 30, 0, 0, time.UTC)
+	_, err := workoutStore.CreateWorkout(&store.Workout{UserID: user.ID, Title: "push day", DurationMinutes: 60, StartedAt: startedAt})
+	require.NoError(t, err)
+
+	times, err := workoutStore.ListWorkoutStartTimes(user.ID, startedAt, startedAt.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, times, 1)
+	assert.True(t, startedAt.Equal(times[0]))
+
+	job := &store.ImportJob{UserID: user.ID, Format: "strong", Total: 3, Warnings: []string{"line 4: skipped"}}
+	require.NoError(t, jobStore.CreateImportJob(job))
+	assert.Equal(t, store.ImportPending, job.Status)
+
+	now := time.Now()
+	job.Status = store.ImportRunning
+	job.StartedAt = &now
+	job.Processed = 2
+	job.Created = 1
+	job.Skipped = 1
+	require.NoError(t, jobStore.UpdateImportJob(job))
+
+	retrieved, err := jobStore.GetImportJob(user.ID, int64(job.ID))
+	require.NoError(t, err)
+	require.NotNil(t, retrieved)
+	assert.Equal(t, 2, retrieved.Processed)
+	assert.Equal(t, []string{"line 4: skipped"}, retrieved.Warnings)
+	assert.Empty(t, retrieved.Errors)
+
+	missing, err := jobStore.GetImportJob(user.ID+1, int64(job.ID))
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	// a restart leaves nothing to finish the job
+	interrupted, err := jobStore.FailInterruptedImportJobs()
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, interrupted, int64(1))
+
+	jobs, err := jobStore.ListImportJobs(user.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, store.ImportFailed, jobs[0].Status)
+	assert.NotNil(t, jobs[0].FinishedAt)
+	assert.Len(t, jobs[0].Errors, 1)
+}
+
+func TestWorkoutTracks(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db)
+	testStore := store.NewPostgresWorkoutStore(db)
+
+	startedAt := time.Date(2024, time.March, 4, 7, 0, 0, 0, time.UTC)
+	endedAt := startedAt.Add(30 * time.Minute)
+	speed := 2.9
+	workoutTrack := &store.WorkoutTrack{
+		Format: "gpx",
+		Sport: "running",
+		Raw: []byte(`<gpx></gpx>`),
+		Points: 1800,
+		DistanceMeters: 5000,
+		ElapsedSeconds: 1800,
+		MovingSeconds: 1720,
+		ElevationGainMeters: 42,
+		AvgSpeedMps: &speed,
+		AvgHeartRate: intPtr(150),
+	}
+
+	workout, err := testStore.CreateWorkoutWithTrack(&store.Workout{
+		UserID: user.ID,
+		Title: "Morning Run",
+		DurationMinutes: 30,
+		StartedAt: startedAt,
+		EndedAt: &endedAt,
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Running", SetCount: 1, DurationSeconds: intPtr(1720), OrderIndex: 1},
+		},
+	}, workoutTrack)
+	require.NoError(t, err)
+	assert.Equal(t, workout.ID, workoutTrack.WorkoutID)
+
+	retrieved, err := testStore.GetWorkoutTrack(int64(workout.ID))
+	require.NoError(t, err)
+	require.NotNil(t, retrieved)
+	assert.Nil(t, retrieved.Raw) // only loaded to reprocess
+	assert.Equal(t, 5000.0, retrieved.DistanceMeters)
+	assert.Nil(t, retrieved.MaxHeartRate)
+
+	reprocessed, reprocessedWorkout, err := testStore.ReprocessWorkoutTrack(int64(workout.ID), func(track *store.WorkoutTrack, workout *store.Workout) error {
+		assert.Equal(t, []byte(`<gpx></gpx>`), track.Raw)
+		track.DistanceMeters = 5010
+		workout.Entries[0].DurationSeconds = intPtr(1700)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 5010.0, reprocessed.DistanceMeters)
+	assert.Equal(t, 2, reprocessedWorkout.Version)
+
+	updated, err := testStore.GetWorkoutTrack(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Equal(t, 5010.0, updated.DistanceMeters)
+
+	revisions, err := testStore.ListWorkoutRevisions(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Len(t, revisions, 2)
+
+	none, err := testStore.GetWorkoutTrack(int64(workout.ID) + 1)
+	require.NoError(t, err)
+	assert.Nil(t, none)
+}
+
+func TestCardioEntries(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db)
+	testStore := store.NewPostgresWorkoutStore(db)
+
+	workout, err := testStore.CreateWorkout(&store.Workout{
+		UserID: user.ID,
+		Title: "Run and row",
+		DurationMinutes: 45,
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Running", Distance: floatPtr(5000), DistanceUnit: "km", DurationSeconds: intPtr(1500), AvgHeartRate: intPtr(152), MaxHeartRate: intPtr(171), OrderIndex: 1},
+			{ExerciseName: "Rowing", SetCount: 4, Distance: floatPtr(500), DistanceUnit: "m", Power: intPtr(210), OrderIndex: 2},
+			{ExerciseName: "Walking", Distance: floatPtr(0.001), DistanceUnit: "m", DurationSeconds: intPtr(3600), OrderIndex: 3},
+		},
+	})
+	require.NoError(t, err)
+
+	retrieved, err := testStore.GetWorkoutById(int64(workout.ID))
+	require.NoError(t, err)
+	require.Len(t, retrieved.Entries, 3)
+
+	run := retrieved.Entries[0]
+	assert.Equal(t, 1, run.SetCount) // a cardio entry with no set_count is one set
+	assert.Equal(t, 5000.0, *run.Distance)
+	assert.Equal(t, "km", run.DistanceUnit)
+	require.NotNil(t, run.PaceSecondsPerKm)
+	assert.Equal(t, 300.0, *run.PaceSecondsPerKm)
+	assert.Equal(t, 171, *run.MaxHeartRate)
+
+	row := retrieved.Entries[1]
+	assert.Equal(t, 4, row.SetCount)
+	assert.Nil(t, row.PaceSecondsPerKm) // no time to work it out from
+	assert.Equal(t, 210, *row.Power)
+
+	assert.Nil(t, retrieved.Entries[2].PaceSecondsPerKm) // far too slow to be a pace, and too big for the column
+
+	_, err = testStore.CreateWorkout(&store.Workout{
+		UserID: user.ID,
+		Title: "Not a thing",
+		DurationMinutes: 10,
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Running", SetCount: 1, Reps: intPtr(10), Distance: floatPtr(1000), OrderIndex: 1},
+		},
+	})
+	assert.Error(t, err) // valid_workout_entry won't have reps and a distance together
+}
+
+func TestHeartRateSamples(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db)
+	testStore := store.NewPostgresWorkoutStore(db)
+
+	workout, err := testStore.CreateWorkout(&store.Workout{
+		UserID: user.ID,
+		Title: "Intervals",
+		DurationMinutes: 20,
+	})
+	require.NoError(t, err)
+
+	none, err := testStore.GetHeartRateSamples(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Nil(t, none)
+
+	samples := []store.HeartRateSample{{OffsetSeconds: 0, BPM: 110}, {OffsetSeconds: 1, BPM: 115}, {OffsetSeconds: 3, BPM: 150}}
+	require.NoError(t, testStore.ReplaceHeartRateSamples(int64(workout.ID), samples))
+
+	retrieved, err := testStore.GetHeartRateSamples(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Equal(t, samples, retrieved)
+
+	// a second upload replaces the first
+	require.NoError(t, testStore.ReplaceHeartRateSamples(int64(workout.ID), samples[:1]))
+
+	retrieved, err = testStore.GetHeartRateSamples(int64(workout.ID))
+	require.NoError(t, err)
+	assert.Len(t, retrieved, 1)
+}
+
+func TestNewRecordsOnlyWhenSet(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db)
+	testStore := store.NewPostgresWorkoutStore(db)
+
+	var benchID int
+	err := db.QueryRow(`SELECT id FROM exercises WHERE name = 'Barbell Bench Press' AND user_id IS NULL`).Scan(&benchID)
+	require.NoError(t, err)
+
+	workout, err := testStore.CreateWorkout(&store.Workout{
+		UserID: user.ID,
+		Title: "push",
+		DurationMinutes: 60,
+		Entries: []store.WorkoutEntry{
+			{ExerciseID: &benchID, ExerciseName: "Barbell Bench Press", SetCount: 3, Reps: intPtr(5), Weight: floatPtr(90), OrderIndex: 1},
+		},
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, workout.NewRecords)
+
+	// putting the same workout again keeps its records but sets none
+	id := int64(workout.ID)
+	require.NoError(t, testStore.UpdateWorkout(workout, id, nil))
+	require.NoError(t, testStore.UpdateWorkout(workout, id, nil))
+	assert.Empty(t, workout.NewRecords)
+
+	// a heavier set is new again
+	workout.Entries[0].Weight = floatPtr(95)
+	require.NoError(t, testStore.UpdateWorkout(workout, id, nil))
+	assert.NotEmpty(t, workout.NewRecords)
+	for _, record := range workout.NewRecords {
+		assert.Equal(t, benchID, record.ExerciseID)
+	}
+}
+
+func TestSearchWorkoutsEscapesHighlights(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	user := createTestUser(t, db)
+	testStore := store.NewPostgresWorkoutStore(db)
+
+	_, err := testStore.CreateWorkout(&store.Workout{
+		UserID: user.ID,
+		Title: `<script>alert(1)</script> heavy bench day with a title long enough to have been cut up`,
+		DurationMinutes: 60,
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Bench Press", SetCount: 3, Reps: intPtr(5), Notes: `<img src=x onerror=alert(1)> bench felt good`, OrderIndex: 1},
+		},
+	})
+	require.NoError(t, err)
+
+	results, err := testStore.SearchWorkouts(user.ID, "bench", 0)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	result := results[0]
+	assert.NotContains(t, result.Title, "<script>")
+	assert.Contains(t, result.Title, "&lt;script&gt;")
+	assert.Contains(t, result.Title, "<mark>bench</mark>")
+	assert.Contains(t, result.Title, "cut up") // the whole title, not a fragment
+
+	require.Len(t, result.EntryMatches, 1)
+	assert.NotContains(t, result.EntryMatches[0].Notes, "<img")
+	assert.Contains(t, result.EntryMatches[0].Notes, "<mark>bench</mark>")
+}
+
 func intPtr(i int) *int {
 	return &i
 }
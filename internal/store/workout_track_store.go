@@ -0,0 +1,200 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// WorkoutTrack is the GPS recording a cardio workout was made from, with what it adds up to
+type WorkoutTrack struct {
+	WorkoutID           int       `json:"workout_id"`
+	Format              string    `json:"format"` // gpx or tcx
+	Sport               string    `json:"sport"`
+	Points              int       `json:"points"`
+	DistanceMeters      float64   `json:"distance_meters"`
+	ElapsedSeconds      int       `json:"elapsed_seconds"`
+	MovingSeconds       int       `json:"moving_seconds"`
+	ElevationGainMeters float64   `json:"elevation_gain_meters"`
+	AvgSpeedMps         *float64  `json:"avg_speed_mps"`
+	AvgHeartRate        *int      `json:"avg_heart_rate"`
+	MaxHeartRate        *int      `json:"max_heart_rate"`
+	ProcessedAt         time.Time `json:"processed_at"`
+	Raw                 []byte    `json:"-"` // the file as uploaded
+}
+
+// CreateWorkoutWithTrack is CreateWorkout with the track written in the same transaction, track.WorkoutID is filled in
+func (pg *PostgresWorkoutStore) CreateWorkoutWithTrack(workout *Workout, track *WorkoutTrack) (*Workout, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = createWorkoutTx(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	track.WorkoutID = workout.ID
+
+	query := `
+		INSERT INTO workout_tracks (
+			workout_id, format, sport, raw, points, distance_meters, elapsed_seconds, moving_seconds,
+			elevation_gain_meters, avg_speed_mps, avg_heart_rate, max_heart_rate
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING processed_at;
+	`
+
+	err = tx.QueryRow(
+		query,
+		track.WorkoutID,
+		track.Format,
+		track.Sport,
+		track.Raw,
+		track.Points,
+		track.DistanceMeters,
+		track.ElapsedSeconds,
+		track.MovingSeconds,
+		track.ElevationGainMeters,
+		track.AvgSpeedMps,
+		track.AvgHeartRate,
+		track.MaxHeartRate,
+	).Scan(&track.ProcessedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
+
+// GetWorkoutTrack returns nil when the workout wasn't made from a track. Raw is left empty, the file is only ever
+// needed to reprocess it
+func (pg *PostgresWorkoutStore) GetWorkoutTrack(workoutID int64) (*WorkoutTrack, error) {
+	return getWorkoutTrack(pg.db, workoutID, false)
+}
+
+func getWorkoutTrack(q queryer, workoutID int64, withRaw bool) (*WorkoutTrack, error) {
+	raw := `NULL::bytea`
+	if withRaw {
+		raw = `raw`
+	}
+
+	query := `
+		SELECT
+			workout_id, format, sport, ` + raw + `, points, distance_meters, elapsed_seconds, moving_seconds,
+			elevation_gain_meters, avg_speed_mps, avg_heart_rate, max_heart_rate, processed_at
+		FROM workout_tracks
+		WHERE workout_id = $1;
+	`
+
+	track := &WorkoutTrack{}
+	err := q.QueryRow(query, workoutID).Scan(
+		&track.WorkoutID,
+		&track.Format,
+		&track.Sport,
+		&track.Raw,
+		&track.Points,
+		&track.DistanceMeters,
+		&track.ElapsedSeconds,
+		&track.MovingSeconds,
+		&track.ElevationGainMeters,
+		&track.AvgSpeedMps,
+		&track.AvgHeartRate,
+		&track.MaxHeartRate,
+		&track.ProcessedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return track, nil
+}
+
+// ReprocessWorkoutTrack loads the track with its file and the workout it made, hands both to apply to work the
+// summary out again and bring the workout in line with it, then writes both back in one transaction. The workout
+// goes through the same write as an update, so it gets a revision and a new version. Returns nil, nil, nil when the
+// workout has no track
+func (pg *PostgresWorkoutStore) ReprocessWorkoutTrack(workoutID int64, apply func(*WorkoutTrack, *Workout) error) (*WorkoutTrack, *Workout, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	err = lockWorkoutVersion(tx, workoutID, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	track, err := getWorkoutTrack(tx, workoutID, true)
+	if err != nil || track == nil {
+		return nil, nil, err
+	}
+
+	workout, err := getWorkoutById(tx, workoutID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = apply(track, workout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = updateWorkoutTx(tx, workout, workoutID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = updateWorkoutTrack(tx, track)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	workout.Version, workout.NewRecords, err = recordRevision(tx, workoutID, RevisionUpdate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return track, workout, nil
+}
+
+// updateWorkoutTrack rewrites the summary after the raw file's been processed again, the file itself never changes
+func updateWorkoutTrack(tx *sql.Tx, track *WorkoutTrack) error {
+	query := `
+		UPDATE workout_tracks
+		SET sport = $1, points = $2, distance_meters = $3, elapsed_seconds = $4, moving_seconds = $5,
+			elevation_gain_meters = $6, avg_speed_mps = $7, avg_heart_rate = $8, max_heart_rate = $9,
+			processed_at = CURRENT_TIMESTAMP
+		WHERE workout_id = $10
+		RETURNING processed_at;
+	`
+
+	return tx.QueryRow(
+		query,
+		track.Sport,
+		track.Points,
+		track.DistanceMeters,
+		track.ElapsedSeconds,
+		track.MovingSeconds,
+		track.ElevationGainMeters,
+		track.AvgSpeedMps,
+		track.AvgHeartRate,
+		track.MaxHeartRate,
+		track.WorkoutID,
+	).Scan(&track.ProcessedAt)
+}
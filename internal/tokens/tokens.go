@@ -9,6 +9,7 @@ import (
 
 const (
 	ScopeAuth = "authentication"
+	ScopeCalendarFeed = "calendar_feed" // read only, goes in the .ics URL as calendar apps can't send a Bearer header
 )
 
 
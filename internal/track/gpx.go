@@ -0,0 +1,63 @@
+package track
+
+type gpxFile struct {
+	Name   string     `xml:"metadata>name"`
+	Tracks []gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name     string `xml:"name"`
+	Type     string `xml:"type"`
+	Segments []struct {
+		Points []gpxPoint `xml:"trkpt"`
+	} `xml:"trkseg"`
+}
+
+// gpxPoint reads heart rate from Garmin's TrackPointExtension, which is what Strava and most watches write too
+type gpxPoint struct {
+	Lat       float64  `xml:"lat,attr"`
+	Lon       float64  `xml:"lon,attr"`
+	Elevation *float64 `xml:"ele"`
+	Time      string   `xml:"time"`
+	HeartRate *int     `xml:"extensions>TrackPointExtension>hr"`
+}
+
+// parseGPX joins every track and segment in the file into one, the gaps between segments are pauses
+func parseGPX(data []byte) (*Track, error) {
+	var file gpxFile
+	err := decode(data, &file)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Track{Format: GPX, Name: file.Name}
+
+	for _, trk := range file.Tracks {
+		if t.Name == "" {
+			t.Name = trk.Name
+		}
+		if t.Sport == "" {
+			t.Sport = normalizeSport(trk.Type)
+		}
+
+		for _, segment := range trk.Segments {
+			for _, p := range segment.Points {
+				pointTime, ok := parseTime(p.Time)
+				if !ok {
+					continue
+				}
+
+				lat, lon := p.Lat, p.Lon
+				t.Points = append(t.Points, Point{
+					Time:      pointTime,
+					Lat:       &lat,
+					Lon:       &lon,
+					Elevation: p.Elevation,
+					HeartRate: p.HeartRate,
+				})
+			}
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,64 @@
+package track
+
+type tcxFile struct {
+	Activities []struct {
+		Sport string `xml:"Sport,attr"`
+		Notes string `xml:"Notes"`
+		Laps  []struct {
+			Tracks []struct {
+				Points []tcxPoint `xml:"Trackpoint"`
+			} `xml:"Track"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+type tcxPoint struct {
+	Time      string   `xml:"Time"`
+	Lat       *float64 `xml:"Position>LatitudeDegrees"`
+	Lon       *float64 `xml:"Position>LongitudeDegrees"`
+	Altitude  *float64 `xml:"AltitudeMeters"`
+	Distance  *float64 `xml:"DistanceMeters"`
+	HeartRate *int     `xml:"HeartRateBpm>Value"`
+}
+
+// parseTCX joins the laps of every activity in the file. TCX has nowhere to put a name, the activity's notes are the closest thing
+func parseTCX(data []byte) (*Track, error) {
+	var file tcxFile
+	err := decode(data, &file)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Track{Format: TCX}
+
+	for _, activity := range file.Activities {
+		if t.Name == "" {
+			t.Name = activity.Notes
+		}
+		if t.Sport == "" {
+			t.Sport = normalizeSport(activity.Sport)
+		}
+
+		for _, lap := range activity.Laps {
+			for _, trk := range lap.Tracks {
+				for _, p := range trk.Points {
+					pointTime, ok := parseTime(p.Time)
+					if !ok {
+						continue
+					}
+
+					t.Points = append(t.Points, Point{
+						Time:      pointTime,
+						Lat:       p.Lat,
+						Lon:       p.Lon,
+						Elevation: p.Altitude,
+						Distance:  p.Distance,
+						HeartRate: p.HeartRate,
+					})
+				}
+			}
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,294 @@
+// Package track reads GPS recordings (GPX and Garmin's TCX) and works out the numbers a cardio session is judged on:
+// distance, moving time, elevation gain, speed and heart rate. Everything is worked out here from the trackpoints
+// rather than trusting a summary the device may or may not have written
+package track
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format is the kind of file a track came from
+type Format string
+
+const (
+	GPX Format = "gpx"
+	TCX Format = "tcx"
+)
+
+// sports a track can be, "" when the file doesn't say or it's something else
+const (
+	Running  = "running"
+	Cycling  = "cycling"
+	Walking  = "walking"
+	Hiking   = "hiking"
+	Swimming = "swimming"
+	Rowing   = "rowing"
+)
+
+const (
+	// MovingSpeedMps is the speed below which time doesn't count as moving, well under a walk but above GPS drift
+	MovingSpeedMps = 0.5
+
+	// ElevationThresholdMeters is how far the elevation has to move before it counts, GPS altitude wanders by a few
+	// metres standing still and summing every wobble would make a flat run look hilly
+	ElevationThresholdMeters = 3.0
+
+	earthRadiusMeters = 6371000.0
+)
+
+var (
+	ErrUnknownFormat = errors.New("file is not a GPX or TCX file")
+	ErrInvalidFormat = errors.New("format must be gpx or tcx")
+	ErrTooShort      = errors.New("track needs at least two timed trackpoints")
+)
+
+// ParseFormat reads a format from a query param, "" comes back as "" so the format gets detected
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case "":
+		return "", nil
+	case GPX:
+		return GPX, nil
+	case TCX:
+		return TCX, nil
+	}
+	return "", ErrInvalidFormat
+}
+
+// Point is a single trackpoint, anything the device didn't record is nil
+type Point struct {
+	Time      time.Time
+	Lat       *float64
+	Lon       *float64
+	Elevation *float64 // metres
+	Distance  *float64 // metres from the start, TCX devices write it and it's all an indoor session has
+	HeartRate *int
+}
+
+type Track struct {
+	Format Format
+	Name   string
+	Sport  string
+	Points []Point // oldest first, points without a time are dropped as nothing can be worked out from them
+}
+
+// Summary is what the track adds up to
+type Summary struct {
+	Points              int
+	StartedAt           time.Time
+	EndedAt             time.Time
+	DistanceMeters      float64
+	ElapsedSeconds      int
+	MovingSeconds       int
+	ElevationGainMeters float64
+	AvgSpeedMps         *float64 // over moving time, nil when there wasn't any
+	AvgHeartRate        *int
+	MaxHeartRate        *int
+}
+
+// Parse reads a GPX or TCX file, format is detected from the root element when it's left empty
+func Parse(data []byte, format Format) (*Track, error) {
+	if format == "" {
+		format = detect(data)
+		if format == "" {
+			return nil, ErrUnknownFormat
+		}
+	}
+
+	var t *Track
+	var err error
+	switch format {
+	case GPX:
+		t, err = parseGPX(data)
+	case TCX:
+		t, err = parseTCX(data)
+	default:
+		return nil, ErrInvalidFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(t.Points, func(a, b int) bool {
+		return t.Points[a].Time.Before(t.Points[b].Time)
+	})
+
+	if len(t.Points) < 2 || !t.Points[len(t.Points)-1].Time.After(t.Points[0].Time) {
+		return nil, ErrTooShort
+	}
+
+	return t, nil
+}
+
+// detect looks no further than the root element
+func detect(data []byte) Format {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			switch start.Name.Local {
+			case "gpx":
+				return GPX
+			case "TrainingCenterDatabase":
+				return TCX
+			}
+			return ""
+		}
+	}
+}
+
+// Summarize works through the points in order. Distance is the device's own running total when it wrote one,
+// otherwise the great circle distance between fixes. Time between two points only counts as moving when the
+// speed over it was at least MovingSpeedMps, which is what takes out auto pause and waiting at lights
+func (t *Track) Summarize() Summary {
+	summary := Summary{
+		Points:         len(t.Points),
+		StartedAt:      t.Points[0].Time,
+		EndedAt:        t.Points[len(t.Points)-1].Time,
+		ElapsedSeconds: int(math.Round(t.Points[len(t.Points)-1].Time.Sub(t.Points[0].Time).Seconds())),
+	}
+
+	var moving float64
+	var movingDistance float64
+	var reference *float64
+	var previous *Point
+	heartRateTotal, heartRateCount := 0, 0
+
+	for i, point := range t.Points {
+		if point.HeartRate != nil && *point.HeartRate > 0 {
+			heartRateTotal += *point.HeartRate
+			heartRateCount++
+			if summary.MaxHeartRate == nil || *point.HeartRate > *summary.MaxHeartRate {
+				highest := *point.HeartRate
+				summary.MaxHeartRate = &highest
+			}
+		}
+
+		if point.Elevation != nil {
+			elevation := *point.Elevation
+			switch {
+			case reference == nil:
+				reference = &elevation
+			case elevation > *reference+ElevationThresholdMeters:
+				summary.ElevationGainMeters += elevation - *reference
+				reference = &elevation
+			case elevation < *reference-ElevationThresholdMeters:
+				reference = &elevation
+			}
+		}
+
+		// some devices write points with only a heart rate in between the fixes, those are left out of the segments
+		if !hasFix(point) {
+			continue
+		}
+		if previous == nil {
+			previous = &t.Points[i]
+			continue
+		}
+
+		distance := segmentDistance(*previous, point)
+		seconds := point.Time.Sub(previous.Time).Seconds()
+		summary.DistanceMeters += distance
+
+		if seconds > 0 && distance/seconds >= MovingSpeedMps {
+			moving += seconds
+			movingDistance += distance
+		}
+		previous = &t.Points[i]
+	}
+
+	summary.MovingSeconds = int(math.Round(moving))
+	if moving > 0 {
+		speed := movingDistance / moving
+		summary.AvgSpeedMps = &speed
+	}
+	if heartRateCount > 0 {
+		avg := int(math.Round(float64(heartRateTotal) / float64(heartRateCount)))
+		summary.AvgHeartRate = &avg
+	}
+
+	return summary
+}
+
+// PaceSecondsPerKm is the pace a speed works out to, nil for no speed at all
+func PaceSecondsPerKm(speedMps *float64) *float64 {
+	if speedMps == nil || *speedMps <= 0 {
+		return nil
+	}
+	pace := 1000 / *speedMps
+	return &pace
+}
+
+func hasFix(point Point) bool {
+	return point.Distance != nil || (point.Lat != nil && point.Lon != nil)
+}
+
+// segmentDistance prefers the device's running total, both points need one for it to be used
+func segmentDistance(from Point, to Point) float64 {
+	if from.Distance != nil && to.Distance != nil {
+		return math.Max(*to.Distance-*from.Distance, 0) // a device that resets its total mid file shouldn't take distance away
+	}
+	if from.Lat != nil && from.Lon != nil && to.Lat != nil && to.Lon != nil {
+		return haversine(*from.Lat, *from.Lon, *to.Lat, *to.Lon)
+	}
+	return 0
+}
+
+// haversine is the distance in metres between two fixes over a spherical earth, close enough over the few metres between trackpoints
+func haversine(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	toRadians := math.Pi / 180
+	dLat := (lat2 - lat1) * toRadians
+	dLon := (lon2 - lon1) * toRadians
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*toRadians)*math.Cos(lat2*toRadians)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(math.Min(a, 1)))
+}
+
+// normalizeSport maps whatever the device called the activity onto our sports
+func normalizeSport(value string) string {
+	value = strings.ToLower(value)
+	switch {
+	case strings.Contains(value, "run"):
+		return Running
+	case strings.Contains(value, "bik"), strings.Contains(value, "cycl"), strings.Contains(value, "ride"):
+		return Cycling
+	case strings.Contains(value, "walk"):
+		return Walking
+	case strings.Contains(value, "hik"):
+		return Hiking
+	case strings.Contains(value, "swim"):
+		return Swimming
+	case strings.Contains(value, "row"):
+		return Rowing
+	}
+	return ""
+}
+
+// parseTime reads the ISO 8601 times both formats use, ok is false when there isn't a usable one
+func parseTime(value string) (time.Time, bool) {
+	parsed, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return parsed, true
+}
+
+// decode is xml.Unmarshal without choking on files that declare a non UTF-8 encoding, the parts we read are ASCII anyway
+func decode(data []byte, v interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return decoder.Decode(v)
+}
@@ -0,0 +1,101 @@
+package track_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lesi97/internal/track"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// a point every 10 seconds heading north, 0.0009 degrees of latitude is just over 100m
+const gpxRun = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1">
+  <metadata><name>Morning Run</name></metadata>
+  <trk>
+    <type>running</type>
+    <trkseg>
+      <trkpt lat="51.5000" lon="-0.1000"><ele>10</ele><time>2024-03-04T07:00:00Z</time><extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>120</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt>
+      <trkpt lat="51.5009" lon="-0.1000"><ele>12</ele><time>2024-03-04T07:00:10Z</time><extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>140</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt>
+      <trkpt lat="51.5018" lon="-0.1000"><ele>20</ele><time>2024-03-04T07:00:20Z</time><extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>160</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt>
+      <trkpt lat="51.5018" lon="-0.1000"><ele>19</ele><time>2024-03-04T07:01:20Z</time></trkpt>
+      <trkpt lat="51.5027" lon="-0.1000"><ele>15</ele><time>2024-03-04T07:01:30Z</time></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+func TestParseGPX(t *testing.T) {
+	parsed, err := track.Parse([]byte(gpxRun), "")
+	require.NoError(t, err)
+
+	assert.Equal(t, track.GPX, parsed.Format)
+	assert.Equal(t, "Morning Run", parsed.Name)
+	assert.Equal(t, track.Running, parsed.Sport)
+	require.Len(t, parsed.Points, 5)
+	assert.Equal(t, 120, *parsed.Points[0].HeartRate)
+
+	summary := parsed.Summarize()
+	assert.InDelta(t, 300.2, summary.DistanceMeters, 0.5)
+	assert.Equal(t, 90, summary.ElapsedSeconds)
+	assert.Equal(t, 30, summary.MovingSeconds) // the minute stood still doesn't count
+	assert.Equal(t, 10.0, summary.ElevationGainMeters)
+	require.NotNil(t, summary.AvgSpeedMps)
+	assert.InDelta(t, 10.0, *summary.AvgSpeedMps, 0.01)
+	assert.Equal(t, 140, *summary.AvgHeartRate)
+	assert.Equal(t, 160, *summary.MaxHeartRate)
+
+	pace := track.PaceSecondsPerKm(summary.AvgSpeedMps)
+	require.NotNil(t, pace)
+	assert.InDelta(t, 100, *pace, 0.2)
+}
+
+func TestParseTCX(t *testing.T) {
+	tcx := `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">
+  <Activities>
+    <Activity Sport="Biking">
+      <Id>2024-03-04T18:00:00Z</Id>
+      <Lap StartTime="2024-03-04T18:00:00Z">
+        <Track>
+          <Trackpoint><Time>2024-03-04T18:00:00Z</Time><DistanceMeters>0</DistanceMeters><HeartRateBpm><Value>100</Value></HeartRateBpm></Trackpoint>
+          <Trackpoint><Time>2024-03-04T18:00:30Z</Time><HeartRateBpm><Value>110</Value></HeartRateBpm></Trackpoint>
+          <Trackpoint><Time>2024-03-04T18:01:00Z</Time><DistanceMeters>500</DistanceMeters><HeartRateBpm><Value>120</Value></HeartRateBpm></Trackpoint>
+        </Track>
+      </Lap>
+      <Lap StartTime="2024-03-04T18:01:00Z">
+        <Track>
+          <Trackpoint><Time>2024-03-04T18:02:00Z</Time><DistanceMeters>1000</DistanceMeters></Trackpoint>
+        </Track>
+      </Lap>
+      <Notes>Turbo session</Notes>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>`
+
+	parsed, err := track.Parse([]byte(tcx), "")
+	require.NoError(t, err)
+
+	assert.Equal(t, track.TCX, parsed.Format)
+	assert.Equal(t, track.Cycling, parsed.Sport)
+	assert.Equal(t, "Turbo session", parsed.Name)
+
+	summary := parsed.Summarize()
+	assert.Equal(t, 4, summary.Points)
+	assert.Equal(t, 1000.0, summary.DistanceMeters)
+	assert.Equal(t, 120, summary.MovingSeconds)
+	assert.Equal(t, 0.0, summary.ElevationGainMeters)
+	assert.Equal(t, 110, *summary.AvgHeartRate)
+	assert.Equal(t, time.Date(2024, time.March, 4, 18, 2, 0, 0, time.UTC), summary.EndedAt)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := track.Parse([]byte(`<kml></kml>`), "")
+	assert.ErrorIs(t, err, track.ErrUnknownFormat)
+
+	_, err = track.Parse([]byte(`<gpx><trk><trkseg><trkpt lat="1" lon="1"><time>2024-03-04T07:00:00Z</time></trkpt></trkseg></trk></gpx>`), "")
+	assert.ErrorIs(t, err, track.ErrTooShort)
+
+	_, err = track.ParseFormat("fit")
+	assert.ErrorIs(t, err, track.ErrInvalidFormat)
+}
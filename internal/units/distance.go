@@ -0,0 +1,53 @@
+package units
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrUnknownDistanceUnit = errors.New("distance_unit must be m, km or mi")
+
+// DistanceUnit is a unit of distance, kept apart from Unit so a weight can never be given in miles
+type DistanceUnit string
+
+const (
+	Meters     DistanceUnit = "m"
+	Kilometers DistanceUnit = "km"
+	Miles      DistanceUnit = "mi"
+)
+
+// CanonicalDistance is what distances are stored in
+const CanonicalDistance = Meters
+
+var metersPer = map[DistanceUnit]float64{
+	Meters:     1,
+	Kilometers: 1000,
+	Miles:      1609.344,
+}
+
+// ParseDistance reads a distance unit, "" comes back as "" so callers can fall back to a default
+func ParseDistance(s string) (DistanceUnit, error) {
+	switch DistanceUnit(s) {
+	case "", Meters, Kilometers, Miles:
+		return DistanceUnit(s), nil
+	}
+	return "", ErrUnknownDistanceUnit
+}
+
+// DefaultDistance is the distance unit that goes with a weight unit, someone lifting in lb runs in miles
+func DefaultDistance(weight Unit) DistanceUnit {
+	if weight == Pounds {
+		return Miles
+	}
+	return Kilometers
+}
+
+func DistanceToCanonical(value float64, from DistanceUnit) float64 {
+	return value * metersPer[from]
+}
+
+// DistanceFromCanonical converts a stored distance for display, rounded to 3 decimal places so km and mi come back
+// to the metre and whatever was typed in comes back exactly
+func DistanceFromCanonical(value float64, to DistanceUnit) float64 {
+	return math.Round(value/metersPer[to]*1000) / 1000
+}
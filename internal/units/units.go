@@ -0,0 +1,50 @@
+package units
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrUnknownUnit = errors.New("units must be kg or lb")
+
+// Unit is a unit of weight
+type Unit string
+
+const (
+	Kilograms Unit = "kg"
+	Pounds    Unit = "lb"
+)
+
+// Canonical is what weights are stored in, everything else is converted at the edges
+const Canonical = Kilograms
+
+const poundsPerKilogram = 2.20462262185
+
+// Parse reads a unit from a query param or request body, "" comes back as "" so callers can fall back to a default
+func Parse(s string) (Unit, error) {
+	switch Unit(s) {
+	case "", Kilograms, Pounds:
+		return Unit(s), nil
+	}
+	return "", ErrUnknownUnit
+}
+
+// Convert takes value from one unit to another without rounding
+func Convert(value float64, from Unit, to Unit) float64 {
+	if from == to {
+		return value
+	}
+	if from == Pounds {
+		return value / poundsPerKilogram
+	}
+	return value * poundsPerKilogram
+}
+
+func ToCanonical(value float64, from Unit) float64 {
+	return Convert(value, from, Canonical)
+}
+
+// FromCanonical converts a stored weight for display, rounded to 2 decimal places as nobody loads a bar more precisely than that
+func FromCanonical(value float64, to Unit) float64 {
+	return math.Round(Convert(value, Canonical, to)*100) / 100
+}
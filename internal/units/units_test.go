@@ -0,0 +1,79 @@
+package units_test
+
+import (
+	"testing"
+
+	"github.com/lesi97/internal/units"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    units.Unit
+		wantErr bool
+	}{
+		{input: "", want: ""},
+		{input: "kg", want: units.Kilograms},
+		{input: "lb", want: units.Pounds},
+		{input: "lbs", wantErr: true},
+		{input: "KG", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			unit, err := units.Parse(test.input)
+			if test.wantErr {
+				assert.ErrorIs(t, err, units.ErrUnknownUnit)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, unit)
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	assert.InDelta(t, 220.46, units.Convert(100, units.Kilograms, units.Pounds), 0.01)
+	assert.InDelta(t, 102.06, units.Convert(225, units.Pounds, units.Kilograms), 0.01)
+	assert.Equal(t, 80.0, units.Convert(80, units.Kilograms, units.Kilograms))
+}
+
+func TestRoundTrip(t *testing.T) {
+	// what a lifter types in should be exactly what they get back
+	for _, lb := range []float64{45, 135, 225, 315, 405, 1005.5} {
+		stored := units.ToCanonical(lb, units.Pounds)
+		assert.Equal(t, lb, units.FromCanonical(stored, units.Pounds))
+	}
+
+	assert.Equal(t, 102.06, units.FromCanonical(units.ToCanonical(225, units.Pounds), units.Kilograms))
+}
+
+func TestParseDistance(t *testing.T) {
+	unit, err := units.ParseDistance("mi")
+	require.NoError(t, err)
+	assert.Equal(t, units.Miles, unit)
+
+	unit, err = units.ParseDistance("")
+	require.NoError(t, err)
+	assert.Equal(t, units.DistanceUnit(""), unit)
+
+	_, err = units.ParseDistance("miles")
+	assert.ErrorIs(t, err, units.ErrUnknownDistanceUnit)
+
+	assert.Equal(t, units.Miles, units.DefaultDistance(units.Pounds))
+	assert.Equal(t, units.Kilometers, units.DefaultDistance(units.Kilograms))
+}
+
+func TestDistanceRoundTrip(t *testing.T) {
+	assert.Equal(t, 5000.0, units.DistanceToCanonical(5, units.Kilometers))
+	assert.InDelta(t, 42195.0, units.DistanceToCanonical(26.219, units.Miles), 1)
+
+	for _, mi := range []float64{1, 3.1, 13.1, 26.2} {
+		stored := units.DistanceToCanonical(mi, units.Miles)
+		assert.Equal(t, mi, units.DistanceFromCanonical(stored, units.Miles))
+	}
+
+	assert.Equal(t, 500.0, units.DistanceFromCanonical(500, units.Meters))
+}
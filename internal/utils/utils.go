@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -29,7 +31,12 @@ func WriteJSON(w http.ResponseWriter, status int, data Envelope) error {
 }
 
 func ReadIDParam(r *http.Request) (int64, error) {
-	idParam := chi.URLParam(r, "id")
+	return ReadNamedIDParam(r, "id")
+}
+
+// ReadNamedIDParam is ReadIDParam for routes with more than one id in them, e.g. /workouts/{id}/entries/{entryId}
+func ReadNamedIDParam(r *http.Request, name string) (int64, error) {
+	idParam := chi.URLParam(r, name)
 	if idParam == "" {
 		return 0, errors.New("invalid ID parameter")
 	}
@@ -41,4 +48,47 @@ func ReadIDParam(r *http.Request) (int64, error) {
 	}
 
 	return id, nil
+}
+
+func ReadIntQuery(query url.Values, key string, defaultValue int) (int, error) {
+	raw := query.Get(key)
+	if raw == "" {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a whole number", key)
+	}
+
+	return value, nil
+}
+
+// ReadDateQuery accepts either a plain date (2025-01-31) or a full RFC3339 timestamp
+// endOfDay pushes a plain date to the start of the next day so ?to=2025-01-31 includes the 31st
+func ReadDateQuery(query url.Values, key string, endOfDay bool) (*time.Time, error) {
+	return ReadDateQueryIn(query, key, endOfDay, time.UTC)
+}
+
+// ReadDateQueryIn is ReadDateQuery with plain dates read as midnight in loc rather than UTC
+func ReadDateQueryIn(query url.Values, key string, endOfDay bool, loc *time.Location) (*time.Time, error) {
+	raw := query.Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", raw, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD) or RFC3339 timestamp", key)
+	}
+
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return &t, nil
 }
\ No newline at end of file
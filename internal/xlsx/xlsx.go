@@ -0,0 +1,164 @@
+// Package xlsx writes a single sheet Office Open XML spreadsheet a row at a time, straight to the underlying writer,
+// which is all the exports need and saves pulling in a whole spreadsheet library. There's no styling, strings go in
+// as inline strings so there's no shared string table to hold in memory
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const contentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const rootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`</Relationships>`
+
+const workbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const sheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+const sheetEnd = `</sheetData></worksheet>`
+
+// Writer is only good for one sheet, rows go in order and can't be gone back to
+type Writer struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+// NewWriter writes everything but the sheet's rows up front, Close has to be called to finish the file.
+// sheetName is cut down to the 31 characters Excel allows
+func NewWriter(w io.Writer, sheetName string) (*Writer, error) {
+	archive := zip.NewWriter(w)
+
+	if len(sheetName) > 31 {
+		sheetName = sheetName[:31]
+	}
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", fmt.Sprintf(workbook, escape(sheetName))},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+	}
+
+	for _, part := range parts {
+		partWriter, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = io.WriteString(partWriter, part.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the sheet has to be the last part, zip entries are written one after the other
+	sheetWriter, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := bufio.NewWriter(sheetWriter)
+	sheet.WriteString(sheetStart)
+
+	return &Writer{zip: archive, sheet: sheet}, nil
+}
+
+// WriteRow takes strings, ints, float64s, bools and nils (an empty cell), anything else is written with fmt as a string
+func (w *Writer) WriteRow(cells []interface{}) error {
+	w.rows++
+	row := strconv.Itoa(w.rows)
+
+	w.sheet.WriteString(`<row r="` + row + `">`)
+	for i, cell := range cells {
+		ref := ColumnName(i) + row
+
+		switch value := cell.(type) {
+		case nil:
+			continue
+		case string:
+			writeString(w.sheet, ref, value)
+		case int:
+			w.sheet.WriteString(`<c r="` + ref + `"><v>` + strconv.Itoa(value) + `</v></c>`)
+		case float64:
+			w.sheet.WriteString(`<c r="` + ref + `"><v>` + strconv.FormatFloat(value, 'f', -1, 64) + `</v></c>`)
+		case bool:
+			v := "0"
+			if value {
+				v = "1"
+			}
+			w.sheet.WriteString(`<c r="` + ref + `" t="b"><v>` + v + `</v></c>`)
+		default:
+			writeString(w.sheet, ref, fmt.Sprint(value))
+		}
+	}
+	_, err := w.sheet.WriteString(`</row>`)
+
+	return err
+}
+
+// Close finishes the sheet and the zip, it doesn't close the writer passed to NewWriter
+func (w *Writer) Close() error {
+	_, err := w.sheet.WriteString(sheetEnd)
+	if err != nil {
+		return err
+	}
+
+	err = w.sheet.Flush()
+	if err != nil {
+		return err
+	}
+
+	return w.zip.Close()
+}
+
+// ColumnName is the letters for a 0 based column index, A to Z then AA, AB and so on
+func ColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// writeString keeps leading and trailing spaces, which XML would otherwise be free to drop
+func writeString(sheet *bufio.Writer, ref string, value string) {
+	sheet.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+	sheet.WriteString(escape(value))
+	sheet.WriteString(`</t></is></c>`)
+}
+
+// escape also swaps characters XML can't hold at all (most control characters) for U+FFFD
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,69 @@
+package xlsx_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/lesi97/internal/xlsx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := xlsx.NewWriter(&buf, "Workouts & more")
+	require.NoError(t, err)
+
+	require.NoError(t, w.WriteRow([]interface{}{"title", "reps", "weight", "warm-up"}))
+	require.NoError(t, w.WriteRow([]interface{}{" bench <heavy> ", 5, 102.5, true}))
+	require.NoError(t, w.WriteRow([]interface{}{"squat", nil, 140.0, false}))
+	require.NoError(t, w.Close())
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	parts := map[string]string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		parts[file.Name] = string(content)
+	}
+
+	assert.Contains(t, parts, "[Content_Types].xml")
+	assert.Contains(t, parts, "_rels/.rels")
+	assert.Contains(t, parts, "xl/_rels/workbook.xml.rels")
+	assert.Contains(t, parts["xl/workbook.xml"], `name="Workouts &amp; more"`)
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `<c r="A2" t="inlineStr"><is><t xml:space="preserve"> bench &lt;heavy&gt; </t></is></c>`)
+	assert.Contains(t, sheet, `<c r="B2"><v>5</v></c>`)
+	assert.Contains(t, sheet, `<c r="C2"><v>102.5</v></c>`)
+	assert.Contains(t, sheet, `<c r="D2" t="b"><v>1</v></c>`)
+	assert.Contains(t, sheet, `<c r="C3"><v>140</v></c>`)
+	assert.NotContains(t, sheet, `r="B3"`)
+	assert.Contains(t, sheet, `</sheetData></worksheet>`)
+}
+
+func TestColumnName(t *testing.T) {
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{27, "AB"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.want, xlsx.ColumnName(test.index))
+	}
+}
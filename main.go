@@ -12,15 +12,25 @@ import (
 
 func main() {
 	var port int
+	var trashRetention time.Duration
+	var purgeInterval time.Duration
 	flag.IntVar(&port, "port", 8080, "go backend server port") // flag is cool, allows you to run `go run . -port 1537` which will then set port to be this val
+	flag.DurationVar(&trashRetention, "trash-retention", 30*24*time.Hour, "how long deleted workouts stay restorable before they're purged")
+	flag.DurationVar(&purgeInterval, "purge-interval", time.Hour, "how often the trash is checked for workouts to purge")
 	flag.Parse()
 
+	if trashRetention < 0 || purgeInterval <= 0 {
+		panic("trash-retention can't be negative and purge-interval has to be greater than 0")
+	}
+
 	application, err := app.NewApplication()
 	if err != nil {
 		panic(err)
 	}
 	defer application.DB.Close()
 
+	go application.PurgeTrash(trashRetention, purgeInterval)
+
 	routes := router.SetupRoutes(application)
 
 	server := &http.Server{
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- renumber any workouts that already have clashing order_index values before the constraint goes on
+UPDATE workout_entries e
+SET order_index = r.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY workout_id ORDER BY order_index, id) AS position
+    FROM workout_entries
+    WHERE workout_id IN (
+        SELECT workout_id
+        FROM workout_entries
+        GROUP BY workout_id, order_index
+        HAVING COUNT(*) > 1
+    )
+) r
+WHERE e.id = r.id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- deferred so reordering can swap two entries inside a single transaction
+ALTER TABLE workout_entries
+ADD CONSTRAINT workout_entries_order_unique UNIQUE (workout_id, order_index) DEFERRABLE INITIALLY DEFERRED;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_entries DROP CONSTRAINT workout_entries_order_unique;
+-- +goose StatementEnd
\ No newline at end of file
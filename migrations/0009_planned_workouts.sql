@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS planned_workouts (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    template_id BIGINT REFERENCES workout_templates(id) ON DELETE SET NULL,
+    title VARCHAR(255) NOT NULL,
+    notes TEXT,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL, -- DTSTART, the first occurrence
+    time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC', -- IANA zone the rule is expanded in
+    duration_minutes INTEGER NOT NULL,
+    rrule TEXT, -- NULL for a one off session
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- only occurrences someone has done something with get a row, anything else is planned or missed depending on the date
+CREATE TABLE IF NOT EXISTS planned_workout_occurrences (
+    id BIGSERIAL PRIMARY KEY,
+    planned_workout_id BIGINT NOT NULL REFERENCES planned_workouts(id) ON DELETE CASCADE,
+    occurs_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    workout_id BIGINT REFERENCES workouts(id) ON DELETE SET NULL,
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT valid_occurrence_status CHECK (status IN ('completed', 'skipped')),
+    CONSTRAINT planned_workout_occurrences_unique UNIQUE (planned_workout_id, occurs_at)
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_planned_workouts_user ON planned_workouts (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE planned_workout_occurrences;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE planned_workouts;
+-- +goose StatementEnd
\ No newline at end of file
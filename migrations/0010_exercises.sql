@@ -0,0 +1,141 @@
+-- +goose Up
+-- +goose StatementBegin
+-- user_id is NULL for the shared catalog, otherwise it's a custom exercise only that user can see
+CREATE TABLE IF NOT EXISTS exercises (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    primary_muscles TEXT[] NOT NULL DEFAULT '{}',
+    secondary_muscles TEXT[] NOT NULL DEFAULT '{}',
+    equipment VARCHAR(32) NOT NULL DEFAULT 'other',
+    movement_pattern VARCHAR(32) NOT NULL DEFAULT 'other',
+    aliases TEXT[] NOT NULL DEFAULT '{}', -- lowercase, punctuation stripped
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exercises_owner_name ON exercises (COALESCE(user_id, 0), lower(name));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO exercises (name, primary_muscles, secondary_muscles, equipment, movement_pattern, aliases) VALUES
+    ('Barbell Bench Press', '{chest}', '{triceps,shoulders}', 'barbell', 'push', '{bench press,bench,flat bench,barbell bench}'),
+    ('Incline Barbell Bench Press', '{chest}', '{shoulders,triceps}', 'barbell', 'push', '{incline bench,incline bench press}'),
+    ('Dumbbell Bench Press', '{chest}', '{triceps,shoulders}', 'dumbbell', 'push', '{dumbbell bench,db bench,db bench press}'),
+    ('Push Up', '{chest}', '{triceps,shoulders,core}', 'bodyweight', 'push', '{push ups,pushup,pushups,press up,press ups}'),
+    ('Dips', '{triceps,chest}', '{shoulders}', 'bodyweight', 'push', '{dip,parallel bar dips}'),
+    ('Overhead Press', '{shoulders}', '{triceps}', 'barbell', 'push', '{ohp,military press,shoulder press,standing press}'),
+    ('Dumbbell Shoulder Press', '{shoulders}', '{triceps}', 'dumbbell', 'push', '{dumbbell overhead press,seated dumbbell press}'),
+    ('Lateral Raise', '{shoulders}', '{}', 'dumbbell', 'isolation', '{lateral raises,side raise,side lateral raise}'),
+    ('Barbell Back Squat', '{quads,glutes}', '{hamstrings,core}', 'barbell', 'squat', '{squat,squats,back squat}'),
+    ('Front Squat', '{quads}', '{glutes,core}', 'barbell', 'squat', '{front squats}'),
+    ('Goblet Squat', '{quads,glutes}', '{core}', 'kettlebell', 'squat', '{goblet squats}'),
+    ('Leg Press', '{quads,glutes}', '{hamstrings}', 'machine', 'squat', '{}'),
+    ('Deadlift', '{hamstrings,glutes,back}', '{forearms,core}', 'barbell', 'hinge', '{deadlifts,conventional deadlift,barbell deadlift}'),
+    ('Romanian Deadlift', '{hamstrings,glutes}', '{back}', 'barbell', 'hinge', '{rdl,romanian deadlifts,stiff leg deadlift}'),
+    ('Hip Thrust', '{glutes}', '{hamstrings}', 'barbell', 'hinge', '{hip thrusts,barbell hip thrust}'),
+    ('Kettlebell Swing', '{glutes,hamstrings}', '{core,shoulders}', 'kettlebell', 'hinge', '{kettlebell swings,swings}'),
+    ('Walking Lunge', '{quads,glutes}', '{hamstrings}', 'dumbbell', 'lunge', '{lunge,lunges,walking lunges}'),
+    ('Bulgarian Split Squat', '{quads,glutes}', '{hamstrings}', 'dumbbell', 'lunge', '{split squat,bulgarian split squats}'),
+    ('Leg Curl', '{hamstrings}', '{}', 'machine', 'isolation', '{hamstring curl,lying leg curl}'),
+    ('Leg Extension', '{quads}', '{}', 'machine', 'isolation', '{leg extensions}'),
+    ('Calf Raise', '{calves}', '{}', 'machine', 'isolation', '{calf raises,standing calf raise}'),
+    ('Pull Up', '{back}', '{biceps}', 'bodyweight', 'pull', '{pull ups,pullup,pullups,chin up,chin ups}'),
+    ('Lat Pulldown', '{back}', '{biceps}', 'cable', 'pull', '{pulldown,lat pull down}'),
+    ('Barbell Row', '{back}', '{biceps,forearms}', 'barbell', 'pull', '{bent over row,barbell rows,bent over barbell row}'),
+    ('Dumbbell Row', '{back}', '{biceps}', 'dumbbell', 'pull', '{one arm dumbbell row,single arm row}'),
+    ('Seated Cable Row', '{back}', '{biceps}', 'cable', 'pull', '{cable row,seated row}'),
+    ('Face Pull', '{shoulders,back}', '{}', 'cable', 'pull', '{face pulls}'),
+    ('Barbell Curl', '{biceps}', '{forearms}', 'barbell', 'isolation', '{bicep curl,biceps curl,curls}'),
+    ('Dumbbell Curl', '{biceps}', '{forearms}', 'dumbbell', 'isolation', '{dumbbell curls,dumbbell bicep curl}'),
+    ('Hammer Curl', '{biceps,forearms}', '{}', 'dumbbell', 'isolation', '{hammer curls}'),
+    ('Tricep Pushdown', '{triceps}', '{}', 'cable', 'isolation', '{triceps pushdown,cable pushdown,rope pushdown}'),
+    ('Skull Crusher', '{triceps}', '{}', 'barbell', 'isolation', '{skull crushers,lying tricep extension}'),
+    ('Plank', '{core}', '{shoulders}', 'bodyweight', 'core', '{planks,front plank}'),
+    ('Hanging Leg Raise', '{core}', '{}', 'bodyweight', 'core', '{leg raises,hanging leg raises}'),
+    ('Crunch', '{core}', '{}', 'bodyweight', 'core', '{crunches,sit up,sit ups}'),
+    ('Farmers Carry', '{forearms,core}', '{shoulders}', 'dumbbell', 'carry', '{farmers walk,farmer carry,farmer walk}'),
+    ('Running', '{quads,hamstrings,calves}', '{glutes}', 'none', 'cardio', '{run,jog,jogging,treadmill}'),
+    ('Cycling', '{quads,glutes}', '{hamstrings,calves}', 'cardio_machine', 'cardio', '{bike,cycle,spin,stationary bike}'),
+    ('Rowing Machine', '{back,quads}', '{biceps,glutes}', 'cardio_machine', 'cardio', '{rower,rowing,erg}'),
+    ('Jump Rope', '{calves}', '{shoulders}', 'other', 'cardio', '{skipping,jumping rope}'),
+    ('Burpee', '{full_body}', '{}', 'bodyweight', 'cardio', '{burpees}')
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- the entry keeps exercise_name as typed, exercise_id is what analytics group on
+ALTER TABLE workout_entries
+ADD COLUMN exercise_id BIGINT REFERENCES exercises(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workout_template_entries
+ADD COLUMN exercise_id BIGINT REFERENCES exercises(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_workout_entries_exercise ON workout_entries (exercise_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- backfill against the shared catalog on name or alias, the API does fuzzy matching from here on
+UPDATE workout_entries e
+SET exercise_id = x.id
+FROM exercises x
+WHERE x.user_id IS NULL
+AND e.exercise_id IS NULL
+AND (
+    trim(regexp_replace(lower(x.name), '[^a-z0-9]+', ' ', 'g')) = trim(regexp_replace(lower(e.exercise_name), '[^a-z0-9]+', ' ', 'g'))
+    OR trim(regexp_replace(lower(e.exercise_name), '[^a-z0-9]+', ' ', 'g')) = ANY(x.aliases)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- anything the catalog doesn't know about becomes a custom exercise for the workout's owner so no history is orphaned
+INSERT INTO exercises (user_id, name)
+SELECT DISTINCT ON (w.user_id, lower(trim(e.exercise_name))) w.user_id, trim(e.exercise_name)
+FROM workout_entries e
+JOIN workouts w ON w.id = e.workout_id
+WHERE e.exercise_id IS NULL
+AND w.user_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE workout_entries e
+SET exercise_id = x.id
+FROM workouts w, exercises x
+WHERE w.id = e.workout_id
+AND x.user_id = w.user_id
+AND lower(x.name) = lower(trim(e.exercise_name))
+AND e.exercise_id IS NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE workout_template_entries te
+SET exercise_id = x.id
+FROM workout_templates t, exercises x
+WHERE t.id = te.template_id
+AND (x.user_id IS NULL OR x.user_id = t.user_id)
+AND te.exercise_id IS NULL
+AND (
+    trim(regexp_replace(lower(x.name), '[^a-z0-9]+', ' ', 'g')) = trim(regexp_replace(lower(te.exercise_name), '[^a-z0-9]+', ' ', 'g'))
+    OR trim(regexp_replace(lower(te.exercise_name), '[^a-z0-9]+', ' ', 'g')) = ANY(x.aliases)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_template_entries DROP COLUMN exercise_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workout_entries DROP COLUMN exercise_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE exercises;
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+-- one row each time a record is set, the current record is the best value per key so the history comes for free
+CREATE TABLE IF NOT EXISTS personal_records (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    exercise_id BIGINT NOT NULL REFERENCES exercises(id) ON DELETE CASCADE,
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    entry_id BIGINT REFERENCES workout_entries(id) ON DELETE CASCADE, -- NULL for most_volume, it covers the whole session
+    record_type VARCHAR(32) NOT NULL,
+    formula VARCHAR(16), -- only for estimated_1rm
+    value DOUBLE PRECISION NOT NULL,
+    weight DOUBLE PRECISION,
+    reps INTEGER,
+    achieved_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT valid_record_type CHECK (record_type IN ('heaviest_weight', 'most_reps', 'estimated_1rm', 'most_volume'))
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_personal_records_user_exercise ON personal_records (user_id, exercise_id, record_type);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_personal_records_workout ON personal_records (workout_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE personal_records;
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- session RPE (Foster's CR-10 scale) for the whole workout, duration x RPE is the session's training load
+ALTER TABLE workouts
+ADD COLUMN session_rpe SMALLINT,
+ADD CONSTRAINT valid_session_rpe CHECK (session_rpe IS NULL OR session_rpe BETWEEN 1 AND 10);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workouts
+DROP CONSTRAINT valid_session_rpe,
+DROP COLUMN session_rpe;
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+-- weights are stored in kg whatever they were entered in, weight_unit remembers what the lifter typed.
+-- DECIMAL(5, 2) topped out at 999.99 which a heavy lb lift goes straight past, the extra decimal places keep lb -> kg -> lb exact
+ALTER TABLE workout_entries
+ALTER COLUMN weight TYPE NUMERIC(10, 4),
+ADD COLUMN weight_unit VARCHAR(2) NOT NULL DEFAULT 'kg',
+ADD CONSTRAINT valid_workout_entry_weight_unit CHECK (weight_unit IN ('kg', 'lb'));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workout_template_entries
+ALTER COLUMN weight TYPE NUMERIC(10, 4),
+ADD COLUMN weight_unit VARCHAR(2) NOT NULL DEFAULT 'kg',
+ADD CONSTRAINT valid_template_entry_weight_unit CHECK (weight_unit IN ('kg', 'lb'));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN preferred_unit VARCHAR(2) NOT NULL DEFAULT 'kg',
+ADD CONSTRAINT valid_preferred_unit CHECK (preferred_unit IN ('kg', 'lb'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+DROP CONSTRAINT valid_preferred_unit,
+DROP COLUMN preferred_unit;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- anything over 999.99kg can't go back into the old column, so this fails rather than silently losing it
+ALTER TABLE workout_template_entries
+DROP CONSTRAINT valid_template_entry_weight_unit,
+DROP COLUMN weight_unit,
+ALTER COLUMN weight TYPE DECIMAL(5, 2);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+DROP CONSTRAINT valid_workout_entry_weight_unit,
+DROP COLUMN weight_unit,
+ALTER COLUMN weight TYPE DECIMAL(5, 2);
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+-- optional per-set detail for an entry, when an entry has sets its sets/reps/weight columns are a summary worked out from them
+CREATE TABLE IF NOT EXISTS workout_sets (
+    id BIGSERIAL PRIMARY KEY,
+    entry_id BIGINT NOT NULL REFERENCES workout_entries(id) ON DELETE CASCADE,
+    set_number INTEGER NOT NULL,
+    reps INTEGER,
+    duration_seconds INTEGER,
+    weight NUMERIC(10, 4), -- kg, same as workout_entries.weight
+    rpe NUMERIC(3, 1),
+    rir INTEGER,
+    rest_seconds INTEGER,
+    is_warmup BOOLEAN NOT NULL DEFAULT FALSE,
+    is_drop_set BOOLEAN NOT NULL DEFAULT FALSE,
+    is_failure BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT valid_workout_set CHECK (
+        (reps IS NOT NULL or duration_seconds IS NOT NULL) AND
+        (reps IS NULL OR duration_seconds IS NULL)
+    ),
+    CONSTRAINT valid_workout_set_rpe CHECK (rpe IS NULL OR rpe BETWEEN 1 AND 10),
+    CONSTRAINT valid_workout_set_rir CHECK (rir IS NULL OR rir >= 0),
+    CONSTRAINT valid_workout_set_rest CHECK (rest_seconds IS NULL OR rest_seconds >= 0),
+    CONSTRAINT workout_sets_number_unique UNIQUE (entry_id, set_number)
+)
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_sets;
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+-- supersets, circuits etc, entries point at their group and the group holds what's shared between them
+CREATE TABLE IF NOT EXISTS workout_entry_groups (
+    id BIGSERIAL PRIMARY KEY,
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL, -- 0 based, what entries refer to as group_index
+    group_type VARCHAR(16) NOT NULL,
+    rounds INTEGER NOT NULL DEFAULT 1,
+    rest_seconds INTEGER, -- after each round
+    time_cap_seconds INTEGER, -- AMRAP
+    notes TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT valid_entry_group_type CHECK (group_type IN ('superset', 'giant_set', 'circuit', 'emom', 'amrap')),
+    CONSTRAINT valid_entry_group_rounds CHECK (rounds >= 0),
+    CONSTRAINT workout_entry_groups_position_unique UNIQUE (workout_id, position)
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+ADD COLUMN group_id BIGINT REFERENCES workout_entry_groups(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_workout_entries_group ON workout_entries (group_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_entries DROP COLUMN group_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE workout_entry_groups;
+-- +goose StatementEnd
\ No newline at end of file
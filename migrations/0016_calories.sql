@@ -0,0 +1,64 @@
+-- +goose Up
+-- +goose StatementBegin
+-- MET for the catalog's cardio, everything else falls back to a value for its movement pattern in the calories package
+ALTER TABLE exercises
+ADD COLUMN met NUMERIC(4, 1),
+ADD CONSTRAINT valid_exercise_met CHECK (met IS NULL OR met > 0);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE exercises x
+SET met = v.met
+FROM (VALUES
+    ('Running', 8.0),
+    ('Cycling', 6.8),
+    ('Rowing Machine', 7.0),
+    ('Jump Rope', 11.0),
+    ('Burpee', 8.0)
+) AS v(name, met)
+WHERE x.user_id IS NULL
+AND x.name = v.name;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- workouts logged before this all count as measured, whatever was sent is what the user said
+ALTER TABLE workouts
+ADD COLUMN calories_source VARCHAR(16) NOT NULL DEFAULT 'measured',
+ADD CONSTRAINT valid_calories_source CHECK (calories_source IN ('measured', 'estimated'));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- a log rather than a column on users so the estimate can use the latest weigh-in and trends can be charted later
+CREATE TABLE IF NOT EXISTS body_weights (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    weight NUMERIC(10, 4) NOT NULL, -- kg like every other weight
+    weight_unit VARCHAR(2) NOT NULL DEFAULT 'kg',
+    measured_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT valid_body_weight CHECK (weight > 0),
+    CONSTRAINT valid_body_weight_unit CHECK (weight_unit IN ('kg', 'lb'))
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_body_weights_user_measured ON body_weights (user_id, measured_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE body_weights;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workouts
+DROP CONSTRAINT valid_calories_source,
+DROP COLUMN calories_source;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE exercises
+DROP CONSTRAINT valid_exercise_met,
+DROP COLUMN met;
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+-- created_at is when the row was written, started_at is when the session actually happened so it can be backdated.
+-- Existing workouts keep created_at as their start, which is what the calendar feed has been showing them at
+ALTER TABLE workouts
+ADD COLUMN started_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN ended_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC'; -- IANA zone the session was done in
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE workouts
+SET started_at = COALESCE(created_at, CURRENT_TIMESTAMP);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workouts
+ALTER COLUMN started_at SET NOT NULL,
+ALTER COLUMN started_at SET DEFAULT CURRENT_TIMESTAMP,
+ADD CONSTRAINT valid_workout_times CHECK (ended_at IS NULL OR ended_at > started_at);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_workouts_user_started ON workouts (user_id, started_at);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- what a new workout's time_zone defaults to and where date based queries cut the day when ?tz= isn't given
+ALTER TABLE users
+ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN time_zone;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workouts_user_started;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workouts
+DROP CONSTRAINT valid_workout_times,
+DROP COLUMN time_zone,
+DROP COLUMN ended_at,
+DROP COLUMN started_at;
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- deleting a workout moves it to the trash, the purge job removes it for good once it's been there long enough
+ALTER TABLE workouts
+ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_workouts_deleted ON workouts (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- anything still in the trash would come back to life without its deleted_at, so it goes now
+DELETE FROM workouts WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workouts_deleted;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workouts DROP COLUMN deleted_at;
+-- +goose StatementEnd
\ No newline at end of file
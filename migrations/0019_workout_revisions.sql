@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a snapshot of the whole workout (entries, sets and groups included) as it was after each change, written in the same
+-- transaction as the change itself and never updated. Workouts from before this start their history at their next change
+CREATE TABLE IF NOT EXISTS workout_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL, -- 1 based per workout
+    action VARCHAR(16) NOT NULL,
+    snapshot JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT valid_revision_action CHECK (action IN ('create', 'update', 'delete', 'restore', 'revert')),
+    CONSTRAINT workout_revisions_unique UNIQUE (workout_id, revision)
+)
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_revisions;
+-- +goose StatementEnd
\ No newline at end of file
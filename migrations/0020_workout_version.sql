@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- bumped on every change to the workout or its entries, it's what the ETag on GET /workouts/{id} is made from
+ALTER TABLE workouts ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workouts DROP COLUMN IF EXISTS version;
+-- +goose StatementEnd
\ No newline at end of file
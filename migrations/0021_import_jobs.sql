@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- one row per POST /imports, the job updates its counts as it goes so the client can poll GET /imports/{id} for progress
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    format VARCHAR(16) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    total INTEGER NOT NULL DEFAULT 0, -- workouts found in the file
+    processed INTEGER NOT NULL DEFAULT 0,
+    created INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0, -- already logged, usually from an earlier import of the same file
+    failed INTEGER NOT NULL DEFAULT 0,
+    warnings JSONB NOT NULL DEFAULT '[]', -- rows the parser skipped or changed
+    errors JSONB NOT NULL DEFAULT '[]', -- workouts that couldn't be created
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE,
+
+    CONSTRAINT valid_import_status CHECK (status IN ('pending', 'running', 'completed', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_jobs_user ON import_jobs (user_id, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE import_jobs;
+-- +goose StatementEnd
\ No newline at end of file
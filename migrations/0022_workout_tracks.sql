@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the GPS recording behind a cardio workout. The summary columns are worked out from raw, which is the file exactly as
+-- uploaded so the numbers can be worked out again when the maths changes. Postgres compresses raw by itself when it's big
+CREATE TABLE IF NOT EXISTS workout_tracks (
+    workout_id BIGINT PRIMARY KEY REFERENCES workouts(id) ON DELETE CASCADE,
+    format VARCHAR(8) NOT NULL,
+    sport VARCHAR(16) NOT NULL DEFAULT '',
+    raw BYTEA NOT NULL,
+    points INTEGER NOT NULL,
+    distance_meters DOUBLE PRECISION NOT NULL,
+    elapsed_seconds INTEGER NOT NULL,
+    moving_seconds INTEGER NOT NULL,
+    elevation_gain_meters DOUBLE PRECISION NOT NULL,
+    avg_speed_mps DOUBLE PRECISION,
+    avg_heart_rate INTEGER,
+    max_heart_rate INTEGER,
+    processed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT valid_track_format CHECK (format IN ('gpx', 'tcx'))
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- the outdoor sports a track can be that the catalog didn't have, without them a walk would fuzzy match Walking Lunge
+INSERT INTO exercises (name, primary_muscles, secondary_muscles, equipment, movement_pattern, aliases, met) VALUES
+    ('Walking', '{quads,calves}', '{glutes,hamstrings}', 'none', 'cardio', '{walk,brisk walk}', 3.5),
+    ('Hiking', '{quads,glutes}', '{hamstrings,calves}', 'none', 'cardio', '{hike,hill walk,trekking}', 6.0),
+    ('Swimming', '{full_body}', '{}', 'none', 'cardio', '{swim,lane swimming,open water swim}', 7.0)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM exercises WHERE user_id IS NULL AND name IN ('Walking', 'Hiking', 'Swimming');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE workout_tracks;
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,61 @@
+-- +goose Up
+-- +goose StatementBegin
+-- cardio entries can be logged by distance instead of reps or time. distance_meters is per set like reps are,
+-- distance_unit remembers what it was entered in the same as weight_unit does. pace is worked out from distance and
+-- duration when an entry has both, it's stored so filters and analytics don't have to work it out every time
+ALTER TABLE workout_entries
+ADD COLUMN distance_meters NUMERIC(12, 4),
+ADD COLUMN distance_unit VARCHAR(2) NOT NULL DEFAULT 'km',
+ADD COLUMN pace_seconds_per_km NUMERIC(8, 2),
+ADD COLUMN avg_heart_rate INTEGER,
+ADD COLUMN max_heart_rate INTEGER,
+ADD COLUMN cadence INTEGER,
+ADD COLUMN power INTEGER,
+ADD COLUMN elevation_gain_meters NUMERIC(8, 1),
+ADD CONSTRAINT valid_workout_entry_distance_unit CHECK (distance_unit IN ('m', 'km', 'mi')),
+ADD CONSTRAINT valid_workout_entry_cardio CHECK (
+    (distance_meters IS NULL OR distance_meters > 0) AND
+    (avg_heart_rate IS NULL OR avg_heart_rate BETWEEN 20 AND 250) AND
+    (max_heart_rate IS NULL OR max_heart_rate BETWEEN 20 AND 250) AND
+    (avg_heart_rate IS NULL OR max_heart_rate IS NULL OR max_heart_rate >= avg_heart_rate) AND
+    (cadence IS NULL OR cadence >= 0) AND
+    (power IS NULL OR power >= 0) AND
+    (elevation_gain_meters IS NULL OR elevation_gain_meters >= 0)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- a run can be just a distance, but reps and a distance together don't mean anything
+ALTER TABLE workout_entries
+DROP CONSTRAINT valid_workout_entry,
+ADD CONSTRAINT valid_workout_entry CHECK (
+    (reps IS NOT NULL OR duration_seconds IS NOT NULL OR distance_meters IS NOT NULL) AND
+    (reps IS NULL OR duration_seconds IS NULL) AND
+    (reps IS NULL OR distance_meters IS NULL)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- entries logged with only a distance can't go back under the old constraint, so this fails rather than deleting them
+ALTER TABLE workout_entries
+DROP CONSTRAINT valid_workout_entry,
+ADD CONSTRAINT valid_workout_entry CHECK (
+    (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND
+    (reps IS NULL OR duration_seconds IS NULL)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+DROP CONSTRAINT valid_workout_entry_cardio,
+DROP CONSTRAINT valid_workout_entry_distance_unit,
+DROP COLUMN elevation_gain_meters,
+DROP COLUMN power,
+DROP COLUMN cadence,
+DROP COLUMN max_heart_rate,
+DROP COLUMN avg_heart_rate,
+DROP COLUMN pace_seconds_per_km,
+DROP COLUMN distance_unit,
+DROP COLUMN distance_meters;
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+-- what heart rate zones are worked out from, left NULL until the user sets them
+ALTER TABLE users
+ADD COLUMN max_heart_rate INTEGER,
+ADD COLUMN resting_heart_rate INTEGER,
+ADD CONSTRAINT valid_user_heart_rate CHECK (
+    (max_heart_rate IS NULL OR max_heart_rate BETWEEN 100 AND 250) AND
+    (resting_heart_rate IS NULL OR resting_heart_rate BETWEEN 20 AND 150) AND
+    (max_heart_rate IS NULL OR resting_heart_rate IS NULL OR resting_heart_rate < max_heart_rate)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- a workout's heart rate samples as one row of two arrays rather than a row a sample, an hour at one a second is
+-- 3600 samples. offsets are seconds from the workout's started_at, bpm is the reading at that offset
+CREATE TABLE IF NOT EXISTS workout_heart_rates (
+    workout_id BIGINT PRIMARY KEY REFERENCES workouts(id) ON DELETE CASCADE,
+    offsets INTEGER[] NOT NULL,
+    bpm SMALLINT[] NOT NULL,
+    uploaded_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT valid_heart_rate_samples CHECK (cardinality(offsets) = cardinality(bpm))
+)
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_heart_rates;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE users
+DROP CONSTRAINT valid_user_heart_rate,
+DROP COLUMN resting_heart_rate,
+DROP COLUMN max_heart_rate;
+-- +goose StatementEnd
\ No newline at end of file
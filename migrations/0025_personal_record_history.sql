@@ -0,0 +1,77 @@
+-- +goose Up
+-- +goose StatementBegin
+-- personal_records used to only get a row when a workout beat the best at the time it was saved, so trashing or
+-- lowering the workout holding a record left nothing behind it. It now has every workout's best per record key and
+-- the record is the highest of them, this works those out for the history that's already there.
+-- Same rules as records.Best: warm-ups and timed sets don't count, estimated 1RMs are rounded to 2 decimal places
+DELETE FROM personal_records;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO personal_records (user_id, exercise_id, workout_id, entry_id, record_type, formula, value, weight, reps, achieved_at)
+WITH lifts AS (
+    SELECT w.user_id, w.id AS workout_id, w.started_at, e.exercise_id, e.id AS entry_id, e.sets, e.reps, COALESCE(e.weight, 0)::float8 AS weight
+    FROM workouts w
+    JOIN workout_entries e ON e.workout_id = w.id
+    WHERE e.exercise_id IS NOT NULL
+    AND e.reps IS NOT NULL
+    AND NOT EXISTS (SELECT 1 FROM workout_sets ws WHERE ws.entry_id = e.id)
+
+    UNION ALL
+
+    SELECT w.user_id, w.id, w.started_at, e.exercise_id, e.id, 1, ws.reps, COALESCE(ws.weight, 0)::float8
+    FROM workouts w
+    JOIN workout_entries e ON e.workout_id = w.id
+    JOIN workout_sets ws ON ws.entry_id = e.id
+    WHERE e.exercise_id IS NOT NULL
+    AND ws.reps IS NOT NULL
+    AND NOT ws.is_warmup
+),
+valid AS (
+    SELECT * FROM lifts WHERE reps > 0 AND sets > 0 AND weight >= 0
+),
+candidates AS (
+    SELECT user_id, workout_id, started_at, exercise_id, entry_id, 'most_reps' AS record_type, NULL AS formula,
+        reps::float8 AS value, weight, reps
+    FROM valid
+
+    UNION ALL
+
+    SELECT user_id, workout_id, started_at, exercise_id, entry_id, 'heaviest_weight', NULL, weight, weight, reps
+    FROM valid
+    WHERE weight > 0
+
+    UNION ALL
+
+    SELECT user_id, workout_id, started_at, exercise_id, entry_id, 'estimated_1rm', f.formula,
+        ROUND((CASE
+            WHEN reps = 1 THEN weight
+            WHEN f.formula = 'epley' THEN weight * (1 + reps / 30.0)
+            WHEN f.formula = 'brzycki' THEN weight * 36 / (37 - reps)
+            ELSE weight * power(reps, 0.1)
+        END)::numeric, 2)::float8,
+        weight, reps
+    FROM valid
+    CROSS JOIN (VALUES ('epley'), ('brzycki'), ('lombardi')) AS f(formula)
+    WHERE weight > 0
+    AND NOT (f.formula = 'brzycki' AND reps >= 37)
+
+    UNION ALL
+
+    SELECT user_id, workout_id, started_at, exercise_id, NULL, 'most_volume', NULL,
+        ROUND(SUM(sets * reps * weight)::numeric, 2)::float8, NULL, NULL
+    FROM valid
+    WHERE weight > 0
+    GROUP BY user_id, workout_id, started_at, exercise_id
+)
+SELECT DISTINCT ON (workout_id, exercise_id, record_type, formula, CASE WHEN record_type = 'most_reps' THEN weight END)
+    user_id, exercise_id, workout_id, entry_id, record_type, formula, value, weight, reps, started_at
+FROM candidates
+ORDER BY workout_id, exercise_id, record_type, formula, CASE WHEN record_type = 'most_reps' THEN weight END, value DESC, entry_id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- the extra rows don't change which record is current, there's nothing to undo
+SELECT 1;
+-- +goose StatementEnd
\ No newline at end of file